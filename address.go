@@ -0,0 +1,444 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Bitcoin networks an address can belong to
+const (
+	networkMainnet = "mainnet"
+	networkTestnet = "testnet"
+	networkRegtest = "regtest"
+)
+
+// Address types
+const (
+	addressP2PKH   = "P2PKH"
+	addressP2SH    = "P2SH"
+	addressP2WPKH  = "P2WPKH"
+	addressP2WSH   = "P2WSH"
+	addressP2TR    = "P2TR"
+	addressWitness = "witness"
+)
+
+// Human-readable descriptions of the address types
+var addressTypeNames = map[string]string{
+	addressP2PKH:   "legacy pay-to-public-key-hash",
+	addressP2SH:    "pay-to-script-hash",
+	addressP2WPKH:  "native SegWit v0 key hash",
+	addressP2WSH:   "native SegWit v0 script hash",
+	addressP2TR:    "Taproot",
+	addressWitness: "future SegWit version",
+}
+
+// btcAddress is a decoded and validated Bitcoin address
+type btcAddress struct {
+	Type    string
+	Network string
+	// Witness version, only set for SegWit addresses
+	WitnessVersion int
+	// Public key hash, script hash or witness program
+	Program []byte
+}
+
+// Function to check whether an address is a bech32 SegWit address
+func (a btcAddress) isSegwit() bool {
+	return a.Type != addressP2PKH && a.Type != addressP2SH
+}
+
+// Alphabet of base58 encoding
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// Function to decode a base58check string, returning the payload without its checksum
+func base58CheckDecode(s string) ([]byte, error) {
+	value := new(big.Int)
+	radix := big.NewInt(58)
+	for _, r := range s {
+		digit := strings.IndexRune(base58Alphabet, r)
+		if digit < 0 {
+			return nil, fmt.Errorf("invalid base58 character %q", r)
+		}
+		value.Mul(value, radix)
+		value.Add(value, big.NewInt(int64(digit)))
+	}
+
+	// Each leading '1' stands for a leading zero byte
+	decoded := value.Bytes()
+	for i := 0; i < len(s) && s[i] == '1'; i++ {
+		decoded = append([]byte{0}, decoded...)
+	}
+
+	if len(decoded) < 4 {
+		return nil, errors.New("base58 string too short")
+	}
+	payload, checksum := decoded[:len(decoded)-4], decoded[len(decoded)-4:]
+	if !bytes.Equal(doubleSHA256(payload)[:4], checksum) {
+		return nil, errors.New("invalid base58 checksum")
+	}
+	return payload, nil
+}
+
+// Function to encode a payload as base58check
+func base58CheckEncode(payload []byte) string {
+	data := append(append([]byte{}, payload...), doubleSHA256(payload)[:4]...)
+
+	value := new(big.Int).SetBytes(data)
+	radix := big.NewInt(58)
+	mod := new(big.Int)
+	var encoded []byte
+	for value.Sign() > 0 {
+		value.DivMod(value, radix, mod)
+		encoded = append(encoded, base58Alphabet[mod.Int64()])
+	}
+	for _, b := range data {
+		if b != 0 {
+			break
+		}
+		encoded = append(encoded, '1')
+	}
+
+	// Digits were produced least significant first
+	for i, j := 0, len(encoded)-1; i < j; i, j = i+1, j-1 {
+		encoded[i], encoded[j] = encoded[j], encoded[i]
+	}
+	return string(encoded)
+}
+
+// Helper function to hash data twice with SHA-256
+func doubleSHA256(data []byte) []byte {
+	first := sha256.Sum256(data)
+	second := sha256.Sum256(first[:])
+	return second[:]
+}
+
+// Alphabet of bech32 encoding
+const bech32Alphabet = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+// Checksum constants of bech32 (BIP 173) and bech32m (BIP 350)
+const (
+	bech32Const  = 1
+	bech32mConst = 0x2bc830a3
+)
+
+// Function to compute the bech32 checksum polynomial
+func bech32Polymod(values []byte) uint32 {
+	generator := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	checksum := uint32(1)
+	for _, v := range values {
+		top := checksum >> 25
+		checksum = (checksum&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>i)&1 == 1 {
+				checksum ^= generator[i]
+			}
+		}
+	}
+	return checksum
+}
+
+// Helper function to expand the human-readable part for checksumming
+func bech32HRPExpand(hrp string) []byte {
+	expanded := make([]byte, 0, len(hrp)*2+1)
+	for i := 0; i < len(hrp); i++ {
+		expanded = append(expanded, hrp[i]>>5)
+	}
+	expanded = append(expanded, 0)
+	for i := 0; i < len(hrp); i++ {
+		expanded = append(expanded, hrp[i]&31)
+	}
+	return expanded
+}
+
+// Function to decode a bech32 or bech32m string into its human-readable part,
+// 5-bit data values and checksum constant
+func bech32Decode(s string) (string, []byte, uint32, error) {
+	if len(s) > 90 {
+		return "", nil, 0, errors.New("bech32 string too long")
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < 33 || s[i] > 126 {
+			return "", nil, 0, fmt.Errorf("invalid bech32 character %q", s[i])
+		}
+	}
+	if strings.ToLower(s) != s && strings.ToUpper(s) != s {
+		return "", nil, 0, errors.New("mixed case in bech32 string")
+	}
+	s = strings.ToLower(s)
+
+	separator := strings.LastIndexByte(s, '1')
+	if separator < 1 || separator+7 > len(s) {
+		return "", nil, 0, errors.New("invalid bech32 separator position")
+	}
+	hrp := s[:separator]
+
+	data := make([]byte, 0, len(s)-separator-1)
+	for _, r := range s[separator+1:] {
+		value := strings.IndexRune(bech32Alphabet, r)
+		if value < 0 {
+			return "", nil, 0, fmt.Errorf("invalid bech32 character %q", r)
+		}
+		data = append(data, byte(value))
+	}
+
+	constant := bech32Polymod(append(bech32HRPExpand(hrp), data...))
+	if constant != bech32Const && constant != bech32mConst {
+		return "", nil, 0, errors.New("invalid bech32 checksum")
+	}
+	return hrp, data[:len(data)-6], constant, nil
+}
+
+// Function to encode 5-bit data values as bech32 or bech32m
+func bech32Encode(hrp string, data []byte, constant uint32) string {
+	values := append(bech32HRPExpand(hrp), data...)
+	values = append(values, 0, 0, 0, 0, 0, 0)
+	polymod := bech32Polymod(values) ^ constant
+
+	var b strings.Builder
+	b.WriteString(hrp)
+	b.WriteByte('1')
+	for _, v := range data {
+		b.WriteByte(bech32Alphabet[v])
+	}
+	for i := 0; i < 6; i++ {
+		b.WriteByte(bech32Alphabet[(polymod>>(5*(5-i)))&31])
+	}
+	return b.String()
+}
+
+// Function to encode a mainnet SegWit address for a witness program
+func encodeSegwitAddress(version int, program []byte) string {
+	data, _ := convertBits(program, 8, 5, true)
+	constant := uint32(bech32mConst)
+	if version == 0 {
+		constant = bech32Const
+	}
+	return bech32Encode("bc", append([]byte{byte(version)}, data...), constant)
+}
+
+// Function to regroup bits, e.g. from 5-bit bech32 values to bytes
+func convertBits(data []byte, from, to uint, pad bool) ([]byte, error) {
+	var acc, bits uint
+	maxValue := uint(1)<<to - 1
+	var converted []byte
+	for _, value := range data {
+		if uint(value)>>from != 0 {
+			return nil, errors.New("invalid data value")
+		}
+		acc = acc<<from | uint(value)
+		bits += from
+		for bits >= to {
+			bits -= to
+			converted = append(converted, byte(acc>>bits&maxValue))
+		}
+	}
+	if pad {
+		if bits > 0 {
+			converted = append(converted, byte(acc<<(to-bits)&maxValue))
+		}
+	} else if bits >= from || acc<<(to-bits)&maxValue != 0 {
+		return nil, errors.New("invalid padding")
+	}
+	return converted, nil
+}
+
+// Bech32 human-readable parts by network
+var bech32Networks = map[string]string{
+	"bc":   networkMainnet,
+	"tb":   networkTestnet,
+	"bcrt": networkRegtest,
+}
+
+// Function to decode and validate a SegWit address
+func parseSegwitAddress(s string) (btcAddress, error) {
+	hrp, data, constant, err := bech32Decode(s)
+	if err != nil {
+		return btcAddress{}, err
+	}
+	network, ok := bech32Networks[hrp]
+	if !ok {
+		return btcAddress{}, fmt.Errorf("unknown address prefix %s", hrp)
+	}
+	if len(data) == 0 {
+		return btcAddress{}, errors.New("missing witness version")
+	}
+
+	version := int(data[0])
+	program, err := convertBits(data[1:], 5, 8, false)
+	if err != nil {
+		return btcAddress{}, err
+	}
+	if version > 16 || len(program) < 2 || len(program) > 40 {
+		return btcAddress{}, errors.New("invalid witness program")
+	}
+
+	// Version 0 uses bech32, later versions bech32m
+	if (version == 0) != (constant == bech32Const) {
+		return btcAddress{}, errors.New("wrong checksum variant for witness version")
+	}
+
+	address := btcAddress{Network: network, WitnessVersion: version, Program: program}
+	switch {
+	case version == 0 && len(program) == 20:
+		address.Type = addressP2WPKH
+	case version == 0 && len(program) == 32:
+		address.Type = addressP2WSH
+	case version == 0:
+		return btcAddress{}, errors.New("invalid witness v0 program length")
+	case version == 1 && len(program) == 32:
+		address.Type = addressP2TR
+	default:
+		address.Type = addressWitness
+	}
+	return address, nil
+}
+
+// Base58 version bytes by address type and network
+var base58Versions = map[byte]struct{ addressType, network string }{
+	0x00: {addressP2PKH, networkMainnet},
+	0x05: {addressP2SH, networkMainnet},
+	0x6f: {addressP2PKH, networkTestnet},
+	0xc4: {addressP2SH, networkTestnet},
+}
+
+// Function to decode and validate a Bitcoin address of any type
+func parseAddress(s string) (btcAddress, error) {
+	lower := strings.ToLower(s)
+	if strings.HasPrefix(lower, "bc1") || strings.HasPrefix(lower, "tb1") || strings.HasPrefix(lower, "bcrt1") {
+		return parseSegwitAddress(s)
+	}
+
+	payload, err := base58CheckDecode(s)
+	if err != nil {
+		return btcAddress{}, err
+	}
+	if len(payload) != 21 {
+		return btcAddress{}, errors.New("invalid address length")
+	}
+	version, ok := base58Versions[payload[0]]
+	if !ok {
+		return btcAddress{}, fmt.Errorf("unknown address version %d", payload[0])
+	}
+	return btcAddress{Type: version.addressType, Network: version.network, Program: payload[1:]}, nil
+}
+
+// Funding statistics of an address
+type esploraAddressStats struct {
+	FundedTxoCount int64 `json:"funded_txo_count"`
+	FundedTxoSum   int64 `json:"funded_txo_sum"`
+	SpentTxoCount  int64 `json:"spent_txo_count"`
+	SpentTxoSum    int64 `json:"spent_txo_sum"`
+	TxCount        int64 `json:"tx_count"`
+}
+
+// Address summary as returned by the esplora API
+type esploraAddress struct {
+	Address      string              `json:"address"`
+	ChainStats   esploraAddressStats `json:"chain_stats"`
+	MempoolStats esploraAddressStats `json:"mempool_stats"`
+}
+
+// Function to get the confirmed balance of an address in sats
+func (a esploraAddress) balance() int64 {
+	return a.ChainStats.FundedTxoSum - a.ChainStats.SpentTxoSum
+}
+
+// Function to get the change in balance from unconfirmed transactions in sats
+func (a esploraAddress) pending() int64 {
+	return a.MempoolStats.FundedTxoSum - a.MempoolStats.SpentTxoSum
+}
+
+// Function to fetch the funding statistics of an address from the esplora API
+func getAddressStats(ctx context.Context, address string) (esploraAddress, error) {
+	var stats esploraAddress
+	if err := fetchJSON(ctx, fmt.Sprintf("%s/address/%s", cfg.MempoolURL, address), &stats); err != nil {
+		return esploraAddress{}, fmt.Errorf("error fetching address: %w", err)
+	}
+	return stats, nil
+}
+
+// Handle /address command
+func handleAddressCommand(ctx context.Context, update tgbotapi.Update) {
+	chatID := update.Message.Chat.ID
+
+	args := strings.Fields(update.Message.CommandArguments())
+	if len(args) == 0 {
+		sendMessage(chatID, "Usage: /address <address> [currency]")
+		return
+	}
+	currency, err := currencyFromArgs(chatID, args[1:])
+	if err != nil {
+		sendCurrencyError(chatID)
+		return
+	}
+
+	address, err := parseAddress(args[0])
+	if err != nil {
+		sendMessage(chatID, fmt.Sprintf("Invalid Bitcoin address: %v.", err))
+		return
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Address %s\n", args[0])
+	if address.Type == addressWitness {
+		fmt.Fprintf(&b, "Type: SegWit v%d (%s)\n", address.WitnessVersion, addressTypeNames[address.Type])
+	} else {
+		fmt.Fprintf(&b, "Type: %s (%s)\n", address.Type, addressTypeNames[address.Type])
+	}
+	fmt.Fprintf(&b, "Network: %s", address.Network)
+
+	// The configured backend only serves mainnet
+	if address.Network != networkMainnet {
+		sendMessage(chatID, b.String()+"\n\nBalances are only available for mainnet addresses.")
+		return
+	}
+
+	// Bech32 addresses may be written in upper case but the API expects lower case
+	lookup := args[0]
+	if address.isSegwit() {
+		lookup = strings.ToLower(lookup)
+	}
+
+	stats, statsAsOf, err := cached(ctx, "address:"+lookup, func(ctx context.Context) (esploraAddress, error) {
+		return getAddressStats(ctx, lookup)
+	})
+	if err != nil {
+		log.Println("Error fetching address:", err)
+		sendMessage(chatID, b.String()+"\n\nError fetching address balance.")
+		return
+	}
+
+	// Amounts are still useful in BTC when the price is unavailable
+	price, priceAsOf, err := getPrice(ctx, bitcoinID, currency)
+	if err != nil {
+		log.Println("Error fetching BTC price:", err)
+		priceAsOf = statsAsOf
+	}
+	formatAmount := func(sats int64) string {
+		if price == 0 {
+			return formatBTC(sats)
+		}
+		return formatBTCWithFiat(sats, price, currency)
+	}
+
+	fmt.Fprintf(&b, "\nBalance: %s\n", formatAmount(stats.balance()))
+	if pending := stats.pending(); pending != 0 {
+		fmt.Fprintf(&b, "Unconfirmed: %+.8f BTC\n", float64(pending)/satsPerBTC)
+	}
+	fmt.Fprintf(&b, "Total received: %s\n", formatBTC(stats.ChainStats.FundedTxoSum))
+	fmt.Fprintf(&b, "Total sent: %s\n", formatBTC(stats.ChainStats.SpentTxoSum))
+	fmt.Fprintf(&b, "Transactions: %d", stats.ChainStats.TxCount)
+	if stats.MempoolStats.TxCount > 0 {
+		fmt.Fprintf(&b, " (+%d unconfirmed)", stats.MempoolStats.TxCount)
+	}
+
+	sendMessage(chatID, b.String()+dataAsOf(statsAsOf, priceAsOf))
+}
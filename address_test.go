@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestBech32mBIP350Strings(t *testing.T) {
+	// Valid bech32m strings of BIP 350
+	valid := []string{
+		"A1LQFN3A",
+		"a1lqfn3a",
+		"an83characterlonghumanreadablepartthatcontainsthetheexcludedcharactersbioandnumber11sg7hg6",
+		"abcdef1l7aum6echk45nj3s0wdvt2fg8x9yrzpqzd3ryx",
+		"11llllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllludsr8",
+		"split1checkupstagehandshakeupstreamerranterredcaperredlc445v",
+		"?1v759aa",
+	}
+	for _, s := range valid {
+		_, _, constant, err := bech32Decode(s)
+		if err != nil || constant != bech32mConst {
+			t.Errorf("bech32Decode(%q) = constant %x, %v, want bech32m", s, constant, err)
+		}
+	}
+
+	// Invalid bech32m strings of BIP 350
+	invalid := []string{
+		"\x201xj0phk",
+		"\x7f1g6xzxy",
+		"\x801vctc34",
+		"an84characterslonghumanreadablepartthatcontainsthetheexcludedcharactersbioandnumber11d6pts4",
+		"qyrz8wqd2c9m",
+		"1qyrz8wqd2c9m",
+		"y1b0jsk6g",
+		"lt1igcx5c0",
+		"in1muywd",
+		"mm1crxm3i",
+		"au1s5cgom",
+		"M1VUXWEZ",
+		"16plkw9",
+		"1p2gdwpf",
+	}
+	for _, s := range invalid {
+		if _, _, _, err := bech32Decode(s); err == nil {
+			t.Errorf("bech32Decode(%q) accepted an invalid string", s)
+		}
+	}
+}
+
+func TestParseSegwitAddressBIP350(t *testing.T) {
+	// Valid segwit addresses of BIP 350 with their scriptPubKey
+	valid := []struct {
+		address, script string
+	}{
+		{"BC1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KV8F3T4", "0014751e76e8199196d454941c45d1b3a323f1433bd6"},
+		{"tb1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3q0sl5k7", "00201863143c14c5166804bd19203356da136c985678cd4d27a1b8c6329604903262"},
+		{"bc1pw508d6qejxtdg4y5r3zarvary0c5xw7kw508d6qejxtdg4y5r3zarvary0c5xw7kt5nd6y", "5128751e76e8199196d454941c45d1b3a323f1433bd6751e76e8199196d454941c45d1b3a323f1433bd6"},
+		{"BC1SW50QGDZ25J", "6002751e"},
+		{"bc1zw508d6qejxtdg4y5r3zarvaryvaxxpcs", "5210751e76e8199196d454941c45d1b3a323"},
+		{"tb1qqqqqp399et2xygdj5xreqhjjvcmzhxw4aywxecjdzew6hylgvsesrxh6hy", "0020000000c4a5cad46221b2a187905e5266362b99d5e91c6ce24d165dab93e86433"},
+		{"tb1pqqqqp399et2xygdj5xreqhjjvcmzhxw4aywxecjdzew6hylgvsesf3hn0c", "5120000000c4a5cad46221b2a187905e5266362b99d5e91c6ce24d165dab93e86433"},
+		{"bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqzk5jj0", "512079be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"},
+	}
+	for _, tt := range valid {
+		address, err := parseSegwitAddress(tt.address)
+		if err != nil {
+			t.Errorf("parseSegwitAddress(%s): %v", tt.address, err)
+			continue
+		}
+		// The scriptPubKey is OP_n followed by a push of the program
+		version := byte(0)
+		if address.WitnessVersion > 0 {
+			version = byte(0x50 + address.WitnessVersion)
+		}
+		script := append([]byte{version, byte(len(address.Program))}, address.Program...)
+		if got := hex.EncodeToString(script); got != tt.script {
+			t.Errorf("parseSegwitAddress(%s) script = %s, want %s", tt.address, got, tt.script)
+		}
+	}
+
+	// Invalid segwit addresses of BIP 350
+	invalid := []string{
+		"tc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vq5zuyut",
+		"bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqh2y7hd",
+		"tb1z0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqglt7rf",
+		"BC1S0XLXVLHEMJA6C4DQV22UAPCTQUPFHLXM9H8Z3K2E72Q4K9HCZ7VQ54WELL",
+		"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kemeawh",
+		"tb1q0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vq24jc47",
+		"bc1p38j9r5y49hruaue7wxjce0updqjuyyx0kh56v8s25huc6995vvpql3jow4",
+		"BC130XLXVLHEMJA6C4DQV22UAPCTQUPFHLXM9H8Z3K2E72Q4K9HCZ7VQ7ZWS8R",
+		"bc1pw5dgrnzv",
+		"bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7v8n0nx0muaewav253zgeav",
+		"BC1QR508D6QEJXTDG4Y5R3ZARVARYV98GJ9P",
+		"tb1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vq47Zagq",
+		"bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7v07qwwzcrf",
+		"tb1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vpggkg4j",
+		"bc1gmk9yu",
+	}
+	for _, s := range invalid {
+		if _, err := parseSegwitAddress(s); err == nil {
+			t.Errorf("parseSegwitAddress(%s) accepted an invalid address", s)
+		}
+	}
+}
+
+func TestEncodeSegwitAddressRoundTrip(t *testing.T) {
+	for _, s := range []string{
+		"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4",
+		"bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqzk5jj0",
+	} {
+		address, err := parseSegwitAddress(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := encodeSegwitAddress(address.WitnessVersion, address.Program); got != s {
+			t.Errorf("encodeSegwitAddress = %s, want %s", got, s)
+		}
+	}
+}
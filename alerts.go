@@ -0,0 +1,387 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Price alert set by a user in a chat. Alerts fire once and are then removed.
+type priceAlert struct {
+	ID        int64     `json:"id"`
+	ChatID    int64     `json:"chat_id"`
+	UserID    int64     `json:"user_id"`
+	Username  string    `json:"username"`
+	Direction string    `json:"direction"` // "above" or "below"
+	Threshold float64   `json:"threshold"`
+	Currency  string    `json:"currency,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Helper function to get the alert currency. Alerts created before multi-currency support are in USD.
+func (a priceAlert) currency() string {
+	if a.Currency == "" {
+		return "usd"
+	}
+	return a.Currency
+}
+
+// Function to check whether the alert condition holds at the given price
+func (a priceAlert) triggered(price float64) bool {
+	if a.Direction == "above" {
+		return price >= a.Threshold
+	}
+	return price <= a.Threshold
+}
+
+// Maximum number of price alerts per user, across all chats
+const maxAlertsPerUser = 20
+
+// Key in the meta bucket holding the next alert ID
+const metaNextAlertID = "next_alert_id"
+
+// Helper function to build the storage key of an alert, zero-padded so keys sort by ID
+func alertKey(id int64) string {
+	return fmt.Sprintf("%010d", id)
+}
+
+// alertRepository stores price alerts in the alerts bucket
+type alertRepository struct {
+	store *Store
+}
+
+// Global alert repository
+var alerts *alertRepository
+
+// Function to add a new alert, assigning it the next ID
+func (r *alertRepository) add(alert priceAlert) (priceAlert, error) {
+	err := r.store.Update(func(tx *storeTx) error {
+		var nextID int64 = 1
+		if _, err := tx.Get(bucketMeta, metaNextAlertID, &nextID); err != nil {
+			return err
+		}
+		alert.ID = nextID
+		if err := tx.Put(bucketMeta, metaNextAlertID, nextID+1); err != nil {
+			return err
+		}
+		return tx.Put(bucketAlerts, alertKey(alert.ID), alert)
+	})
+	return alert, err
+}
+
+// Function to call fn for every stored alert
+func forEachAlert(tx *storeTx, fn func(alert priceAlert) error) error {
+	return tx.ForEach(bucketAlerts, func(key string, raw json.RawMessage) error {
+		var alert priceAlert
+		if err := json.Unmarshal(raw, &alert); err != nil {
+			return fmt.Errorf("error decoding alert %s: %v", key, err)
+		}
+		return fn(alert)
+	})
+}
+
+// Function to list the alerts of a user in a chat
+func (r *alertRepository) list(chatID, userID int64) ([]priceAlert, error) {
+	var result []priceAlert
+	err := r.store.View(func(tx *storeTx) error {
+		return forEachAlert(tx, func(alert priceAlert) error {
+			if alert.ChatID == chatID && alert.UserID == userID {
+				result = append(result, alert)
+			}
+			return nil
+		})
+	})
+	return result, err
+}
+
+// Function to count the alerts of a user across all chats
+func (r *alertRepository) countUser(userID int64) (int, error) {
+	count := 0
+	err := r.store.View(func(tx *storeTx) error {
+		return forEachAlert(tx, func(alert priceAlert) error {
+			if alert.UserID == userID {
+				count++
+			}
+			return nil
+		})
+	})
+	return count, err
+}
+
+// Function to remove alerts of a user in a chat. An id of 0 removes all of them.
+// Returns the number of alerts removed.
+func (r *alertRepository) remove(chatID, userID, id int64) (int, error) {
+	removed := 0
+	err := r.store.Update(func(tx *storeTx) error {
+		return forEachAlert(tx, func(alert priceAlert) error {
+			if alert.ChatID == chatID && alert.UserID == userID && (id == 0 || alert.ID == id) {
+				tx.Delete(bucketAlerts, alertKey(alert.ID))
+				removed++
+			}
+			return nil
+		})
+	})
+	return removed, err
+}
+
+// Function to remove alerts of a chat, e.g. after the bot was removed from it
+func (r *alertRepository) removeChat(chatID int64) error {
+	return r.store.Update(func(tx *storeTx) error {
+		return forEachAlert(tx, func(alert priceAlert) error {
+			if alert.ChatID == chatID {
+				tx.Delete(bucketAlerts, alertKey(alert.ID))
+			}
+			return nil
+		})
+	})
+}
+
+// Function to list the currencies that have at least one alert
+func (r *alertRepository) currencies() ([]string, error) {
+	seen := make(map[string]bool)
+	var result []string
+	err := r.store.View(func(tx *storeTx) error {
+		return forEachAlert(tx, func(alert priceAlert) error {
+			if !seen[alert.currency()] {
+				seen[alert.currency()] = true
+				result = append(result, alert.currency())
+			}
+			return nil
+		})
+	})
+	return result, err
+}
+
+// Function to remove and return all alerts in a currency triggered at the given price
+func (r *alertRepository) takeTriggered(currency string, price float64) ([]priceAlert, error) {
+	var triggered []priceAlert
+	err := r.store.Update(func(tx *storeTx) error {
+		return forEachAlert(tx, func(alert priceAlert) error {
+			if alert.currency() == currency && alert.triggered(price) {
+				tx.Delete(bucketAlerts, alertKey(alert.ID))
+				triggered = append(triggered, alert)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return triggered, nil
+}
+
+// Helper function to parse a price such as 70000, 70,000 or 70k
+func parsePrice(text string) (float64, error) {
+	text = strings.ToLower(strings.TrimSpace(text))
+	text = strings.TrimPrefix(text, "$")
+	text = strings.ReplaceAll(text, ",", "")
+
+	multiplier := 1.0
+	if strings.HasSuffix(text, "k") {
+		multiplier = 1e3
+		text = strings.TrimSuffix(text, "k")
+	} else if strings.HasSuffix(text, "m") {
+		multiplier = 1e6
+		text = strings.TrimSuffix(text, "m")
+	}
+
+	value, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid price: %s", text)
+	}
+	// Check after the multiplier, which can push a large value to infinity
+	value *= multiplier
+	if math.IsNaN(value) || math.IsInf(value, 0) || value <= 0 {
+		return 0, fmt.Errorf("invalid price: %s", text)
+	}
+	return value, nil
+}
+
+// Helper function to name the user who set an alert
+func alertOwner(alert priceAlert) string {
+	if alert.Username != "" {
+		return "@" + alert.Username
+	}
+	return "You"
+}
+
+// Function to poll the price and notify chats whose alerts have triggered
+func runAlertEvaluator(ctx context.Context, interval time.Duration) {
+	log.Println("Starting price alert evaluator, polling every", interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			evaluateAlerts(ctx)
+		}
+	}
+}
+
+// Function to check all alerts against the current price once
+func evaluateAlerts(ctx context.Context) {
+	currencies, err := alerts.currencies()
+	if err != nil {
+		log.Println("Error loading alerts:", err)
+		return
+	}
+
+	for _, currency := range currencies {
+		price, _, err := getPrice(ctx, bitcoinID, currency)
+		if err != nil {
+			log.Printf("Error fetching BTC price in %s for alerts: %v", currency, err)
+			continue
+		}
+
+		triggered, err := alerts.takeTriggered(currency, price)
+		if err != nil {
+			log.Println("Error saving alerts:", err)
+			continue
+		}
+
+		for _, alert := range triggered {
+			message := fmt.Sprintf("🔔 %s: BTC is now %s %s\nCurrent price: %s",
+				alertOwner(alert), alert.Direction, formatNumber(alert.Threshold, currency), formatNumber(price, currency))
+			sendMessage(alert.ChatID, message)
+		}
+	}
+}
+
+// Handle /alert command
+func handleAlertCommand(ctx context.Context, update tgbotapi.Update) {
+	chatID := update.Message.Chat.ID
+
+	args := strings.Fields(update.Message.CommandArguments())
+	if len(args) < 2 || len(args) > 3 || (args[0] != "above" && args[0] != "below") {
+		sendMessage(chatID, "Usage: /alert above <price> [currency] or /alert below <price> [currency]")
+		return
+	}
+
+	threshold, err := parsePrice(args[1])
+	if err != nil {
+		sendMessage(chatID, "Invalid price. Example: /alert above 70000")
+		return
+	}
+
+	currency := chatCurrency(chatID)
+	if len(args) == 3 {
+		fiat, ok := lookupCurrency(args[2])
+		if !ok {
+			sendMessage(chatID, "Unsupported currency. Supported: "+supportedCurrencies())
+			return
+		}
+		currency = fiat.Code
+	}
+
+	count, err := alerts.countUser(update.Message.From.ID)
+	if err != nil {
+		log.Println("Error loading alerts:", err)
+		sendMessage(chatID, "Error loading alerts.")
+		return
+	}
+	if count >= maxAlertsPerUser {
+		sendMessage(chatID, fmt.Sprintf("You already have %d price alerts. Remove one with /unalert <id> first.", maxAlertsPerUser))
+		return
+	}
+
+	currentPrice, _, err := getPrice(ctx, bitcoinID, currency)
+	if err != nil {
+		log.Println("Error fetching BTC price:", err)
+		sendMessage(chatID, "Error fetching BTC price.")
+		return
+	}
+
+	alert := priceAlert{
+		ChatID:    chatID,
+		UserID:    update.Message.From.ID,
+		Username:  update.Message.From.UserName,
+		Direction: args[0],
+		Threshold: threshold,
+		Currency:  currency,
+		CreatedAt: time.Now(),
+	}
+
+	if alert.triggered(currentPrice) {
+		sendMessage(chatID, fmt.Sprintf("BTC is already %s %s (current price: %s).",
+			alert.Direction, formatNumber(threshold, currency), formatNumber(currentPrice, currency)))
+		return
+	}
+
+	alert, err = alerts.add(alert)
+	if err != nil {
+		log.Println("Error saving alert:", err)
+		sendMessage(chatID, "Error saving alert.")
+		return
+	}
+
+	sendMessage(chatID, fmt.Sprintf("Alert #%d set: BTC %s %s (current price: %s)",
+		alert.ID, alert.Direction, formatNumber(threshold, currency), formatNumber(currentPrice, currency)))
+}
+
+// Handle /alerts command
+func handleAlertsCommand(ctx context.Context, update tgbotapi.Update) {
+	chatID := update.Message.Chat.ID
+
+	userAlerts, err := alerts.list(chatID, update.Message.From.ID)
+	if err != nil {
+		log.Println("Error loading alerts:", err)
+		sendMessage(chatID, "Error loading alerts.")
+		return
+	}
+
+	if len(userAlerts) == 0 {
+		sendMessage(chatID, "You have no price alerts. Set one with /alert above <price>")
+		return
+	}
+
+	sort.Slice(userAlerts, func(i, j int) bool {
+		return userAlerts[i].Threshold < userAlerts[j].Threshold
+	})
+
+	message := "Your price alerts:\n"
+	for _, alert := range userAlerts {
+		message += fmt.Sprintf("#%d: BTC %s %s\n", alert.ID, alert.Direction, formatNumber(alert.Threshold, alert.currency()))
+	}
+	message += "\nRemove one with /unalert <id> or all with /unalert all"
+	sendMessage(chatID, message)
+}
+
+// Handle /unalert command
+func handleUnalertCommand(ctx context.Context, update tgbotapi.Update) {
+	chatID := update.Message.Chat.ID
+
+	arg := strings.TrimPrefix(strings.TrimSpace(update.Message.CommandArguments()), "#")
+	var id int64
+	if arg != "all" {
+		var err error
+		id, err = strconv.ParseInt(arg, 10, 64)
+		if err != nil || id <= 0 {
+			sendMessage(chatID, "Usage: /unalert <id> or /unalert all")
+			return
+		}
+	}
+
+	removed, err := alerts.remove(chatID, update.Message.From.ID, id)
+	if err != nil {
+		log.Println("Error saving alerts:", err)
+		sendMessage(chatID, "Error removing alert.")
+		return
+	}
+
+	if removed == 0 {
+		sendMessage(chatID, "No matching alert found.")
+		return
+	}
+	sendMessage(chatID, fmt.Sprintf("Removed %d alert(s).", removed))
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestParsePrice(t *testing.T) {
+	tests := []struct {
+		text    string
+		want    float64
+		wantErr bool
+	}{
+		{"70000", 70000, false},
+		{"70,000", 70000, false},
+		{"$70,000.50", 70000.5, false},
+		{"70k", 70000, false},
+		{" 65.5K ", 65500, false},
+		{"1.2m", 1200000, false},
+		{"0.00001", 0.00001, false},
+		{"", 0, true},
+		{"k", 0, true},
+		{"0", 0, true},
+		{"-5", 0, true},
+		{"70kk", 0, true},
+		{"seventy", 0, true},
+		{"NaN", 0, true},
+		{"inf", 0, true},
+		{"1e308k", 0, true},
+		{"1e303m", 0, true},
+		{"1e302m", 1e308, false},
+	}
+	for _, tt := range tests {
+		got, err := parsePrice(tt.text)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parsePrice(%q) error = %v, wantErr %v", tt.text, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parsePrice(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestAlertCountUser(t *testing.T) {
+	repo := &alertRepository{store: openTestStore(t, filepath.Join(t.TempDir(), "btcbot.db"))}
+
+	// Alerts count towards the user's limit in every chat
+	for _, alert := range []priceAlert{
+		{ChatID: 1, UserID: 7, Direction: "above", Threshold: 100000},
+		{ChatID: 2, UserID: 7, Direction: "below", Threshold: 50000},
+		{ChatID: 1, UserID: 8, Direction: "above", Threshold: 90000},
+	} {
+		if _, err := repo.add(alert); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if count, err := repo.countUser(7); err != nil || count != 2 {
+		t.Errorf("countUser(7) = %d, %v, want 2", count, err)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Largest backup file accepted by /restore
+const maxBackupSize = 20 << 20
+
+// Helper function to check whether a user may run admin commands
+func isAdmin(userID int64) bool {
+	for _, id := range cfg.AdminUserIDs {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// Handle /backup command. The router only runs it in an admin's private chat.
+func handleBackupCommand(ctx context.Context, update tgbotapi.Update) {
+	chatID := update.Message.Chat.ID
+
+	var buf bytes.Buffer
+	if err := store.Backup(&buf); err != nil {
+		log.Println("Error creating backup:", err)
+		sendMessage(chatID, "Error creating backup.")
+		return
+	}
+
+	document := tgbotapi.NewDocument(chatID, tgbotapi.FileBytes{
+		Name:  fmt.Sprintf("btcbot-backup-%s.json", time.Now().UTC().Format("20060102-150405")),
+		Bytes: buf.Bytes(),
+	})
+	document.Caption = "Storage backup. Reply to this file with /restore to restore it."
+
+	_, err := bot.Send(document)
+	if err != nil {
+		log.Println("Error sending backup:", err)
+		sendMessage(chatID, "Error sending backup.")
+	}
+}
+
+// Handle /restore command, sent as a reply to a backup file. The router only
+// runs it in an admin's private chat.
+func handleRestoreCommand(ctx context.Context, update tgbotapi.Update) {
+	chatID := update.Message.Chat.ID
+
+	reply := update.Message.ReplyToMessage
+	if reply == nil || reply.Document == nil {
+		sendMessage(chatID, "Reply to a backup file with /restore to restore it.")
+		return
+	}
+	if reply.Document.FileSize > maxBackupSize {
+		sendMessage(chatID, "Backup file is too large.")
+		return
+	}
+
+	fileURL, err := bot.GetFileDirectURL(reply.Document.FileID)
+	if err != nil {
+		log.Println("Error getting backup file URL:", err)
+		sendMessage(chatID, "Error downloading backup file.")
+		return
+	}
+
+	response, err := httpGet(ctx, fileURL)
+	if err != nil {
+		log.Println("Error downloading backup file:", err)
+		sendMessage(chatID, "Error downloading backup file.")
+		return
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		log.Println("Error downloading backup file: non-200 status code", response.StatusCode)
+		sendMessage(chatID, "Error downloading backup file.")
+		return
+	}
+
+	// Read one byte past the limit to tell a file of exactly the limit from a larger one
+	data, err := io.ReadAll(io.LimitReader(response.Body, maxBackupSize+1))
+	if err != nil {
+		log.Println("Error downloading backup file:", err)
+		sendMessage(chatID, "Error downloading backup file.")
+		return
+	}
+	if len(data) > maxBackupSize {
+		sendMessage(chatID, "Backup file is too large.")
+		return
+	}
+
+	// Keep a copy of the current data in case the restore was a mistake
+	var current bytes.Buffer
+	if err := store.Backup(&current); err != nil {
+		log.Println("Error creating pre-restore backup:", err)
+		sendMessage(chatID, "Error creating pre-restore backup, restore aborted.")
+		return
+	}
+	safetyPath := fmt.Sprintf("%s.pre-restore-%s.json", store.path, time.Now().UTC().Format("20060102-150405"))
+	if err := os.WriteFile(safetyPath, current.Bytes(), 0o600); err != nil {
+		log.Println("Error writing pre-restore backup:", err)
+		sendMessage(chatID, "Error creating pre-restore backup, restore aborted.")
+		return
+	}
+
+	if err := store.Restore(bytes.NewReader(data)); err != nil {
+		log.Println("Error restoring backup:", err)
+		sendMessage(chatID, fmt.Sprintf("Error restoring backup: %v", err))
+		return
+	}
+
+	log.Println("Restored storage from backup, previous data saved to", safetyPath)
+	sendMessage(chatID, "Backup restored.")
+}
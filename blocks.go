@@ -0,0 +1,588 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"golang.org/x/net/websocket"
+)
+
+// Chat preference that is "on" when the chat gets new block announcements
+const preferenceBlocks = "blocks"
+
+// Key in the meta bucket holding the height of the last announced block
+const metaLastAnnouncedBlock = "last_announced_block"
+
+// Largest number of missed blocks announced one by one after a disconnect.
+// Longer gaps are announced in a single summary message.
+const maxBlockBackfill = 12
+
+// Longest gap whose blocks are fetched for the summary of missed blocks
+const maxBlockSummaryRange = 1008
+
+// How long connecting to the block feed may take
+const blockFeedDialTimeout = 30 * time.Second
+
+// The feed is considered dead when nothing, not even a pong, arrives for this long
+const blockFeedTimeout = 2 * time.Minute
+
+// How often the feed is pinged to keep the connection alive
+const blockFeedPingInterval = 30 * time.Second
+
+// Longest wait between reconnection attempts
+const maxBlockFeedBackoff = 5 * time.Minute
+
+// Mining pool a block is attributed to
+type mempoolPool struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+}
+
+// Block as returned by the mempool API and websocket, with mempool's extra statistics
+type mempoolBlock struct {
+	ID                string  `json:"id"`
+	Height            int64   `json:"height"`
+	Timestamp         int64   `json:"timestamp"`
+	TxCount           int64   `json:"tx_count"`
+	Size              int64   `json:"size"`
+	Weight            int64   `json:"weight"`
+	Difficulty        float64 `json:"difficulty"`
+	PreviousBlockHash string  `json:"previousblockhash"`
+	Extras            struct {
+		TotalFees   int64       `json:"totalFees"`
+		MedianFee   float64     `json:"medianFee"`
+		FeeRange    []float64   `json:"feeRange"`
+		Reward      int64       `json:"reward"`
+		Pool        mempoolPool `json:"pool"`
+		CoinbaseRaw string      `json:"coinbaseRaw"`
+	} `json:"extras"`
+}
+
+// Function to fetch a block with its statistics by hash
+func getBlock(ctx context.Context, hash string) (mempoolBlock, error) {
+	var block mempoolBlock
+	if err := fetchJSON(ctx, fmt.Sprintf("%s/v1/block/%s", cfg.MempoolURL, strings.ToLower(hash)), &block); err != nil {
+		return mempoolBlock{}, fmt.Errorf("error fetching block: %w", err)
+	}
+	return block, nil
+}
+
+// Function to fetch the hash of the block at a height
+func getBlockHash(ctx context.Context, height int64) (string, error) {
+	response, err := httpGet(ctx, fmt.Sprintf("%s/block-height/%d", cfg.MempoolURL, height))
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("error fetching block hash: %w", &statusError{StatusCode: response.StatusCode})
+	}
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+// Function to fetch the block at a height
+func getBlockAtHeight(ctx context.Context, height int64) (mempoolBlock, error) {
+	hash, err := getBlockHash(ctx, height)
+	if err != nil {
+		return mempoolBlock{}, err
+	}
+	return getBlock(ctx, hash)
+}
+
+// Function to fetch the blocks in (from, to], oldest first. The API returns a
+// page of up to 15 blocks at a time, counting down from a height.
+func getBlockRange(ctx context.Context, from, to int64) ([]mempoolBlock, error) {
+	var blocks []mempoolBlock
+	for height := to; height > from; {
+		var page []mempoolBlock
+		if err := fetchJSON(ctx, fmt.Sprintf("%s/v1/blocks/%d", cfg.MempoolURL, height), &page); err != nil {
+			return nil, fmt.Errorf("error fetching blocks: %w", err)
+		}
+		next := height
+		for _, block := range page {
+			if block.Height > from && block.Height <= height {
+				blocks = append(blocks, block)
+			}
+			next = min(next, block.Height-1)
+		}
+		if next == height {
+			return nil, fmt.Errorf("error fetching blocks: no blocks below height %d", height+1)
+		}
+		height = next
+	}
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i].Height < blocks[j].Height })
+	return blocks, nil
+}
+
+// Coinbase tags of well-known pools, used when the API does not attribute a block
+var coinbasePoolTags = []struct {
+	tag, name string
+}{
+	{"Foundry USA", "Foundry USA"},
+	{"AntPool", "AntPool"},
+	{"F2Pool", "F2Pool"},
+	{"ViaBTC", "ViaBTC"},
+	{"binance", "Binance Pool"},
+	{"MARA Pool", "MARA Pool"},
+	{"SpiderPool", "SpiderPool"},
+	{"/slush/", "Braiins Pool"},
+	{"Luxor", "Luxor"},
+	{"SBICrypto", "SBI Crypto"},
+	{"poolin", "Poolin"},
+	{"BTC.com", "BTC.com"},
+	{"Ocean", "OCEAN"},
+	{"SecPool", "SECPOOL"},
+	{"Bitfufu", "BitFuFuPool"},
+}
+
+// Function to extract the printable text runs of at least four characters
+// from the coinbase script of a block, where pools leave their tags
+func (b mempoolBlock) coinbaseTags() []string {
+	raw, err := hex.DecodeString(b.Extras.CoinbaseRaw)
+	if err != nil {
+		return nil
+	}
+	var tags []string
+	start := -1
+	for i := 0; i <= len(raw); i++ {
+		if i < len(raw) && raw[i] >= 0x20 && raw[i] < 0x7f {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 && i-start >= 4 {
+			tags = append(tags, string(raw[start:i]))
+		}
+		start = -1
+	}
+	return tags
+}
+
+// Function to fetch the block at a height through the cache
+func cachedBlockAtHeight(ctx context.Context, height int64) (mempoolBlock, time.Time, error) {
+	hash, _, err := cached(ctx, fmt.Sprintf("block:height:%d", height), func(ctx context.Context) (string, error) {
+		return getBlockHash(ctx, height)
+	})
+	if err != nil {
+		return mempoolBlock{}, time.Time{}, err
+	}
+	return cached(ctx, "block:"+hash, func(ctx context.Context) (mempoolBlock, error) {
+		return getBlock(ctx, hash)
+	})
+}
+
+// Function to measure the average time between the last count blocks up to the tip
+func averageBlockInterval(ctx context.Context, tipHeight, count int64) (time.Duration, error) {
+	tip, _, err := cachedBlockAtHeight(ctx, tipHeight)
+	if err != nil {
+		return 0, err
+	}
+	first, _, err := cachedBlockAtHeight(ctx, tipHeight-count)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(tip.Timestamp-first.Timestamp) * time.Second / time.Duration(count), nil
+}
+
+// Helper function to name the pool that mined a block, from the API
+// attribution or else from the coinbase tags
+func (b mempoolBlock) poolName() string {
+	if b.Extras.Pool.Name != "" && b.Extras.Pool.Slug != "unknown" {
+		return b.Extras.Pool.Name
+	}
+	tags := b.coinbaseTags()
+	for _, pool := range coinbasePoolTags {
+		for _, tag := range tags {
+			if strings.Contains(strings.ToLower(tag), strings.ToLower(pool.tag)) {
+				return pool.name
+			}
+		}
+	}
+	if len(tags) > 0 {
+		return fmt.Sprintf("Unknown (coinbase tag %q)", strings.Join(tags, " "))
+	}
+	return "Unknown"
+}
+
+// Number of blocks between halvings of the block subsidy
+const halvingInterval = 210_000
+
+// Time the difficulty adjustment aims for between blocks
+const targetBlockInterval = 10 * time.Minute
+
+// Function to get the block subsidy in sats at a height
+func blockSubsidy(height int64) int64 {
+	halvings := height / halvingInterval
+	if halvings >= 64 {
+		return 0
+	}
+	return 50 * satsPerBTC >> halvings
+}
+
+// Helper function to format a duration coarsely, e.g. 9m 12s, 3h 5m or 12d 4h
+func formatDuration(d time.Duration) string {
+	if d < 0 {
+		d = -d
+	}
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm %ds", int(d.Minutes()), int(d.Seconds())%60)
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh %dm", int(d.Hours()), int(d.Minutes())%60)
+	default:
+		return fmt.Sprintf("%dd %dh", int(d.Hours())/24, int(d.Hours())%24)
+	}
+}
+
+// Maximum block weight in weight units
+const maxBlockWeight = 4_000_000
+
+// Function to describe a block in detail for /block. previous is nil for the genesis block.
+func formatBlockDetails(block mempoolBlock, previous *mempoolBlock) string {
+	blockTime := time.Unix(block.Timestamp, 0).UTC()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Block %d\n", block.Height)
+	fmt.Fprintf(&b, "Hash: %s\n", block.ID)
+	fmt.Fprintf(&b, "Time: %s UTC", blockTime.Format("2006-01-02 15:04:05"))
+	if previous != nil {
+		interval := blockTime.Sub(time.Unix(previous.Timestamp, 0))
+		if interval < 0 {
+			// Block timestamps are only loosely ordered
+			fmt.Fprintf(&b, " (%s before the previous block)", formatDuration(interval))
+		} else {
+			fmt.Fprintf(&b, " (%s after the previous block)", formatDuration(interval))
+		}
+	}
+	b.WriteString("\n")
+	fmt.Fprintf(&b, "Transactions: %d\n", block.TxCount)
+	fmt.Fprintf(&b, "Weight: %.2f MWU (%.1f%% full)\n", float64(block.Weight)/1_000_000, float64(block.Weight)/maxBlockWeight*100)
+	fmt.Fprintf(&b, "Size: %.2f MB\n", float64(block.Size)/1_000_000)
+
+	subsidy := blockSubsidy(block.Height)
+	fmt.Fprintf(&b, "Subsidy: %s\n", formatBTC(subsidy))
+	fmt.Fprintf(&b, "Fees: %s", formatBTC(block.Extras.TotalFees))
+	if reward := subsidy + block.Extras.TotalFees; reward > 0 {
+		fmt.Fprintf(&b, " (%.1f%% of the reward)", float64(block.Extras.TotalFees)/float64(reward)*100)
+	}
+	b.WriteString("\n")
+	if feeRange := block.Extras.FeeRange; len(feeRange) > 0 {
+		fmt.Fprintf(&b, "Fee range: %.1f–%.1f sat/vB (median %.1f)\n", feeRange[0], feeRange[len(feeRange)-1], block.Extras.MedianFee)
+	}
+	fmt.Fprintf(&b, "Mined by: %s\n", block.poolName())
+	fmt.Fprintf(&b, "%s/block/%s", cfg.ExplorerURL, block.ID)
+	return b.String()
+}
+
+// Function to build the announcement of a new block
+func formatBlockAnnouncement(block mempoolBlock) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "⛏ New block %d\n", block.Height)
+	fmt.Fprintf(&b, "Time: %s UTC\n", time.Unix(block.Timestamp, 0).UTC().Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(&b, "Transactions: %d\n", block.TxCount)
+	fmt.Fprintf(&b, "Size: %.2f MB\n", float64(block.Size)/1_000_000)
+	fmt.Fprintf(&b, "Total fees: %s\n", formatBTC(block.Extras.TotalFees))
+	fmt.Fprintf(&b, "Median fee rate: %.1f sat/vB\n", block.Extras.MedianFee)
+	fmt.Fprintf(&b, "Mined by: %s", block.poolName())
+	return b.String()
+}
+
+// Function to read the height of the last announced block, 0 if none was announced yet
+func lastAnnouncedBlock() (int64, error) {
+	var height int64
+	err := store.View(func(tx *storeTx) error {
+		_, err := tx.Get(bucketMeta, metaLastAnnouncedBlock, &height)
+		return err
+	})
+	return height, err
+}
+
+// Function to record the height of the last announced block
+func setLastAnnouncedBlock(height int64) error {
+	return store.Update(func(tx *storeTx) error {
+		return tx.Put(bucketMeta, metaLastAnnouncedBlock, height)
+	})
+}
+
+// Function to summarise the missed blocks from..to in one message, for gaps
+// too long to announce block by block. blocks is nil when the gap was too long
+// to fetch.
+func formatMissedBlocksSummary(from, to int64, blocks []mempoolBlock) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "⏪ %d blocks (%d–%d) were mined while the block feed was disconnected", to-from+1, from, to)
+	if len(blocks) == 0 {
+		return b.String()
+	}
+
+	var txCount, fees int64
+	pools := make(map[string]int)
+	for _, block := range blocks {
+		txCount += block.TxCount
+		fees += block.Extras.TotalFees
+		pools[block.poolName()]++
+	}
+	names := make([]string, 0, len(pools))
+	for name := range pools {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if pools[names[i]] != pools[names[j]] {
+			return pools[names[i]] > pools[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	mined := make([]string, len(names))
+	for i, name := range names {
+		mined[i] = fmt.Sprintf("%s %d", name, pools[name])
+	}
+
+	fmt.Fprintf(&b, "\nTransactions: %d\n", txCount)
+	fmt.Fprintf(&b, "Fees: %s\n", formatBTC(fees))
+	fmt.Fprintf(&b, "Mined by: %s", strings.Join(mined, ", "))
+	return b.String()
+}
+
+// Function to send a message to every chat that turned on block announcements
+func announceToBlockSubscribers(message string) {
+	chatIDs, err := chats.withPreference(preferenceBlocks, "on")
+	if err != nil {
+		log.Println("Error loading block subscribers:", err)
+		return
+	}
+	for _, chatID := range chatIDs {
+		sendMessage(chatID, message)
+	}
+}
+
+// Channels told about each new block from the feed, see newBlockListener
+var (
+	blockListenersMu sync.Mutex
+	blockListeners   []chan int64
+)
+
+// Function to get a channel receiving the height of new blocks from the feed.
+// Heights are dropped while the listener is busy, so it only sees the latest.
+func newBlockListener() <-chan int64 {
+	blockListenersMu.Lock()
+	defer blockListenersMu.Unlock()
+	ch := make(chan int64, 1)
+	blockListeners = append(blockListeners, ch)
+	return ch
+}
+
+// Function to tell the block listeners about a new block
+func notifyBlockListeners(height int64) {
+	blockListenersMu.Lock()
+	defer blockListenersMu.Unlock()
+	for _, ch := range blockListeners {
+		select {
+		case ch <- height:
+		default:
+		}
+	}
+}
+
+// Function to announce the blocks received from the feed, fetching any blocks
+// between the last announced one and them that were missed
+func processFeedBlocks(ctx context.Context, blocks []mempoolBlock) error {
+	if len(blocks) == 0 {
+		return nil
+	}
+
+	byHeight := make(map[int64]mempoolBlock)
+	for _, block := range blocks {
+		byHeight[block.Height] = block
+	}
+	heights := make([]int64, 0, len(byHeight))
+	for height := range byHeight {
+		heights = append(heights, height)
+	}
+	sort.Slice(heights, func(i, j int) bool { return heights[i] < heights[j] })
+	tip := heights[len(heights)-1]
+
+	last, err := lastAnnouncedBlock()
+	if err != nil {
+		return err
+	}
+	// On the very first run there is nothing to catch up on
+	if last == 0 {
+		return setLastAnnouncedBlock(tip)
+	}
+	if tip <= last {
+		return nil
+	}
+	defer notifyBlockListeners(tip)
+
+	// A long gap is summarised in one message, and only the newest block is
+	// announced on its own
+	from := last
+	if tip-last > maxBlockBackfill {
+		from = tip - 1
+		var missed []mempoolBlock
+		if from-last <= maxBlockSummaryRange {
+			if missed, err = getBlockRange(ctx, last, from); err != nil {
+				return err
+			}
+		}
+		announceToBlockSubscribers(formatMissedBlocksSummary(last+1, from, missed))
+		if err := setLastAnnouncedBlock(from); err != nil {
+			return err
+		}
+	}
+
+	for height := from + 1; height <= tip; height++ {
+		block, ok := byHeight[height]
+		if !ok {
+			if block, err = getBlockAtHeight(ctx, height); err != nil {
+				return err
+			}
+		}
+		announceToBlockSubscribers(formatBlockAnnouncement(block))
+		if err := setLastAnnouncedBlock(height); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Message received from the mempool websocket. Only block data is requested;
+// the first message carries the latest blocks, later ones a single new block.
+type blockFeedMessage struct {
+	Block  *mempoolBlock  `json:"block"`
+	Blocks []mempoolBlock `json:"blocks"`
+}
+
+// Function to keep the block feed connected, reconnecting with a growing delay
+func runBlockFeed(ctx context.Context) {
+	log.Println("Starting block feed:", cfg.MempoolWebSocketURL)
+	backoff := time.Second
+	for {
+		connected, err := consumeBlockFeed(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Println("Block feed disconnected:", err)
+		if connected {
+			backoff = time.Second
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxBlockFeedBackoff)
+	}
+}
+
+// Function to consume the block feed until the connection fails. Returns
+// whether the connection was established.
+func consumeBlockFeed(ctx context.Context) (bool, error) {
+	origin := strings.Replace(cfg.MempoolWebSocketURL, "ws", "http", 1)
+	config, err := websocket.NewConfig(cfg.MempoolWebSocketURL, origin)
+	if err != nil {
+		return false, err
+	}
+	dialCtx, cancel := context.WithTimeout(ctx, blockFeedDialTimeout)
+	conn, err := config.DialContext(dialCtx)
+	cancel()
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	if err := websocket.JSON.Send(conn, map[string]interface{}{"action": "want", "data": []string{"blocks"}}); err != nil {
+		return true, err
+	}
+
+	// The pinger stops when the read loop returns, and closes the connection
+	// when the context is cancelled so the read loop returns
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(blockFeedPingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				conn.Close()
+				return
+			case <-ticker.C:
+				if err := websocket.JSON.Send(conn, map[string]string{"action": "ping"}); err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(blockFeedTimeout))
+		var message blockFeedMessage
+		if err := websocket.JSON.Receive(conn, &message); err != nil {
+			return true, err
+		}
+
+		blocks := message.Blocks
+		if message.Block != nil {
+			blocks = append(blocks, *message.Block)
+		}
+		if err := processFeedBlocks(ctx, blocks); err != nil {
+			// Missed blocks are picked up with the next message
+			log.Println("Error announcing blocks:", err)
+		}
+	}
+}
+
+// Handle /blocks command
+func handleBlocksCommand(ctx context.Context, update tgbotapi.Update) {
+	chatID := update.Message.Chat.ID
+
+	switch arg := strings.ToLower(strings.TrimSpace(update.Message.CommandArguments())); arg {
+	case "on", "off":
+		value := ""
+		if arg == "on" {
+			value = "on"
+		}
+		if err := chats.setPreference(chatID, preferenceBlocks, value); err != nil {
+			log.Println("Error saving chat preference:", err)
+			sendMessage(chatID, "Error saving block announcements setting.")
+			return
+		}
+		if arg == "on" {
+			sendMessage(chatID, "New blocks will be announced in this chat. Turn this off with /blocks off")
+		} else {
+			sendMessage(chatID, "New blocks will no longer be announced in this chat.")
+		}
+	case "":
+		value, err := chats.preference(chatID, preferenceBlocks)
+		if err != nil {
+			log.Println("Error loading chat preference:", err)
+		}
+		status := "off"
+		if value == "on" {
+			status = "on"
+		}
+		sendMessage(chatID, "Block announcements are "+status+" in this chat. Usage: /blocks on|off")
+	default:
+		sendMessage(chatID, "Usage: /blocks on|off")
+	}
+}
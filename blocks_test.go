@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Function to serve /v1/blocks/:height like the mempool API, 15 blocks per
+// page counting down, for blocks up to tip
+func newBlocksServer(t *testing.T, tip int64) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		height, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/v1/blocks/"), 10, 64)
+		if err != nil || height > tip {
+			http.NotFound(w, r)
+			return
+		}
+		var page []mempoolBlock
+		for h := height; h > height-15 && h >= 0; h-- {
+			block := mempoolBlock{Height: h, TxCount: 100}
+			block.Extras.TotalFees = 1000
+			block.Extras.Pool.Name = "Pool " + strconv.FormatInt(h%2, 10)
+			page = append(page, block)
+		}
+		json.NewEncoder(w).Encode(page)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestGetBlockRangePagesThroughGap(t *testing.T) {
+	server := newBlocksServer(t, 900_050)
+	cfg = defaultConfig()
+	cfg.MempoolURL = server.URL
+
+	blocks, err := getBlockRange(context.Background(), 900_000, 900_040)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 40 {
+		t.Fatalf("got %d blocks, want 40", len(blocks))
+	}
+	for i, block := range blocks {
+		if want := int64(900_001 + i); block.Height != want {
+			t.Fatalf("block %d has height %d, want %d", i, block.Height, want)
+		}
+	}
+}
+
+func TestGetBlockRangeFailsOnMissingBlocks(t *testing.T) {
+	server := newBlocksServer(t, 10)
+	cfg = defaultConfig()
+	cfg.MempoolURL = server.URL
+
+	if _, err := getBlockRange(context.Background(), 5, 20); err == nil {
+		t.Error("getBlockRange succeeded beyond the tip")
+	}
+}
+
+func TestFormatMissedBlocksSummary(t *testing.T) {
+	cfg = defaultConfig()
+	blocks := []mempoolBlock{{Height: 10, TxCount: 5}, {Height: 11, TxCount: 7}, {Height: 12, TxCount: 1}}
+	blocks[0].Extras.Pool.Name = "AntPool"
+	blocks[1].Extras.Pool.Name = "Foundry USA"
+	blocks[2].Extras.Pool.Name = "Foundry USA"
+	blocks[0].Extras.TotalFees = 50_000_000
+	blocks[1].Extras.TotalFees = 50_000_000
+
+	tests := []struct {
+		name   string
+		blocks []mempoolBlock
+		want   []string
+	}{
+		{"with blocks", blocks, []string{"3 blocks (10–12)", "Transactions: 13", "Fees: 1.00000000 BTC", "Mined by: Foundry USA 2, AntPool 1"}},
+		{"without blocks", nil, []string{"3 blocks (10–12)"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := formatMissedBlocksSummary(10, 12, tt.blocks)
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("summary %q does not contain %q", got, want)
+				}
+			}
+			if tt.blocks == nil && strings.Contains(got, "Transactions") {
+				t.Errorf("summary %q has totals without blocks", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default time-to-live for each upstream data source. Cache keys are
+// "<source>" or "<source>:<args>" and take the TTL of their source.
+var cacheTTLs = map[string]time.Duration{
+	"price":           30 * time.Second,
+	"marketcap":       time.Minute,
+	"volume":          time.Minute,
+	"ath":             time.Hour,
+	"history":         10 * time.Minute,
+	"candles":         5 * time.Minute,
+	"block":           30 * time.Second,
+	"tx":              30 * time.Second,
+	"address":         30 * time.Second,
+	"fees":            30 * time.Second,
+	"hashrate":        10 * time.Minute,
+	"feargreed":       time.Hour,
+	"feargreed_image": time.Hour,
+	"assets":          time.Hour,
+	"coinlist":        24 * time.Hour,
+	"coin":            24 * time.Hour,
+}
+
+// Fallback TTL for sources without an explicit entry
+const defaultCacheTTL = time.Minute
+
+// cacheEntry is a successfully fetched value and the time it was fetched
+type cacheEntry struct {
+	value     interface{}
+	fetchedAt time.Time
+}
+
+// cacheCall is an upstream fetch in progress that concurrent callers wait on
+type cacheCall struct {
+	done  chan struct{}
+	entry cacheEntry
+	err   error
+}
+
+// ttlCache caches upstream responses per key and coalesces concurrent fetches
+// of the same key into a single upstream call
+type ttlCache struct {
+	mu        sync.Mutex
+	entries   map[string]cacheEntry
+	calls     map[string]*cacheCall
+	lastPrune time.Time
+}
+
+// Global cache shared by all fetchers
+var upstreamCache = &ttlCache{
+	entries: make(map[string]cacheEntry),
+	calls:   make(map[string]*cacheCall),
+}
+
+// Function to override the default TTLs with values from the config
+func configureCacheTTLs(overrides map[string]string) error {
+	for source, value := range overrides {
+		ttl, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid cache TTL for %s: %v", source, err)
+		}
+		cacheTTLs[source] = ttl
+	}
+	return nil
+}
+
+// Helper function to look up the TTL for a cache key
+func cacheTTL(key string) time.Duration {
+	source, _, _ := strings.Cut(key, ":")
+	if ttl, ok := cacheTTLs[source]; ok {
+		return ttl
+	}
+	return defaultCacheTTL
+}
+
+// Longest time a shared upstream fetch may take
+const cacheFetchTimeout = 30 * time.Second
+
+// Number of cached entries above which expired entries are dropped, and then
+// the oldest ones. Keys come from user input, so the cache must not grow unbounded.
+const maxCacheEntries = 10000
+
+// How often expired entries are dropped while the cache is below its limit
+const cachePruneInterval = time.Minute
+
+// Function to return the cached value for key, calling fetch if it is missing or expired.
+// Concurrent callers for the same key share one fetch. Errors are not cached.
+// The fetch runs detached from ctx, so a caller giving up does not fail the
+// others; the caller just stops waiting for it.
+func (c *ttlCache) get(ctx context.Context, key string, fetch func(ctx context.Context) (interface{}, error)) (interface{}, time.Time, error) {
+	c.mu.Lock()
+	if entry, ok := c.entries[key]; ok && time.Since(entry.fetchedAt) < cacheTTL(key) {
+		c.mu.Unlock()
+		return entry.value, entry.fetchedAt, nil
+	}
+
+	call, ok := c.calls[key]
+	if !ok {
+		call = &cacheCall{done: make(chan struct{})}
+		c.calls[key] = call
+		go c.fetch(context.WithoutCancel(ctx), key, call, fetch)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.entry.value, call.entry.fetchedAt, call.err
+	case <-ctx.Done():
+		return nil, time.Time{}, ctx.Err()
+	}
+}
+
+// Function to run a shared fetch and hand its result to the waiting callers.
+// A panicking fetch is reported to them as an error.
+func (c *ttlCache) fetch(ctx context.Context, key string, call *cacheCall, fetch func(ctx context.Context) (interface{}, error)) {
+	ctx, cancel := context.WithTimeout(ctx, cacheFetchTimeout)
+	defer cancel()
+
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Panic fetching %s: %v\n%s", key, r, debug.Stack())
+			call.err = fmt.Errorf("error fetching %s: %v", key, r)
+		}
+
+		c.mu.Lock()
+		if call.err == nil {
+			c.put(key, call.entry)
+		} else {
+			log.Printf("Upstream fetch for %s failed: %v", key, call.err)
+		}
+		delete(c.calls, key)
+		c.mu.Unlock()
+		close(call.done)
+	}()
+
+	value, err := fetch(ctx)
+	call.entry = cacheEntry{value: value, fetchedAt: time.Now()}
+	call.err = err
+}
+
+// Function to store an entry, pruning the cache first when due or full. The caller must hold c.mu.
+func (c *ttlCache) put(key string, entry cacheEntry) {
+	now := time.Now()
+	if len(c.entries) >= maxCacheEntries || now.Sub(c.lastPrune) >= cachePruneInterval {
+		c.lastPrune = now
+		for k, e := range c.entries {
+			if now.Sub(e.fetchedAt) >= cacheTTL(k) {
+				delete(c.entries, k)
+			}
+		}
+	}
+
+	// Every entry is still fresh, so make room by dropping the oldest
+	for len(c.entries) >= maxCacheEntries {
+		var oldestKey string
+		var oldest time.Time
+		for k, e := range c.entries {
+			if oldestKey == "" || e.fetchedAt.Before(oldest) {
+				oldestKey, oldest = k, e.fetchedAt
+			}
+		}
+		delete(c.entries, oldestKey)
+	}
+
+	c.entries[key] = entry
+}
+
+// Function to fetch a value through the shared cache, returning it with the time it was fetched
+func cached[T any](ctx context.Context, key string, fetch func(ctx context.Context) (T, error)) (T, time.Time, error) {
+	value, fetchedAt, err := upstreamCache.get(ctx, key, func(ctx context.Context) (interface{}, error) {
+		return fetch(ctx)
+	})
+	if err != nil {
+		var zero T
+		return zero, fetchedAt, err
+	}
+	return value.(T), fetchedAt, nil
+}
+
+// Helper function to tell the user how old a cached value is.
+// Returns an empty string for data that was just fetched.
+func dataAsOf(fetchedAt ...time.Time) string {
+	oldest := time.Now()
+	for _, t := range fetchedAt {
+		if t.Before(oldest) {
+			oldest = t
+		}
+	}
+	if time.Since(oldest) < time.Second {
+		return ""
+	}
+	return fmt.Sprintf("\n\nData as of %s UTC", oldest.UTC().Format("15:04:05"))
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestCache() *ttlCache {
+	return &ttlCache{entries: make(map[string]cacheEntry), calls: make(map[string]*cacheCall)}
+}
+
+func TestCacheTTL(t *testing.T) {
+	tests := []struct {
+		key  string
+		want time.Duration
+	}{
+		{"price:bitcoin:usd", cacheTTLs["price"]},
+		{"feargreed_image", cacheTTLs["feargreed_image"]},
+		{"block:height:1", cacheTTLs["block"]},
+		{"unknown:x", defaultCacheTTL},
+	}
+	for _, tt := range tests {
+		if got := cacheTTL(tt.key); got != tt.want {
+			t.Errorf("cacheTTL(%q) = %s, want %s", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestCacheReturnsFreshEntries(t *testing.T) {
+	c := newTestCache()
+	var calls int32
+	fetch := func(ctx context.Context) (interface{}, error) {
+		return atomic.AddInt32(&calls, 1), nil
+	}
+
+	for i := 0; i < 3; i++ {
+		value, _, err := c.get(context.Background(), "price:bitcoin:usd", fetch)
+		if err != nil || value.(int32) != 1 {
+			t.Fatalf("get = %v, %v, want 1", value, err)
+		}
+	}
+
+	// Expire the entry
+	c.entries["price:bitcoin:usd"] = cacheEntry{value: int32(1), fetchedAt: time.Now().Add(-time.Hour)}
+	if value, _, _ := c.get(context.Background(), "price:bitcoin:usd", fetch); value.(int32) != 2 {
+		t.Errorf("expired entry not refetched, got %v", value)
+	}
+}
+
+func TestCacheDoesNotCacheErrors(t *testing.T) {
+	c := newTestCache()
+	failure := errors.New("upstream down")
+	if _, _, err := c.get(context.Background(), "fees", func(ctx context.Context) (interface{}, error) {
+		return nil, failure
+	}); !errors.Is(err, failure) {
+		t.Fatalf("error = %v, want %v", err, failure)
+	}
+	value, _, err := c.get(context.Background(), "fees", func(ctx context.Context) (interface{}, error) {
+		return 5, nil
+	})
+	if err != nil || value.(int) != 5 {
+		t.Errorf("get after error = %v, %v", value, err)
+	}
+}
+
+func TestCacheCoalescesConcurrentFetches(t *testing.T) {
+	c := newTestCache()
+	release := make(chan struct{})
+	var calls int32
+	fetch := func(ctx context.Context) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return "value", nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if value, _, err := c.get(context.Background(), "assets", fetch); err != nil || value != "value" {
+				t.Errorf("get = %v, %v", value, err)
+			}
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("fetch called %d times, want 1", calls)
+	}
+}
+
+func TestCachePanickingFetchReleasesWaiters(t *testing.T) {
+	c := newTestCache()
+	_, _, err := c.get(context.Background(), "tx:abc", func(ctx context.Context) (interface{}, error) {
+		panic("boom")
+	})
+	if err == nil {
+		t.Fatal("panicking fetch returned no error")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		c.get(context.Background(), "tx:abc", func(ctx context.Context) (interface{}, error) { return 1, nil })
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("get blocked after a panicking fetch")
+	}
+}
+
+func TestCacheCancelledCallerDoesNotFailOthers(t *testing.T) {
+	c := newTestCache()
+	release := make(chan struct{})
+	fetch := func(ctx context.Context) (interface{}, error) {
+		select {
+		case <-release:
+			return "value", nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error)
+	go func() {
+		_, _, err := c.get(ctx, "block", fetch)
+		first <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	second := make(chan error)
+	go func() {
+		_, _, err := c.get(context.Background(), "block", fetch)
+		second <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	cancel()
+	if err := <-first; !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled caller error = %v", err)
+	}
+	close(release)
+	if err := <-second; err != nil {
+		t.Errorf("other caller failed with %v", err)
+	}
+}
+
+func TestCacheEvictsBeyondLimit(t *testing.T) {
+	c := newTestCache()
+	now := time.Now()
+	for i := 0; i < maxCacheEntries; i++ {
+		c.entries[fmt.Sprintf("tx:%d", i)] = cacheEntry{value: i, fetchedAt: now.Add(time.Duration(i) * time.Millisecond)}
+	}
+	// One expired entry, dropped first
+	c.entries["price:old"] = cacheEntry{fetchedAt: now.Add(-time.Hour)}
+
+	c.mu.Lock()
+	c.put("tx:new", cacheEntry{value: "new", fetchedAt: now})
+	c.put("tx:newer", cacheEntry{value: "newer", fetchedAt: now})
+	c.mu.Unlock()
+
+	if len(c.entries) > maxCacheEntries {
+		t.Errorf("cache holds %d entries, limit is %d", len(c.entries), maxCacheEntries)
+	}
+	if _, ok := c.entries["price:old"]; ok {
+		t.Error("expired entry kept")
+	}
+	if _, ok := c.entries["tx:0"]; ok {
+		t.Error("oldest entry kept")
+	}
+	if _, ok := c.entries["tx:newer"]; !ok {
+		t.Error("new entry missing")
+	}
+}
+
+func TestDataAsOf(t *testing.T) {
+	if got := dataAsOf(time.Now()); got != "" {
+		t.Errorf("dataAsOf(now) = %q, want empty", got)
+	}
+	old := time.Date(2024, 1, 1, 12, 30, 15, 0, time.UTC)
+	if got, want := dataAsOf(time.Now(), old), "\n\nData as of 12:30:15 UTC"; got != want {
+		t.Errorf("dataAsOf = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image/color"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Candle intervals accepted by /candles
+var candleIntervals = map[string]time.Duration{
+	"15m": 15 * time.Minute,
+	"30m": 30 * time.Minute,
+	"1h":  time.Hour,
+	"4h":  4 * time.Hour,
+	"6h":  6 * time.Hour,
+	"12h": 12 * time.Hour,
+	"1d":  24 * time.Hour,
+	"1w":  7 * 24 * time.Hour,
+}
+
+// Ranges accepted by /candles, in days
+var candleRanges = map[string]int{
+	"1d":   1,
+	"7d":   7,
+	"14d":  14,
+	"30d":  30,
+	"90d":  90,
+	"180d": 180,
+	"1y":   365,
+}
+
+// Range used when /candles is given only an interval, in days
+var defaultCandleDays = map[time.Duration]int{
+	15 * time.Minute:   1,
+	30 * time.Minute:   1,
+	time.Hour:          7,
+	4 * time.Hour:      30,
+	6 * time.Hour:      30,
+	12 * time.Hour:     90,
+	24 * time.Hour:     180,
+	7 * 24 * time.Hour: 365,
+}
+
+// Limits on what /candles will draw
+const (
+	maxCandles        = 500
+	maxMovingAverages = 3
+	maxAveragePeriod  = 200
+)
+
+// Colors of the moving average lines, in the order they are requested
+var movingAverageColors = []color.Color{
+	color.RGBA{0x29, 0x62, 0xff, 0xff},
+	color.RGBA{0xab, 0x47, 0xbc, 0xff},
+	color.RGBA{0xff, 0xeb, 0x3b, 0xff},
+}
+
+// Function to calculate the simple moving average of the closing prices.
+// Candles without enough history before them get NaN.
+func movingAverage(candles []Candle, period int) []float64 {
+	averages := make([]float64, len(candles))
+	sum := 0.0
+	for i, candle := range candles {
+		sum += candle.Close
+		if i >= period {
+			sum -= candles[i-period].Close
+		}
+		if i+1 < period {
+			averages[i] = math.NaN()
+		} else {
+			averages[i] = sum / float64(period)
+		}
+	}
+	return averages
+}
+
+// Helper function to format a large value for a chart label, e.g. 1.3B
+func formatCompactChartValue(value float64, currency string) string {
+	switch {
+	case value >= 1e12:
+		return formatChartValue(value/1e12, 1, currency) + "T"
+	case value >= 1e9:
+		return formatChartValue(value/1e9, 1, currency) + "B"
+	case value >= 1e6:
+		return formatChartValue(value/1e6, 1, currency) + "M"
+	case value >= 1e3:
+		return formatChartValue(value/1e3, 1, currency) + "K"
+	default:
+		return formatChartValue(value, 0, currency)
+	}
+}
+
+// Function to render candles as a PNG candlestick chart with moving averages
+// and, when the provider reports volume, a volume panel below
+func renderCandleChart(title string, candles []Candle, interval time.Duration, periods []int, currency string) ([]byte, error) {
+	if len(candles) < 2 {
+		return nil, errors.New("not enough candles to draw a chart")
+	}
+
+	averages := make([][]float64, len(periods))
+	for i, period := range periods {
+		averages[i] = movingAverage(candles, period)
+	}
+
+	low, high := candles[0].Low, candles[0].High
+	maxVolume := 0.0
+	for i, candle := range candles {
+		low = math.Min(low, candle.Low)
+		high = math.Max(high, candle.High)
+		maxVolume = math.Max(maxVolume, candle.Volume)
+		for _, average := range averages {
+			if !math.IsNaN(average[i]) {
+				low = math.Min(low, average[i])
+				high = math.Max(high, average[i])
+			}
+		}
+	}
+	padding := (high - low) * 0.05
+	if padding == 0 {
+		padding = high * 0.01
+	}
+
+	area := plotArea{
+		left:   20,
+		top:    50,
+		right:  chartWidth - 140,
+		bottom: chartHeight - 40,
+		start:  candles[0].Time,
+		end:    candles[len(candles)-1].Time.Add(interval),
+		low:    low - padding,
+		high:   high + padding,
+	}
+
+	// Split off a panel for the volume bars
+	volumeArea := area
+	if maxVolume > 0 {
+		area.bottom = chartHeight - 160
+		volumeArea.top = area.bottom + 20
+		volumeArea.low = 0
+		volumeArea.high = maxVolume * 1.3
+	}
+
+	c := newCanvas(chartWidth, chartHeight, chartBackground)
+	c.text(area.left, 16, title, chartTextScale, chartTitle)
+
+	legendX := area.left + textWidth(title, chartTextScale) + 30
+	for i, period := range periods {
+		label := fmt.Sprintf("MA%d", period)
+		c.text(legendX, 16, label, chartTextScale, movingAverageColors[i])
+		legendX += textWidth(label, chartTextScale) + 20
+	}
+
+	ticks, decimals := niceTicks(area.low, area.high, 6)
+	drawValueAxis(c, area, ticks, decimals, currency)
+
+	// Draw the vertical gridlines through both panels
+	fullArea := area
+	fullArea.bottom = volumeArea.bottom
+	drawTimeAxis(c, fullArea, fullArea.bottom+12)
+
+	slot := float64(area.right-area.left) / float64(len(candles))
+	bodyWidth := max(1, int(slot*0.7))
+
+	for _, candle := range candles {
+		x := area.x(candle.Time.Add(interval / 2))
+		body, volume := chartUp, chartUpVolume
+		if candle.Close < candle.Open {
+			body, volume = chartDown, chartDownVolume
+		}
+
+		c.fillRect(x, area.y(candle.High), x, area.y(candle.Low), body)
+		c.fillRect(x-bodyWidth/2, area.y(candle.Open), x-bodyWidth/2+bodyWidth-1, area.y(candle.Close), body)
+
+		if maxVolume > 0 {
+			c.fillRect(x-bodyWidth/2, volumeArea.y(0), x-bodyWidth/2+bodyWidth-1, volumeArea.y(candle.Volume), volume)
+		}
+	}
+
+	for i, average := range averages {
+		for j := 1; j < len(candles); j++ {
+			if math.IsNaN(average[j-1]) {
+				continue
+			}
+			c.line(area.x(candles[j-1].Time.Add(interval/2)), area.y(average[j-1]),
+				area.x(candles[j].Time.Add(interval/2)), area.y(average[j]), 2, movingAverageColors[i])
+		}
+	}
+
+	if maxVolume > 0 {
+		c.fillRect(volumeArea.left, volumeArea.top, volumeArea.right, volumeArea.top, chartGrid)
+		c.text(volumeArea.left+4, volumeArea.top+4, "VOL", chartTextScale, chartText)
+		c.text(volumeArea.right+8, volumeArea.top+4, formatCompactChartValue(maxVolume, currency), chartTextScale, chartText)
+	}
+
+	last := candles[len(candles)-1]
+	tag := chartUp
+	if last.Close < last.Open {
+		tag = chartDown
+	}
+	priceDecimals := max(currencyOrUSD(currency).Decimals, decimals)
+	drawValueTag(c, area, last.Close, formatChartValue(last.Close, priceDecimals, currency), tag)
+
+	return c.png()
+}
+
+// Handle /candles command
+func handleCandlesCommand(ctx context.Context, update tgbotapi.Update) {
+	chatID := update.Message.Chat.ID
+
+	// The first time argument is the interval and the second the range, e.g. /candles 4h 30d ma20
+	intervalName, rangeName := "", ""
+	var periods []int
+	var args []string
+	for _, arg := range strings.Fields(update.Message.CommandArguments()) {
+		lower := strings.ToLower(arg)
+		if period, err := strconv.Atoi(strings.TrimPrefix(lower, "ma")); strings.HasPrefix(lower, "ma") && err == nil {
+			if period < 2 || period > maxAveragePeriod {
+				sendMessage(chatID, fmt.Sprintf("Moving average periods must be between 2 and %d.", maxAveragePeriod))
+				return
+			}
+			if len(periods) == maxMovingAverages {
+				sendMessage(chatID, fmt.Sprintf("At most %d moving averages can be drawn.", maxMovingAverages))
+				return
+			}
+			periods = append(periods, period)
+			continue
+		}
+		if _, ok := candleIntervals[lower]; ok && intervalName == "" {
+			intervalName = lower
+			continue
+		}
+		if _, ok := candleRanges[lower]; ok && rangeName == "" {
+			rangeName = lower
+			continue
+		}
+		args = append(args, arg)
+	}
+
+	if intervalName == "" {
+		intervalName = "4h"
+	}
+	interval := candleIntervals[intervalName]
+	days := defaultCandleDays[interval]
+	defaultRange := rangeName == ""
+	if !defaultRange {
+		days = candleRanges[rangeName]
+	}
+
+	count := int(time.Duration(days) * 24 * time.Hour / interval)
+	if count < 2 {
+		sendMessage(chatID, "The range must cover at least two candles. Usage: /candles <interval> <range> [ma<period>...] [coin] [currency]\nExample: /candles 4h 30d ma20 ma50")
+		return
+	}
+	if count > maxCandles {
+		sendMessage(chatID, fmt.Sprintf("That would be %d candles, the maximum is %d. Pick a larger interval or a shorter range.", count, maxCandles))
+		return
+	}
+
+	coin, currency, err := coinAndCurrencyFromArgs(ctx, chatID, args, true)
+	if err != nil {
+		sendCoinError(chatID, err)
+		return
+	}
+	symbol := strings.ToUpper(coin.Symbol)
+
+	candles, asOf, err := getCandles(ctx, coin.ID, currency, interval, days)
+	var limitErr *candleLimitError
+	if errors.As(err, &limitErr) && defaultRange && time.Duration(limitErr.MaxDays)*24*time.Hour >= 2*interval {
+		// The default range goes further back than the provider serves, so draw what it has
+		days = limitErr.MaxDays
+		candles, asOf, err = getCandles(ctx, coin.ID, currency, interval, days)
+	}
+	if errors.As(err, &limitErr) {
+		if limitErr.MaxDays == 0 {
+			sendMessage(chatID, fmt.Sprintf("%s has no %s candles. Pick a larger interval.", limitErr.Provider, intervalName))
+		} else {
+			sendMessage(chatID, fmt.Sprintf("%s only serves the last %d days of %s candles. Pick a larger interval or a shorter range.", limitErr.Provider, limitErr.MaxDays, intervalName))
+		}
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching %s candles: %v", symbol, err)
+		sendMessage(chatID, fmt.Sprintf("Error fetching %s candles.", symbol))
+		return
+	}
+	if len(candles) < 2 {
+		sendMessage(chatID, fmt.Sprintf("Not enough %s candles to draw a chart.", symbol))
+		return
+	}
+
+	if defaultRange {
+		rangeName = fmt.Sprintf("%dd", days)
+	}
+	title := fmt.Sprintf("%s / %s  %s  %s", coin, strings.ToUpper(currency), strings.ToUpper(intervalName), strings.ToUpper(rangeName))
+	image, err := renderCandleChart(title, candles, interval, periods, currency)
+	if err != nil {
+		log.Println("Error rendering candle chart:", err)
+		sendMessage(chatID, "Error rendering chart.")
+		return
+	}
+
+	photo := tgbotapi.NewPhoto(chatID, tgbotapi.FileBytes{
+		Name:  "candles.png",
+		Bytes: image,
+	})
+	photo.Caption = fmt.Sprintf("%s %s candles over the last %d days", coin, intervalName, days)
+	hasVolume := false
+	for _, candle := range candles {
+		hasVolume = hasVolume || candle.Volume > 0
+	}
+	if !hasVolume {
+		photo.Caption += "\nVolume is not available from this data source."
+	}
+	photo.Caption += dataAsOf(asOf)
+
+	_, err = bot.Send(photo)
+	if err != nil {
+		log.Println("Error sending candle chart:", err)
+		sendMessage(chatID, "Error sending chart.")
+	}
+}
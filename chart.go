@@ -0,0 +1,412 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"golang.org/x/text/message"
+)
+
+// Chart dimensions in pixels
+const (
+	chartWidth     = 940
+	chartHeight    = 500
+	chartTextScale = 2
+)
+
+// Chart colors
+var (
+	chartBackground = color.RGBA{0x13, 0x17, 0x22, 0xff}
+	chartGrid       = color.RGBA{0x2a, 0x2e, 0x39, 0xff}
+	chartText       = color.RGBA{0xb2, 0xb5, 0xbe, 0xff}
+	chartTitle      = color.RGBA{0xe0, 0xe3, 0xeb, 0xff}
+	chartLine       = color.RGBA{0xf7, 0x93, 0x1a, 0xff}
+	chartATH        = color.RGBA{0xe0, 0x4e, 0x4e, 0xff}
+	chartUp         = color.RGBA{0x26, 0xa6, 0x9a, 0xff}
+	chartDown       = color.RGBA{0xef, 0x53, 0x50, 0xff}
+	chartUpVolume   = color.NRGBA{0x26, 0xa6, 0x9a, 0x80}
+	chartDownVolume = color.NRGBA{0xef, 0x53, 0x50, 0x80}
+)
+
+// Ranges accepted by /chart. Ranges with an interval are drawn from candles of
+// that interval, as most providers only have daily price history.
+var chartRanges = []struct {
+	name     string
+	days     int
+	label    string
+	interval time.Duration
+}{
+	{"1d", 1, "24 hours", 30 * time.Minute},
+	{"7d", 7, "7 days", time.Hour},
+	{"30d", 30, "30 days", 0},
+	{"1y", 365, "year", 0},
+}
+
+// canvas is an image that charts are drawn on
+type canvas struct {
+	img *image.RGBA
+}
+
+// Function to create a canvas filled with a background color
+func newCanvas(width, height int, background color.Color) *canvas {
+	c := &canvas{img: image.NewRGBA(image.Rect(0, 0, width, height))}
+	draw.Draw(c.img, c.img.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+	return c
+}
+
+// Function to fill the rectangle between two corners, both included
+func (c *canvas) fillRect(x0, y0, x1, y1 int, col color.Color) {
+	if x0 > x1 {
+		x0, x1 = x1, x0
+	}
+	if y0 > y1 {
+		y0, y1 = y1, y0
+	}
+	draw.Draw(c.img, image.Rect(x0, y0, x1+1, y1+1), image.NewUniform(col), image.Point{}, draw.Over)
+}
+
+// Function to draw a line of the given width between two points
+func (c *canvas) line(x0, y0, x1, y1, width int, col color.Color) {
+	dx := abs(x1 - x0)
+	dy := -abs(y1 - y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+
+	// Bresenham's algorithm, stamping a square brush at every step
+	half := (width - 1) / 2
+	err := dx + dy
+	for {
+		c.fillRect(x0-half, y0-half, x0-half+width-1, y0-half+width-1, col)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		e2 := 2 * err
+		if e2 >= dy {
+			err += dy
+			x0 += sx
+		}
+		if e2 <= dx {
+			err += dx
+			y0 += sy
+		}
+	}
+}
+
+// Function to draw a dashed horizontal line
+func (c *canvas) dashedLine(x0, x1, y int, col color.Color) {
+	for x := x0; x <= x1; x += 10 {
+		c.fillRect(x, y, min(x+5, x1), y, col)
+	}
+}
+
+// Function to draw text with its top-left corner at x, y
+func (c *canvas) text(x, y int, text string, scale int, col color.Color) {
+	for _, r := range text {
+		g := glyph(r)
+		for row := 0; row < glyphHeight; row++ {
+			for column := 0; column < glyphWidth; column++ {
+				if g[row]&(1<<(glyphWidth-1-column)) != 0 {
+					px, py := x+column*scale, y+row*scale
+					c.fillRect(px, py, px+scale-1, py+scale-1, col)
+				}
+			}
+		}
+		x += (glyphWidth + glyphSpacing) * scale
+	}
+}
+
+// Function to encode the canvas as PNG
+func (c *canvas) png() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, c.img); err != nil {
+		return nil, fmt.Errorf("error encoding chart: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Helper function to get the absolute value of an int
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// plotArea maps times and values to pixels inside a rectangle of the canvas
+type plotArea struct {
+	left, top, right, bottom int
+	start, end               time.Time
+	low, high                float64
+}
+
+// Function to get the x coordinate of a time
+func (a plotArea) x(t time.Time) int {
+	span := a.end.Sub(a.start)
+	if span <= 0 {
+		return a.left
+	}
+	return a.left + int(math.Round(float64(a.right-a.left)*float64(t.Sub(a.start))/float64(span)))
+}
+
+// Function to get the y coordinate of a value
+func (a plotArea) y(value float64) int {
+	if a.high == a.low {
+		return (a.top + a.bottom) / 2
+	}
+	return a.bottom - int(math.Round(float64(a.bottom-a.top)*(value-a.low)/(a.high-a.low)))
+}
+
+// Function to choose round tick values covering a range, returning the ticks
+// and the number of decimals needed to label them
+func niceTicks(low, high float64, count int) ([]float64, int) {
+	if high <= low {
+		return []float64{low}, 0
+	}
+
+	// Steps are 1, 2 or 5 times a power of ten
+	raw := (high - low) / float64(count)
+	magnitude := math.Pow(10, math.Floor(math.Log10(raw)))
+	step := magnitude * 10
+	for _, factor := range []float64{1, 2, 5} {
+		if raw <= factor*magnitude {
+			step = factor * magnitude
+			break
+		}
+	}
+
+	var ticks []float64
+	for tick := math.Ceil(low/step) * step; tick <= high+step*1e-9; tick += step {
+		ticks = append(ticks, tick)
+	}
+
+	decimals := int(math.Max(0, -math.Floor(math.Log10(step))))
+	return ticks, min(decimals, 8)
+}
+
+// Helper function to format a value for a chart label with the digit
+// grouping of the currency's locale. The symbol is left out because the
+// chart font only covers ASCII.
+func formatChartValue(value float64, decimals int, currency string) string {
+	p := message.NewPrinter(currencyOrUSD(currency).Locale)
+	return p.Sprintf("%.*f", decimals, value)
+}
+
+// Function to draw horizontal gridlines with value labels right of the plot area
+func drawValueAxis(c *canvas, area plotArea, ticks []float64, decimals int, currency string) {
+	for _, tick := range ticks {
+		y := area.y(tick)
+		c.fillRect(area.left, y, area.right, y, chartGrid)
+		c.text(area.right+8, y-glyphHeight*chartTextScale/2, formatChartValue(tick, decimals, currency), chartTextScale, chartText)
+	}
+}
+
+// Function to draw vertical gridlines with time labels below the plot area
+func drawTimeAxis(c *canvas, area plotArea, labelY int) {
+	span := area.end.Sub(area.start)
+	layout := "Jan 06"
+	if span <= 2*24*time.Hour {
+		layout = "15:04"
+	} else if span <= 62*24*time.Hour {
+		layout = "Jan 2"
+	}
+
+	const count = 6
+	for i := 0; i <= count; i++ {
+		t := area.start.Add(span * time.Duration(i) / count)
+		x := area.x(t)
+		c.fillRect(x, area.top, x, area.bottom, chartGrid)
+
+		label := t.UTC().Format(layout)
+		width := textWidth(label, chartTextScale)
+		labelX := min(max(x-width/2, area.left), area.right-width)
+		c.text(labelX, labelY, label, chartTextScale, chartText)
+	}
+}
+
+// Function to draw a value in a filled box right of the plot area, used to
+// mark the current price on the value axis
+func drawValueTag(c *canvas, area plotArea, value float64, text string, background color.Color) {
+	y := area.y(value)
+	height := glyphHeight*chartTextScale + 8
+	c.fillRect(area.right+2, y-height/2, area.right+6+textWidth(text, chartTextScale)+6, y+height/2, background)
+	c.text(area.right+8, y-glyphHeight*chartTextScale/2, text, chartTextScale, chartBackground)
+}
+
+// Function to render a price history as a PNG line chart with the ATH and current price marked
+func renderPriceChart(title string, history []PricePoint, current float64, ath allTimeHigh, currency string) ([]byte, error) {
+	if len(history) < 2 {
+		return nil, errors.New("not enough price data to draw a chart")
+	}
+
+	low, high := current, current
+	for _, point := range history {
+		low = math.Min(low, point.Price)
+		high = math.Max(high, point.Price)
+	}
+
+	// Show the ATH line when it is close enough above the range to not squash the chart
+	showATH := ath.Price > 0 && ath.Price <= high+(high-low)*0.25
+	if showATH {
+		high = math.Max(high, ath.Price)
+	}
+
+	padding := (high - low) * 0.05
+	if padding == 0 {
+		padding = high * 0.01
+	}
+
+	area := plotArea{
+		left:   20,
+		top:    50,
+		right:  chartWidth - 140,
+		bottom: chartHeight - 40,
+		start:  history[0].Time,
+		end:    history[len(history)-1].Time,
+		low:    low - padding,
+		high:   high + padding,
+	}
+
+	c := newCanvas(chartWidth, chartHeight, chartBackground)
+	c.text(area.left, 16, title, chartTextScale, chartTitle)
+
+	ticks, decimals := niceTicks(area.low, area.high, 6)
+	drawValueAxis(c, area, ticks, decimals, currency)
+	drawTimeAxis(c, area, area.bottom+12)
+
+	priceDecimals := max(currencyOrUSD(currency).Decimals, decimals)
+	if ath.Price > 0 {
+		label := "ATH " + formatChartValue(ath.Price, priceDecimals, currency)
+		c.text(area.right-textWidth(label, chartTextScale), 16, label, chartTextScale, chartATH)
+	}
+	if showATH {
+		c.dashedLine(area.left, area.right, area.y(ath.Price), chartATH)
+	}
+
+	for i := 1; i < len(history); i++ {
+		previous, point := history[i-1], history[i]
+		c.line(area.x(previous.Time), area.y(previous.Price), area.x(point.Time), area.y(point.Price), 2, chartLine)
+	}
+
+	// Mark the ATH itself when it was reached within the charted range
+	if showATH && !ath.Date.IsZero() && !ath.Date.Before(area.start) && !ath.Date.After(area.end) {
+		x, y := area.x(ath.Date), area.y(ath.Price)
+		c.fillRect(x-4, y-4, x+4, y+4, chartATH)
+	}
+
+	drawValueTag(c, area, current, formatChartValue(current, priceDecimals, currency), chartLine)
+
+	return c.png()
+}
+
+// Helper function to turn candles into the prices they closed at
+func candleCloses(candles []Candle, interval time.Duration) []PricePoint {
+	history := make([]PricePoint, 0, len(candles))
+	for _, candle := range candles {
+		history = append(history, PricePoint{Time: candle.Time.Add(interval), Price: candle.Close})
+	}
+	return history
+}
+
+// Function to fetch the prices to chart over the last given number of days.
+// With an interval the prices come from candles, falling back to the price
+// history if the provider has no candles of that interval.
+func getChartHistory(ctx context.Context, coin, currency string, days int, interval time.Duration) ([]PricePoint, time.Time, error) {
+	if interval > 0 {
+		candles, asOf, err := getCandles(ctx, coin, currency, interval, days)
+		if err == nil && len(candles) >= 2 {
+			return candleCloses(candles, interval), asOf, nil
+		}
+		if err != nil {
+			log.Printf("Error fetching %s candles for chart, using price history: %v", interval, err)
+		}
+	}
+	return getPriceHistory(ctx, coin, currency, days)
+}
+
+// Handle /chart command
+func handleChartCommand(ctx context.Context, update tgbotapi.Update) {
+	chatID := update.Message.Chat.ID
+
+	// The range may be given anywhere, the other arguments select the coin and currency
+	chartRange := chartRanges[1]
+	var args []string
+	for _, arg := range strings.Fields(update.Message.CommandArguments()) {
+		matched := false
+		for _, r := range chartRanges {
+			if strings.EqualFold(arg, r.name) {
+				chartRange = r
+				matched = true
+			}
+		}
+		if !matched {
+			args = append(args, arg)
+		}
+	}
+
+	coin, currency, err := coinAndCurrencyFromArgs(ctx, chatID, args, true)
+	if err != nil {
+		sendCoinError(chatID, err)
+		return
+	}
+	symbol := strings.ToUpper(coin.Symbol)
+
+	history, historyAsOf, err := getChartHistory(ctx, coin.ID, currency, chartRange.days, chartRange.interval)
+	if err != nil {
+		log.Printf("Error fetching %s price history: %v", symbol, err)
+		sendMessage(chatID, fmt.Sprintf("Error fetching %s price history.", symbol))
+		return
+	}
+	if len(history) < 2 {
+		sendMessage(chatID, fmt.Sprintf("Not enough %s price history to draw a chart.", symbol))
+		return
+	}
+
+	// The history may lag behind, so label the chart with the latest price when available
+	current, priceAsOf, err := getPrice(ctx, coin.ID, currency)
+	if err != nil {
+		log.Printf("Error fetching %s price: %v", symbol, err)
+		current, priceAsOf = history[len(history)-1].Price, historyAsOf
+	}
+
+	// The chart is still useful without the ATH marker
+	ath, _, err := getATH(ctx, coin.ID, currency)
+	if err != nil {
+		log.Printf("Error fetching %s ATH: %v", symbol, err)
+	}
+
+	title := fmt.Sprintf("%s / %s  %s", coin, strings.ToUpper(currency), strings.ToUpper(chartRange.name))
+	image, err := renderPriceChart(title, history, current, ath, currency)
+	if err != nil {
+		log.Println("Error rendering chart:", err)
+		sendMessage(chatID, "Error rendering chart.")
+		return
+	}
+
+	photo := tgbotapi.NewPhoto(chatID, tgbotapi.FileBytes{
+		Name:  "chart.png",
+		Bytes: image,
+	})
+	photo.Caption = fmt.Sprintf("%s price over the last %s: %s", coin, chartRange.label, formatNumber(current, currency)) + dataAsOf(historyAsOf, priceAsOf)
+
+	_, err = bot.Send(photo)
+	if err != nil {
+		log.Println("Error sending chart:", err)
+		sendMessage(chatID, "Error sending chart.")
+	}
+}
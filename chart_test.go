@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// fakeMarketData serves fixed candles and price history
+type fakeMarketData struct {
+	candles    []Candle
+	candlesErr error
+	history    []PricePoint
+	intervals  []time.Duration
+}
+
+func (f *fakeMarketData) Name() string { return "fake" }
+
+func (f *fakeMarketData) Price(ctx context.Context, coin, currency string) (float64, error) {
+	return 0, errNotSupported
+}
+
+func (f *fakeMarketData) MarketCap(ctx context.Context, coin, currency string) (float64, error) {
+	return 0, errNotSupported
+}
+
+func (f *fakeMarketData) Volume(ctx context.Context, coin, currency string) (float64, error) {
+	return 0, errNotSupported
+}
+
+func (f *fakeMarketData) ATH(ctx context.Context, coin, currency string) (float64, time.Time, error) {
+	return 0, time.Time{}, errNotSupported
+}
+
+func (f *fakeMarketData) PriceHistory(ctx context.Context, coin, currency string, days int) ([]PricePoint, error) {
+	return f.history, nil
+}
+
+func (f *fakeMarketData) Candles(ctx context.Context, coin, currency string, interval time.Duration, days int) ([]Candle, error) {
+	f.intervals = append(f.intervals, interval)
+	return f.candles, f.candlesErr
+}
+
+func TestGetChartHistory(t *testing.T) {
+	now := time.Now().Truncate(time.Hour)
+	hourly := []Candle{
+		{Time: now.Add(-3 * time.Hour), Close: 100},
+		{Time: now.Add(-2 * time.Hour), Close: 110},
+		{Time: now.Add(-time.Hour), Close: 105},
+	}
+	daily := []PricePoint{
+		{Time: now.AddDate(0, 0, -1), Price: 90},
+		{Time: now, Price: 105},
+	}
+
+	tests := []struct {
+		name      string
+		candles   []Candle
+		err       error
+		interval  time.Duration
+		want      []PricePoint
+		wantCalls int
+	}{
+		{
+			name:     "candle closes",
+			candles:  hourly,
+			interval: time.Hour,
+			want: []PricePoint{
+				{Time: now.Add(-2 * time.Hour), Price: 100},
+				{Time: now.Add(-time.Hour), Price: 110},
+				{Time: now, Price: 105},
+			},
+			wantCalls: 1,
+		},
+		{name: "no candles of the interval", err: errNotSupported, interval: time.Hour, want: daily, wantCalls: 1},
+		{name: "too few candles", candles: hourly[2:], interval: time.Hour, want: daily, wantCalls: 1},
+		{name: "no interval", candles: hourly, want: daily},
+	}
+
+	oldMarketData, oldCache := marketData, upstreamCache
+	defer func() { marketData, upstreamCache = oldMarketData, oldCache }()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &fakeMarketData{candles: tt.candles, candlesErr: tt.err, history: daily}
+			marketData, upstreamCache = provider, newTestCache()
+
+			history, _, err := getChartHistory(context.Background(), bitcoinID, "usd", 7, tt.interval)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(provider.intervals) != tt.wantCalls {
+				t.Errorf("fetched candles %d times, want %d", len(provider.intervals), tt.wantCalls)
+			}
+			if len(history) != len(tt.want) {
+				t.Fatalf("got %d prices, want %d", len(history), len(tt.want))
+			}
+			for i := range history {
+				if !history[i].Time.Equal(tt.want[i].Time) || history[i].Price != tt.want[i].Price {
+					t.Errorf("price %d = %v, want %v", i, history[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestChartRangesUseIntradayCandles(t *testing.T) {
+	for _, chartRange := range chartRanges {
+		if chartRange.days <= 7 && (chartRange.interval <= 0 || chartRange.interval > time.Hour) {
+			t.Errorf("%s chart has interval %s, want hourly or finer", chartRange.name, chartRange.interval)
+		}
+	}
+}
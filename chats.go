@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Chat the bot has seen, with its per-chat preferences
+type chatRecord struct {
+	ID          int64             `json:"id"`
+	Type        string            `json:"type"`
+	Title       string            `json:"title,omitempty"`
+	Username    string            `json:"username,omitempty"`
+	Active      bool              `json:"active"`
+	FirstSeen   time.Time         `json:"first_seen"`
+	LastSeen    time.Time         `json:"last_seen"`
+	Preferences map[string]string `json:"preferences,omitempty"`
+}
+
+// chatRepository stores chats in the chats bucket
+type chatRepository struct {
+	store *Store
+}
+
+// Global chat repository
+var chats *chatRepository
+
+// Helper function to build the storage key of a chat
+func chatKey(chatID int64) string {
+	return strconv.FormatInt(chatID, 10)
+}
+
+// How stale a chat's last seen time may get before a message updates it
+const chatSeenResolution = time.Hour
+
+// Function to record that a message was received in a chat. The chat is only
+// written when it changed, so busy chats do not cause a write per message.
+func (r *chatRepository) touch(chat *tgbotapi.Chat) error {
+	record, found, err := r.get(chat.ID)
+	if err != nil {
+		return err
+	}
+	if found && record.Active && record.Type == chat.Type && record.Title == chat.Title &&
+		record.Username == chat.UserName && time.Since(record.LastSeen) < chatSeenResolution {
+		return nil
+	}
+
+	return r.store.Update(func(tx *storeTx) error {
+		var record chatRecord
+		found, err := tx.Get(bucketChats, chatKey(chat.ID), &record)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if !found {
+			record = chatRecord{ID: chat.ID, FirstSeen: now}
+		}
+		record.Type = chat.Type
+		record.Title = chat.Title
+		record.Username = chat.UserName
+		record.Active = true
+		record.LastSeen = now
+		return tx.Put(bucketChats, chatKey(chat.ID), record)
+	})
+}
+
+// Function to mark a chat as inactive after the bot was removed from it
+func (r *chatRepository) deactivate(chatID int64) error {
+	return r.store.Update(func(tx *storeTx) error {
+		var record chatRecord
+		found, err := tx.Get(bucketChats, chatKey(chatID), &record)
+		if err != nil || !found {
+			return err
+		}
+		record.Active = false
+		return tx.Put(bucketChats, chatKey(chatID), record)
+	})
+}
+
+// Function to load a chat. Returns false if the chat has never been seen.
+func (r *chatRepository) get(chatID int64) (chatRecord, bool, error) {
+	var record chatRecord
+	var found bool
+	err := r.store.View(func(tx *storeTx) error {
+		var err error
+		found, err = tx.Get(bucketChats, chatKey(chatID), &record)
+		return err
+	})
+	return record, found, err
+}
+
+// Function to read a chat preference, returning an empty string if it is not set
+func (r *chatRepository) preference(chatID int64, name string) (string, error) {
+	record, _, err := r.get(chatID)
+	if err != nil {
+		return "", err
+	}
+	return record.Preferences[name], nil
+}
+
+// Function to set a chat preference. An empty value clears it.
+func (r *chatRepository) setPreference(chatID int64, name, value string) error {
+	return r.store.Update(func(tx *storeTx) error {
+		var record chatRecord
+		found, err := tx.Get(bucketChats, chatKey(chatID), &record)
+		if err != nil {
+			return err
+		}
+		if !found {
+			record = chatRecord{ID: chatID, Active: true, FirstSeen: time.Now(), LastSeen: time.Now()}
+		}
+
+		if record.Preferences == nil {
+			record.Preferences = make(map[string]string)
+		}
+		if value == "" {
+			delete(record.Preferences, name)
+		} else {
+			record.Preferences[name] = value
+		}
+		return tx.Put(bucketChats, chatKey(chatID), record)
+	})
+}
+
+// Function to list the active chats that have a preference set to value
+func (r *chatRepository) withPreference(name, value string) ([]int64, error) {
+	var result []int64
+	err := r.store.View(func(tx *storeTx) error {
+		return tx.ForEach(bucketChats, func(key string, raw json.RawMessage) error {
+			var record chatRecord
+			if err := json.Unmarshal(raw, &record); err != nil {
+				return fmt.Errorf("error decoding chat %s: %v", key, err)
+			}
+			if record.Active && record.Preferences[name] == value {
+				result = append(result, record.ID)
+			}
+			return nil
+		})
+	})
+	return result, err
+}
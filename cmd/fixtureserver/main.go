@@ -0,0 +1,20 @@
+// Command fixtureserver serves the upstream API fixtures the offline profile
+// points at. Run it with go run ./cmd/fixtureserver, then start the bot with
+// BOT_PROFILE=offline.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"btcBot/fixtures"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:8090", "address to listen on")
+	flag.Parse()
+
+	log.Println("Serving fixtures on", *addr)
+	log.Fatal(http.ListenAndServe(*addr, fixtures.Handler()))
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// errCoinNotFound is returned when a ticker or name matches no known coin
+var errCoinNotFound = errors.New("coin not found")
+
+// Coin as listed by CoinGecko
+type coinInfo struct {
+	ID     string `json:"id"`
+	Symbol string `json:"symbol"`
+	Name   string `json:"name"`
+}
+
+// Coin used when a command is given no coin
+var bitcoinCoin = coinInfo{ID: bitcoinID, Symbol: "btc", Name: "Bitcoin"}
+
+// Helper function to display a coin as "Name (SYMBOL)"
+func (c coinInfo) String() string {
+	return fmt.Sprintf("%s (%s)", c.Name, strings.ToUpper(c.Symbol))
+}
+
+// Function to fetch the list of all coins known to CoinGecko
+func getCoinList(ctx context.Context) ([]coinInfo, error) {
+	var coins []coinInfo
+	if err := fetchJSON(ctx, cfg.CoinGeckoURL+"/coins/list", &coins); err != nil {
+		return nil, fmt.Errorf("error fetching coin list: %v", err)
+	}
+	return coins, nil
+}
+
+// Function to pick the coin with the largest market cap among several candidates
+func largestCoin(ctx context.Context, candidates []coinInfo) (coinInfo, error) {
+	// Keep the request URL reasonably short for very common tickers
+	if len(candidates) > 50 {
+		candidates = candidates[:50]
+	}
+
+	ids := make([]string, len(candidates))
+	for i, coin := range candidates {
+		ids[i] = coin.ID
+	}
+
+	requestURL := fmt.Sprintf("%s/coins/markets?vs_currency=usd&order=market_cap_desc&ids=%s",
+		cfg.CoinGeckoURL, url.QueryEscape(strings.Join(ids, ",")))
+
+	var markets []struct {
+		ID string `json:"id"`
+	}
+	if err := fetchJSON(ctx, requestURL, &markets); err != nil {
+		return coinInfo{}, fmt.Errorf("error fetching coin markets: %v", err)
+	}
+
+	// Coins without any market are left out of the response
+	if len(markets) == 0 {
+		return candidates[0], nil
+	}
+	for _, coin := range candidates {
+		if coin.ID == markets[0].ID {
+			return coin, nil
+		}
+	}
+	return candidates[0], nil
+}
+
+// Function to resolve a ticker, name or CoinGecko id such as "eth",
+// "wrapped bitcoin" or "solana" to a coin
+func resolveCoin(ctx context.Context, query string) (coinInfo, error) {
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" || query == bitcoinCoin.ID || query == bitcoinCoin.Symbol {
+		return bitcoinCoin, nil
+	}
+
+	coin, _, err := cached(ctx, "coin:"+query, func(ctx context.Context) (coinInfo, error) {
+		coins, _, err := cached(ctx, "coinlist", func(ctx context.Context) ([]coinInfo, error) {
+			return getCoinList(ctx)
+		})
+		if err != nil {
+			return coinInfo{}, err
+		}
+
+		// Prefer an exact id, then a full name, then a ticker
+		var byName, bySymbol []coinInfo
+		for _, coin := range coins {
+			if coin.ID == query {
+				return coin, nil
+			}
+			if strings.ToLower(coin.Name) == query {
+				byName = append(byName, coin)
+			}
+			if strings.ToLower(coin.Symbol) == query {
+				bySymbol = append(bySymbol, coin)
+			}
+		}
+
+		candidates := byName
+		if len(candidates) == 0 {
+			candidates = bySymbol
+		}
+
+		switch len(candidates) {
+		case 0:
+			return coinInfo{}, errCoinNotFound
+		case 1:
+			return candidates[0], nil
+		default:
+			// Many tokens share popular tickers, so pick the one that matters most
+			return largestCoin(ctx, candidates)
+		}
+	})
+	return coin, err
+}
+
+// Function to split command arguments into a coin and a currency. A trailing
+// currency code is taken as the currency, the rest as the coin ticker or name.
+// When allowDefaultCoin is set, a lone currency code selects Bitcoin.
+func coinAndCurrencyFromArgs(ctx context.Context, chatID int64, args []string, allowDefaultCoin bool) (coinInfo, string, error) {
+	currency := chatCurrency(chatID)
+	if len(args) >= 2 || (len(args) == 1 && allowDefaultCoin) {
+		if fiat, ok := lookupCurrency(args[len(args)-1]); ok {
+			currency = fiat.Code
+			args = args[:len(args)-1]
+		}
+	}
+
+	coin, err := resolveCoin(ctx, strings.Join(args, " "))
+	return coin, currency, err
+}
+
+// Helper function to reply to a failed coin lookup
+func sendCoinError(chatID int64, err error) {
+	if errors.Is(err, errCoinNotFound) {
+		sendMessage(chatID, "Unknown coin. Try a ticker like eth or a name like \"wrapped bitcoin\".")
+		return
+	}
+	log.Println("Error resolving coin:", err)
+	sendMessage(chatID, "Error looking up coin.")
+}
+
+// Handle /price command
+func handlePriceCommand(ctx context.Context, update tgbotapi.Update) {
+	chatID := update.Message.Chat.ID
+
+	args := strings.Fields(update.Message.CommandArguments())
+	if len(args) == 0 {
+		sendMessage(chatID, "Usage: /price <ticker or name> [currency]\nExample: /price eth eur")
+		return
+	}
+
+	coin, currency, err := coinAndCurrencyFromArgs(ctx, chatID, args, false)
+	if err != nil {
+		sendCoinError(chatID, err)
+		return
+	}
+
+	price, asOf, err := getPrice(ctx, coin.ID, currency)
+	if err != nil {
+		log.Printf("Error fetching %s price: %v", coin.ID, err)
+		sendMessage(chatID, fmt.Sprintf("Error fetching %s price.", strings.ToUpper(coin.Symbol)))
+		return
+	}
+
+	message := fmt.Sprintf("Current %s price: %s", coin, formatNumber(price, currency)) + dataAsOf(asOf)
+	sendMessage(chatID, message)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Global command router
+var commands *router
+
+// Function to create the router with all bot commands, in the order they are
+// listed in /help
+func newCommandRouter() *router {
+	// Rate limiting comes before authorization, so refused commands count
+	// against the limits too
+	r := newRouter(recoverMiddleware, loggingMiddleware, metricsMiddleware, rateLimitMiddleware, authMiddleware)
+
+	for _, cmd := range []*command{
+		{Name: "help", Description: "List the available commands", Handler: handleHelpCommand},
+		{Name: "btc", Description: "Bitcoin price", Args: "[currency]", Handler: handleBTCCommand},
+		{Name: "price", Description: "Price of any coin", Args: "<ticker or name> [currency]", Handler: handlePriceCommand},
+		{Name: "change", Description: "Price change from a day to a year", Args: "[coin] [currency]", Handler: handleChangeCommand},
+		{Name: "ath", Description: "All-time high and when it was reached", Args: "[coin] [currency]", Handler: handleATHCommand},
+		{Name: "marketcap", Description: "Bitcoin market cap", Args: "[currency]", Handler: handleMarketCapCommand},
+		{Name: "volume", Description: "Bitcoin 24-hour trading volume", Args: "[currency]", Handler: handleVolumeCommand},
+		{Name: "chart", Description: "Price chart", Args: "[1d|7d|30d|1y] [coin] [currency]", Handler: handleChartCommand},
+		{Name: "candles", Description: "Candlestick chart with moving averages", Args: "<interval> <range> [ma<period>...] [coin] [currency]", Handler: handleCandlesCommand},
+		{Name: "feargreed", Description: "Fear and Greed Index", Handler: handleFearGreedCommand},
+		{Name: "assets", Description: "Top 10 assets by market cap", Handler: handleAssetsCommand},
+		{Name: "block", Description: "Latest block or a block by height or hash", Args: "[height|hash]", Handler: handleBlockCommand},
+		{Name: "blocks", Description: "Announce new blocks in this chat", Args: "on|off", Handler: handleBlocksCommand},
+		{Name: "halving", Description: "Countdown to the next halving", Handler: handleHalvingCommand},
+		{Name: "difficulty", Description: "Projected difficulty adjustment", Handler: handleDifficultyCommand},
+		{Name: "hashrate", Description: "Network hashrate", Handler: handleHashrateCommand},
+		{Name: "fees", Description: "Recommended fees for a transaction", Args: "[inputs] [outputs] [script type] [currency]", Handler: handleFeesCommand},
+		{Name: "eta", Description: "Expected confirmation time for a fee rate or transaction", Args: "<sat/vB|txid>", Handler: handleETACommand},
+		{Name: "tx", Description: "Transaction details", Args: "<txid> [currency]", Handler: handleTxCommand},
+		{Name: "address", Description: "Address balance", Args: "<address> [currency]", Handler: handleAddressCommand},
+		{Name: "watchtx", Description: "Notify when a transaction confirms", Args: "<txid> [confirmations]", Handler: handleWatchTxCommand},
+		{Name: "unwatchtx", Description: "Stop watching a transaction", Args: "<txid>|all", Handler: handleUnwatchTxCommand},
+		{Name: "watch", Description: "Notify about payments to an address, xpub or descriptor", Args: "<address|xpub|descriptor>", Handler: handleWatchCommand},
+		{Name: "unwatch", Description: "Stop watching an address, xpub or descriptor", Args: "<id>|all", Handler: handleUnwatchCommand},
+		{Name: "alert", Description: "Alert when the price crosses a level", Args: "above|below <price> [currency]", Handler: handleAlertCommand},
+		{Name: "alerts", Description: "List your price alerts in this chat", Handler: handleAlertsCommand},
+		{Name: "unalert", Description: "Remove a price alert", Args: "<id>|all", Handler: handleUnalertCommand},
+		{Name: "subscribe", Description: "Daily or weekly market digest", Args: "daily|weekly [day] <time> [time zone]", Handler: handleSubscribeCommand},
+		{Name: "unsubscribe", Description: "Stop the market digest", Args: "[daily|weekly]", Handler: handleUnsubscribeCommand},
+		{Name: "currency", Description: "Show or set the currency of this chat", Args: "[code]", Handler: handleCurrencyCommand},
+		// Backups hold every chat's alerts and watched addresses, so they never go to a group
+		{Name: "backup", Description: "Download a backup of the bot's storage", AdminOnly: true, PrivateOnly: true, Handler: handleBackupCommand},
+		{Name: "restore", Description: "Restore the storage from a backup file", AdminOnly: true, PrivateOnly: true, Handler: handleRestoreCommand},
+	} {
+		r.register(cmd)
+	}
+	return r
+}
+
+// Handle /help command
+func handleHelpCommand(ctx context.Context, update tgbotapi.Update) {
+	sendMessage(update.Message.Chat.ID, commands.help(senderID(update.Message)))
+}
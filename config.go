@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Config holds the runtime configuration of the bot
+type Config struct {
+	// Market data provider: coingecko, kraken, coinbase or binance
+	MarketDataProvider string `json:"market_data_provider"`
+
+	// Upstream base URLs, without trailing slash
+	MempoolURL            string `json:"mempool_url"`
+	MempoolWebSocketURL   string `json:"mempool_websocket_url"`
+	BlockchainInfoURL     string `json:"blockchain_info_url"`
+	FearGreedURL          string `json:"fear_greed_url"`
+	FearGreedImageURL     string `json:"fear_greed_image_url"`
+	CompaniesMarketCapURL string `json:"companies_market_cap_url"`
+	CoinGeckoURL          string `json:"coingecko_url"`
+	KrakenURL             string `json:"kraken_url"`
+	CoinbaseURL           string `json:"coinbase_url"`
+	BinanceURL            string `json:"binance_url"`
+
+	// Block explorer linked from /block, without trailing slash
+	ExplorerURL string `json:"explorer_url"`
+
+	// Per-source cache TTL overrides, e.g. {"price": "15s"}
+	CacheTTLs map[string]string `json:"cache_ttls"`
+
+	// bbolt database holding the persistent storage, normally on a mounted volume
+	StoragePath string `json:"storage_path"`
+
+	// Telegram user IDs allowed to run admin commands such as /backup
+	AdminUserIDs []int64 `json:"admin_user_ids"`
+
+	// Fiat currency used by chats that have not chosen one with /currency
+	DefaultCurrency string `json:"default_currency"`
+
+	// How often price alerts are checked
+	AlertPollInterval string `json:"alert_poll_interval"`
+
+	// How often watched transactions and addresses are checked
+	ChainPollInterval string `json:"chain_poll_interval"`
+
+	// Number of updates handled concurrently, and how long a handler may take
+	Workers        int    `json:"workers"`
+	HandlerTimeout string `json:"handler_timeout"`
+
+	// How long shutdown waits for in-flight handlers and background jobs
+	ShutdownTimeout string `json:"shutdown_timeout"`
+
+	// Rate limit overrides as "<commands>/<period>", e.g. {"assets": "1/1m"}
+	RateLimits map[string]string `json:"rate_limits"`
+
+	// How long users are banned for repeatedly hitting rate limits, and
+	// whether bans are kept in storage across restarts
+	BanDuration string `json:"ban_duration"`
+	PersistBans bool   `json:"persist_bans"`
+
+	// Address of the HTTP server, which also receives webhook updates
+	ListenAddr string `json:"listen_addr"`
+
+	// How updates are received from Telegram: polling or webhook
+	UpdateMode string `json:"update_mode"`
+
+	// Public HTTPS URL Telegram posts updates to in webhook mode, and the
+	// secret token it must send along
+	WebhookURL    string `json:"webhook_url"`
+	WebhookSecret string `json:"webhook_secret"`
+}
+
+// Global configuration, loaded once at startup
+var cfg *Config
+
+// Function to build the default configuration pointing at the public APIs
+func defaultConfig() *Config {
+	return &Config{
+		MarketDataProvider:    "coingecko",
+		MempoolURL:            "https://mempool.space/api",
+		MempoolWebSocketURL:   "wss://mempool.space/api/v1/ws",
+		BlockchainInfoURL:     "https://api.blockchain.info",
+		FearGreedURL:          "https://api.alternative.me",
+		FearGreedImageURL:     "https://alternative.me/crypto/fear-and-greed-index.png",
+		CompaniesMarketCapURL: "https://companiesmarketcap.com",
+		CoinGeckoURL:          defaultCoinGeckoURL,
+		KrakenURL:             defaultKrakenURL,
+		CoinbaseURL:           defaultCoinbaseURL,
+		BinanceURL:            defaultBinanceURL,
+		ExplorerURL:           "https://mempool.space",
+		StoragePath:           "data/btcbot.db",
+		DefaultCurrency:       "usd",
+		AlertPollInterval:     "1m",
+		ChainPollInterval:     "1m",
+		Workers:               8,
+		HandlerTimeout:        "30s",
+		ShutdownTimeout:       "8s",
+		BanDuration:           "15m",
+		ListenAddr:            ":8080",
+		UpdateMode:            updateModePolling,
+	}
+}
+
+// Function to build the offline configuration where every upstream is served
+// by a local fixture server under its own path prefix, such as the one in
+// cmd/fixtureserver
+func offlineConfig(fixtureURL string) *Config {
+	fixtureURL = strings.TrimRight(fixtureURL, "/")
+
+	c := defaultConfig()
+	c.MempoolURL = fixtureURL + "/mempool/api"
+	c.MempoolWebSocketURL = "ws" + strings.TrimPrefix(fixtureURL, "http") + "/mempool/api/v1/ws"
+	c.BlockchainInfoURL = fixtureURL + "/blockchain"
+	c.FearGreedURL = fixtureURL + "/alternative"
+	c.FearGreedImageURL = fixtureURL + "/alternative/crypto/fear-and-greed-index.png"
+	c.CompaniesMarketCapURL = fixtureURL + "/companiesmarketcap"
+	c.CoinGeckoURL = fixtureURL + "/coingecko/api/v3"
+	c.KrakenURL = fixtureURL + "/kraken"
+	c.CoinbaseURL = fixtureURL + "/coinbase"
+	c.BinanceURL = fixtureURL + "/binance"
+	c.ExplorerURL = fixtureURL + "/mempool"
+	return c
+}
+
+// Function to load the configuration from the profile, config file and environment,
+// in increasing order of precedence
+func loadConfig() (*Config, error) {
+	var c *Config
+	switch profile := os.Getenv("BOT_PROFILE"); profile {
+	case "", "default":
+		c = defaultConfig()
+	case "offline":
+		fixtureURL := os.Getenv("OFFLINE_FIXTURE_URL")
+		if fixtureURL == "" {
+			fixtureURL = "http://127.0.0.1:8090"
+		}
+		c = offlineConfig(fixtureURL)
+	default:
+		return nil, fmt.Errorf("unknown profile: %s", profile)
+	}
+
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading config file: %v", err)
+		}
+		// Fields missing from the file keep their profile defaults
+		if err := json.Unmarshal(data, c); err != nil {
+			return nil, fmt.Errorf("error parsing config file: %v", err)
+		}
+		log.Println("Loaded config file:", path)
+	}
+
+	overrides := []struct {
+		env   string
+		field *string
+	}{
+		{"MARKET_DATA_PROVIDER", &c.MarketDataProvider},
+		{"MEMPOOL_URL", &c.MempoolURL},
+		{"MEMPOOL_WEBSOCKET_URL", &c.MempoolWebSocketURL},
+		{"BLOCKCHAIN_INFO_URL", &c.BlockchainInfoURL},
+		{"FEAR_GREED_URL", &c.FearGreedURL},
+		{"FEAR_GREED_IMAGE_URL", &c.FearGreedImageURL},
+		{"COMPANIES_MARKET_CAP_URL", &c.CompaniesMarketCapURL},
+		{"COINGECKO_URL", &c.CoinGeckoURL},
+		{"KRAKEN_URL", &c.KrakenURL},
+		{"COINBASE_URL", &c.CoinbaseURL},
+		{"BINANCE_URL", &c.BinanceURL},
+		{"EXPLORER_URL", &c.ExplorerURL},
+		{"STORAGE_PATH", &c.StoragePath},
+		{"DEFAULT_CURRENCY", &c.DefaultCurrency},
+		{"ALERT_POLL_INTERVAL", &c.AlertPollInterval},
+		{"CHAIN_POLL_INTERVAL", &c.ChainPollInterval},
+		{"HANDLER_TIMEOUT", &c.HandlerTimeout},
+		{"SHUTDOWN_TIMEOUT", &c.ShutdownTimeout},
+		{"BAN_DURATION", &c.BanDuration},
+		{"LISTEN_ADDR", &c.ListenAddr},
+		{"UPDATE_MODE", &c.UpdateMode},
+		{"WEBHOOK_URL", &c.WebhookURL},
+		{"WEBHOOK_SECRET", &c.WebhookSecret},
+	}
+	for _, override := range overrides {
+		if value := os.Getenv(override.env); value != "" {
+			*override.field = value
+		}
+	}
+
+	if value := os.Getenv("ADMIN_USER_IDS"); value != "" {
+		c.AdminUserIDs = nil
+		for _, field := range strings.Split(value, ",") {
+			id, err := strconv.ParseInt(strings.TrimSpace(field), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid ADMIN_USER_IDS entry: %s", field)
+			}
+			c.AdminUserIDs = append(c.AdminUserIDs, id)
+		}
+	}
+
+	if value := os.Getenv("PERSIST_BANS"); value != "" {
+		persist, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PERSIST_BANS: %s", value)
+		}
+		c.PersistBans = persist
+	}
+
+	if value := os.Getenv("WORKERS"); value != "" {
+		workers, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid WORKERS: %s", value)
+		}
+		c.Workers = workers
+	}
+	if c.Workers < 1 {
+		return nil, fmt.Errorf("workers must be at least 1")
+	}
+
+	currency, ok := lookupCurrency(c.DefaultCurrency)
+	if !ok {
+		return nil, fmt.Errorf("unsupported default currency: %s", c.DefaultCurrency)
+	}
+	c.DefaultCurrency = currency.Code
+
+	switch c.UpdateMode {
+	case updateModePolling:
+	case updateModeWebhook:
+		if !strings.HasPrefix(c.WebhookURL, "https://") {
+			return nil, fmt.Errorf("webhook mode needs an https:// webhook URL")
+		}
+		if !validWebhookSecret(c.WebhookSecret) {
+			return nil, fmt.Errorf("webhook mode needs a webhook secret of 1-256 characters A-Z, a-z, 0-9, _ and -")
+		}
+	default:
+		return nil, fmt.Errorf("unknown update mode: %s", c.UpdateMode)
+	}
+
+	for _, url := range []*string{
+		&c.MempoolURL, &c.MempoolWebSocketURL, &c.BlockchainInfoURL, &c.FearGreedURL, &c.CompaniesMarketCapURL,
+		&c.CoinGeckoURL, &c.KrakenURL, &c.CoinbaseURL, &c.BinanceURL, &c.ExplorerURL,
+	} {
+		*url = strings.TrimRight(*url, "/")
+	}
+
+	return c, nil
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+// Chat preference holding the default fiat currency
+const preferenceCurrency = "currency"
+
+// errUnsupportedCurrency is returned for arguments that are not a supported currency code
+var errUnsupportedCurrency = errors.New("unsupported currency")
+
+// Fiat currency with the conventions used to display amounts in it
+type fiatCurrency struct {
+	Code     string       // lower-case ISO code as used by the providers
+	Symbol   string       // currency symbol, including any separating space
+	Decimals int          // digits after the decimal separator
+	Locale   language.Tag // locale for digit grouping and decimal separator
+	Suffix   bool         // whether the symbol goes after the amount
+}
+
+// Supported fiat currencies by code
+var fiatCurrencies = map[string]fiatCurrency{
+	"usd": {Code: "usd", Symbol: "$", Decimals: 2, Locale: language.AmericanEnglish},
+	"eur": {Code: "eur", Symbol: " €", Decimals: 2, Locale: language.German, Suffix: true},
+	"gbp": {Code: "gbp", Symbol: "£", Decimals: 2, Locale: language.BritishEnglish},
+	"jpy": {Code: "jpy", Symbol: "¥", Decimals: 0, Locale: language.Japanese},
+	"chf": {Code: "chf", Symbol: "CHF ", Decimals: 2, Locale: language.MustParse("de-CH")},
+	"cad": {Code: "cad", Symbol: "CA$", Decimals: 2, Locale: language.MustParse("en-CA")},
+	"aud": {Code: "aud", Symbol: "A$", Decimals: 2, Locale: language.MustParse("en-AU")},
+	"cny": {Code: "cny", Symbol: "CN¥", Decimals: 2, Locale: language.SimplifiedChinese},
+	"inr": {Code: "inr", Symbol: "₹", Decimals: 2, Locale: language.MustParse("en-IN")},
+	"krw": {Code: "krw", Symbol: "₩", Decimals: 0, Locale: language.Korean},
+	"brl": {Code: "brl", Symbol: "R$ ", Decimals: 2, Locale: language.BrazilianPortuguese},
+	"sek": {Code: "sek", Symbol: " kr", Decimals: 2, Locale: language.Swedish, Suffix: true},
+	"nok": {Code: "nok", Symbol: " kr", Decimals: 2, Locale: language.Norwegian, Suffix: true},
+	"pln": {Code: "pln", Symbol: " zł", Decimals: 2, Locale: language.Polish, Suffix: true},
+	"try": {Code: "try", Symbol: "₺", Decimals: 2, Locale: language.Turkish},
+}
+
+// Helper function to look up a currency by code, case-insensitively
+func lookupCurrency(code string) (fiatCurrency, bool) {
+	currency, ok := fiatCurrencies[strings.ToLower(code)]
+	return currency, ok
+}
+
+// Helper function to list the supported currency codes
+func supportedCurrencies() string {
+	codes := make([]string, 0, len(fiatCurrencies))
+	for code := range fiatCurrencies {
+		codes = append(codes, strings.ToUpper(code))
+	}
+	sort.Strings(codes)
+	return strings.Join(codes, ", ")
+}
+
+// Helper function to attach the currency symbol to a formatted amount
+func withSymbol(amount string, currency fiatCurrency) string {
+	if currency.Suffix {
+		return amount + currency.Symbol
+	}
+	return currency.Symbol + amount
+}
+
+// Helper function to get the currency for a code, defaulting to USD for unknown codes
+func currencyOrUSD(code string) fiatCurrency {
+	currency, ok := lookupCurrency(code)
+	if !ok {
+		return fiatCurrencies["usd"]
+	}
+	return currency
+}
+
+// Helper function to format an amount with the currency symbol and the
+// currency's locale grouping, e.g. $1,234.56 or 1.234,56 €
+func formatNumber(num float64, code string) string {
+	currency := currencyOrUSD(code)
+	p := message.NewPrinter(currency.Locale)
+	return withSymbol(p.Sprintf("%.*f", currency.Decimals, num), currency)
+}
+
+// Helper function to format large amounts in a readable way, e.g. $1.3T or 1,3T €
+func formatLargeNumber(num float64, code string) string {
+	currency := currencyOrUSD(code)
+	p := message.NewPrinter(currency.Locale)
+
+	var amount string
+	if num >= 1e12 {
+		amount = p.Sprintf("%.1fT", num/1e12)
+	} else if num >= 1e9 {
+		amount = p.Sprintf("%.1fB", num/1e9)
+	} else if num >= 1e6 {
+		amount = p.Sprintf("%.1fM", num/1e6)
+	} else if num >= 1e3 {
+		amount = p.Sprintf("%.1fK", num/1e3)
+	} else {
+		amount = p.Sprintf("%.0f", num)
+	}
+	return withSymbol(amount, currency)
+}
+
+// Number of satoshis in one bitcoin
+const satsPerBTC = 100_000_000
+
+// Helper function to format an amount of satoshis in BTC, e.g. 0.00012345 BTC
+func formatBTC(sats int64) string {
+	return fmt.Sprintf("%.8f BTC", float64(sats)/satsPerBTC)
+}
+
+// Helper function to format an amount of satoshis in BTC and its value in a currency
+func formatBTCWithFiat(sats int64, price float64, code string) string {
+	return fmt.Sprintf("%s (%s)", formatBTC(sats), formatNumber(float64(sats)/satsPerBTC*price, code))
+}
+
+// Function to get the default currency of a chat
+func chatCurrency(chatID int64) string {
+	code, err := chats.preference(chatID, preferenceCurrency)
+	if err != nil {
+		log.Println("Error loading chat currency:", err)
+	}
+	if _, ok := lookupCurrency(code); ok {
+		return code
+	}
+	return cfg.DefaultCurrency
+}
+
+// Function to pick the currency for a command that takes at most a currency
+// code: the code if given, otherwise the chat default. Any other argument is
+// an unsupported currency.
+func currencyFromArgs(chatID int64, args []string) (string, error) {
+	if len(args) == 0 {
+		return chatCurrency(chatID), nil
+	}
+	currency, ok := lookupCurrency(args[0])
+	if !ok {
+		return "", fmt.Errorf("%w: %s", errUnsupportedCurrency, args[0])
+	}
+	if len(args) > 1 {
+		return "", fmt.Errorf("%w: %s", errUnsupportedCurrency, args[1])
+	}
+	return currency.Code, nil
+}
+
+// Helper function to reply to an unsupported currency
+func sendCurrencyError(chatID int64) {
+	sendMessage(chatID, "Unsupported currency. Supported: "+supportedCurrencies())
+}
+
+// Handle /currency command
+func handleCurrencyCommand(ctx context.Context, update tgbotapi.Update) {
+	chatID := update.Message.Chat.ID
+
+	arg := strings.TrimSpace(update.Message.CommandArguments())
+	if arg == "" {
+		sendMessage(chatID, fmt.Sprintf("This chat's currency is %s.\nChange it with /currency <code>, e.g. /currency eur\nSupported: %s",
+			strings.ToUpper(chatCurrency(chatID)), supportedCurrencies()))
+		return
+	}
+
+	currency, ok := lookupCurrency(arg)
+	if !ok {
+		sendMessage(chatID, "Unsupported currency. Supported: "+supportedCurrencies())
+		return
+	}
+
+	if err := chats.setPreference(chatID, preferenceCurrency, currency.Code); err != nil {
+		log.Println("Error saving chat currency:", err)
+		sendMessage(chatID, "Error saving currency.")
+		return
+	}
+	sendMessage(chatID, fmt.Sprintf("This chat's currency is now %s.", strings.ToUpper(currency.Code)))
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestFormatNumber(t *testing.T) {
+	tests := []struct {
+		num  float64
+		code string
+		want string
+	}{
+		{1234567.891, "usd", "$1,234,567.89"},
+		{1234567.891, "eur", "1.234.567,89 €"},
+		{1234567.891, "jpy", "¥1,234,568"},
+		{1234567.891, "chf", "CHF 1’234’567.89"},
+		{1234567.891, "inr", "₹12,34,567.89"},
+		{0.5, "eur", "0,50 €"},
+		{0.5, "jpy", "¥0"},
+		// Unknown codes fall back to USD
+		{1234.5, "xyz", "$1,234.50"},
+	}
+	for _, tt := range tests {
+		if got := formatNumber(tt.num, tt.code); got != tt.want {
+			t.Errorf("formatNumber(%v, %s) = %q, want %q", tt.num, tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestFormatLargeNumber(t *testing.T) {
+	tests := []struct {
+		num  float64
+		code string
+		want string
+	}{
+		{1.26e12, "usd", "$1.3T"},
+		{1.26e12, "eur", "1,3T €"},
+		{28.3e9, "jpy", "¥28.3B"},
+		{4.56e6, "chf", "CHF 4.6M"},
+		{1500, "eur", "1,5K €"},
+		{987, "eur", "987 €"},
+	}
+	for _, tt := range tests {
+		if got := formatLargeNumber(tt.num, tt.code); got != tt.want {
+			t.Errorf("formatLargeNumber(%v, %s) = %q, want %q", tt.num, tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestCurrencyFromArgs(t *testing.T) {
+	oldCfg, oldChats := cfg, chats
+	t.Cleanup(func() { cfg, chats = oldCfg, oldChats })
+	cfg = defaultConfig()
+	chats = &chatRepository{store: openTestStore(t, filepath.Join(t.TempDir(), "btcbot.db"))}
+	if err := chats.setPreference(1, preferenceCurrency, "chf"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		args    []string
+		want    string
+		wantErr bool
+	}{
+		{nil, "chf", false},
+		{[]string{"EUR"}, "eur", false},
+		{[]string{"jpy"}, "jpy", false},
+		{[]string{"xyz"}, "", true},
+		{[]string{"eur", "usd"}, "", true},
+	}
+	for _, tt := range tests {
+		got, err := currencyFromArgs(1, tt.args)
+		if tt.wantErr {
+			if !errors.Is(err, errUnsupportedCurrency) {
+				t.Errorf("currencyFromArgs(%q) = %q, %v, want an unsupported currency", tt.args, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("currencyFromArgs(%q) = %q, %v, want %q", tt.args, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Number of blocks between difficulty adjustments
+const difficultyEpoch = 2016
+
+// Number of past adjustments shown by /difficulty
+const difficultyHistoryEpochs = 4
+
+// Helper function to format a difficulty in trillions, e.g. 92.67 T
+func formatDifficulty(difficulty float64) string {
+	return fmt.Sprintf("%.2f T", difficulty/1e12)
+}
+
+// Function to project the next difficulty adjustment from the blocks of the
+// current epoch so far. The change is limited to a factor of four either way,
+// as in the consensus rules.
+func projectDifficultyAdjustment(epochStart, tip mempoolBlock) (change float64, interval time.Duration) {
+	blocks := tip.Height - epochStart.Height
+	if blocks <= 0 {
+		return 0, targetBlockInterval
+	}
+	elapsed := time.Duration(tip.Timestamp-epochStart.Timestamp) * time.Second
+	interval = elapsed / time.Duration(blocks)
+	if interval <= 0 {
+		return 300, interval
+	}
+
+	factor := float64(targetBlockInterval) / float64(interval)
+	factor = max(min(factor, 4), 0.25)
+	return (factor - 1) * 100, interval
+}
+
+// Handle /difficulty command
+func handleDifficultyCommand(ctx context.Context, update tgbotapi.Update) {
+	chatID := update.Message.Chat.ID
+
+	tipHeight, asOf, err := cached(ctx, "block", func(ctx context.Context) (int64, error) {
+		return getBTCBlockNumber(ctx)
+	})
+	if err != nil {
+		log.Println("Error fetching BTC block number:", err)
+		sendMessage(chatID, "Error fetching BTC block number.")
+		return
+	}
+
+	epochStartHeight := tipHeight - tipHeight%difficultyEpoch
+	tip, _, err := cachedBlockAtHeight(ctx, tipHeight)
+	if err != nil {
+		log.Println("Error fetching tip block:", err)
+		sendMessage(chatID, "Error fetching difficulty.")
+		return
+	}
+	epochStart, _, err := cachedBlockAtHeight(ctx, epochStartHeight)
+	if err != nil {
+		log.Println("Error fetching epoch start block:", err)
+		sendMessage(chatID, "Error fetching difficulty.")
+		return
+	}
+
+	nextAdjustment := epochStartHeight + difficultyEpoch
+	remaining := nextAdjustment - tipHeight
+	change, interval := projectDifficultyAdjustment(epochStart, tip)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "⚙️ Difficulty: %s\n", formatDifficulty(tip.Difficulty))
+	fmt.Fprintf(&b, "Epoch progress: %d of %d blocks (%.1f%%)\n", tipHeight-epochStartHeight+1, difficultyEpoch, float64(tipHeight-epochStartHeight+1)/difficultyEpoch*100)
+	if tipHeight > epochStartHeight {
+		fmt.Fprintf(&b, "Average block time: %s (target %s)\n", formatDuration(interval), formatDuration(targetBlockInterval))
+		fmt.Fprintf(&b, "Projected adjustment: %+.2f%%\n", change)
+	} else {
+		b.WriteString("Projected adjustment: not enough blocks in this epoch yet\n")
+	}
+	eta := time.Duration(remaining) * interval
+	fmt.Fprintf(&b, "Next retarget: block %d in %d blocks, about %s (%s UTC)\n", nextAdjustment, remaining, formatDuration(eta), time.Now().Add(eta).UTC().Format("2006-01-02 15:04"))
+
+	if hashrate, _, err := cached(ctx, "hashrate", func(ctx context.Context) (float64, error) {
+		return getBTCHashrate(ctx)
+	}); err == nil {
+		fmt.Fprintf(&b, "Hashrate: %.2f EH/s\n", hashrate)
+	} else {
+		log.Println("Error fetching BTC hashrate:", err)
+	}
+
+	// Past adjustments, newest first, each compared with the epoch before it
+	b.WriteString("\nRecent adjustments:\n")
+	newer := epochStart
+	for i := 1; i <= difficultyHistoryEpochs && newer.Height >= difficultyEpoch; i++ {
+		older, _, err := cachedBlockAtHeight(ctx, newer.Height-difficultyEpoch)
+		if err != nil {
+			log.Println("Error fetching difficulty history:", err)
+			b.WriteString("unavailable\n")
+			break
+		}
+		fmt.Fprintf(&b, "Block %d (%s): %s (%+.2f%%)\n", newer.Height, time.Unix(newer.Timestamp, 0).UTC().Format("2006-01-02"),
+			formatDifficulty(newer.Difficulty), (newer.Difficulty/older.Difficulty-1)*100)
+		newer = older
+	}
+
+	sendMessage(chatID, strings.TrimSuffix(b.String(), "\n")+dataAsOf(asOf))
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestProjectDifficultyAdjustment(t *testing.T) {
+	const start = 1_700_000_000
+	tests := []struct {
+		name         string
+		blocks       int64
+		elapsed      int64
+		wantChange   float64
+		wantInterval time.Duration
+	}{
+		{"on target", 1000, 600_000, 0, 10 * time.Minute},
+		{"faster blocks", 1000, 500_000, 20, 500 * time.Second},
+		{"slower blocks", 1000, 750_000, -20, 750 * time.Second},
+		{"clamped at 4x", 1000, 100_000, 300, 100 * time.Second},
+		{"at 4x", 1000, 150_000, 300, 150 * time.Second},
+		{"clamped at a quarter", 1000, 3_000_000, -75, 3000 * time.Second},
+		{"at a quarter", 1000, 2_400_000, -75, 2400 * time.Second},
+		{"no blocks yet", 0, 0, 0, 10 * time.Minute},
+		// Block timestamps may go backwards
+		{"timestamps out of order", 2, -60, 300, -30 * time.Second},
+	}
+	for _, tt := range tests {
+		epochStart := mempoolBlock{Height: 838_656, Timestamp: start}
+		tip := mempoolBlock{Height: 838_656 + tt.blocks, Timestamp: start + tt.elapsed}
+		change, interval := projectDifficultyAdjustment(epochStart, tip)
+		if math.Abs(change-tt.wantChange) > 1e-9 || interval != tt.wantInterval {
+			t.Errorf("%s: got %.2f%% at %s, want %.2f%% at %s", tt.name, change, interval, tt.wantChange, tt.wantInterval)
+		}
+	}
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // Embed the time zone database so /subscribe works on minimal images
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// How often the scheduler checks for due digests
+const digestSchedulerInterval = 30 * time.Second
+
+// Digest subscription of a chat. A chat has at most one daily and one weekly subscription.
+type digestSubscription struct {
+	ChatID    int64     `json:"chat_id"`
+	Frequency string    `json:"frequency"` // "daily" or "weekly"
+	Weekday   int       `json:"weekday"`   // time.Weekday, weekly subscriptions only
+	Hour      int       `json:"hour"`
+	Minute    int       `json:"minute"`
+	TimeZone  string    `json:"time_zone"`
+	LastSent  time.Time `json:"last_sent"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Helper function to build the storage key of a subscription
+func subscriptionKey(chatID int64, frequency string) string {
+	return fmt.Sprintf("%d:%s", chatID, frequency)
+}
+
+// Function to find the most recent scheduled delivery at or before now
+func (s digestSubscription) lastScheduled(now time.Time) (time.Time, error) {
+	loc, err := time.LoadLocation(s.TimeZone)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	local := now.In(loc)
+	scheduled := time.Date(local.Year(), local.Month(), local.Day(), s.Hour, s.Minute, 0, 0, loc)
+
+	step := 1
+	if s.Frequency == "weekly" {
+		step = 7
+		daysSince := (int(local.Weekday()) - s.Weekday + 7) % 7
+		scheduled = scheduled.AddDate(0, 0, -daysSince)
+	}
+	if scheduled.After(local) {
+		scheduled = scheduled.AddDate(0, 0, -step)
+	}
+	return scheduled, nil
+}
+
+// Helper function to describe when a subscription is delivered
+func (s digestSubscription) describe() string {
+	if s.Frequency == "weekly" {
+		return fmt.Sprintf("weekly on %s at %02d:%02d %s", time.Weekday(s.Weekday), s.Hour, s.Minute, s.TimeZone)
+	}
+	return fmt.Sprintf("daily at %02d:%02d %s", s.Hour, s.Minute, s.TimeZone)
+}
+
+// subscriptionRepository stores digest subscriptions in the subscriptions bucket
+type subscriptionRepository struct {
+	store *Store
+}
+
+// Global subscription repository
+var subscriptions *subscriptionRepository
+
+// Function to call fn for every stored subscription
+func forEachSubscription(tx *storeTx, fn func(sub digestSubscription) error) error {
+	return tx.ForEach(bucketSubscriptions, func(key string, raw json.RawMessage) error {
+		var sub digestSubscription
+		if err := json.Unmarshal(raw, &sub); err != nil {
+			return fmt.Errorf("error decoding subscription %s: %v", key, err)
+		}
+		return fn(sub)
+	})
+}
+
+// Function to create or replace a subscription
+func (r *subscriptionRepository) save(sub digestSubscription) error {
+	return r.store.Update(func(tx *storeTx) error {
+		return tx.Put(bucketSubscriptions, subscriptionKey(sub.ChatID, sub.Frequency), sub)
+	})
+}
+
+// Function to list all subscriptions, or those of one chat if chatID is not 0
+func (r *subscriptionRepository) list(chatID int64) ([]digestSubscription, error) {
+	var result []digestSubscription
+	err := r.store.View(func(tx *storeTx) error {
+		return forEachSubscription(tx, func(sub digestSubscription) error {
+			if chatID == 0 || sub.ChatID == chatID {
+				result = append(result, sub)
+			}
+			return nil
+		})
+	})
+	return result, err
+}
+
+// Function to remove subscriptions of a chat. An empty frequency removes all of them.
+func (r *subscriptionRepository) remove(chatID int64, frequency string) (int, error) {
+	removed := 0
+	err := r.store.Update(func(tx *storeTx) error {
+		return forEachSubscription(tx, func(sub digestSubscription) error {
+			if sub.ChatID == chatID && (frequency == "" || sub.Frequency == frequency) {
+				tx.Delete(bucketSubscriptions, subscriptionKey(sub.ChatID, sub.Frequency))
+				removed++
+			}
+			return nil
+		})
+	})
+	return removed, err
+}
+
+// Function to record that a subscription was delivered
+func (r *subscriptionRepository) markSent(sub digestSubscription, sentAt time.Time) error {
+	return r.store.Update(func(tx *storeTx) error {
+		key := subscriptionKey(sub.ChatID, sub.Frequency)
+		var current digestSubscription
+		found, err := tx.Get(bucketSubscriptions, key, &current)
+		if err != nil || !found {
+			// Unsubscribed while the digest was being sent
+			return err
+		}
+		current.LastSent = sentAt
+		return tx.Put(bucketSubscriptions, key, current)
+	})
+}
+
+// Function to build the digest message from the data behind /btc, /change, /fees, /feargreed and /hashrate
+func buildDigest(ctx context.Context, title, currency string) string {
+	message := fmt.Sprintf("📰 %s — %s\n\n", title, time.Now().UTC().Format("Mon, 2 Jan 2006"))
+
+	currentPrice, _, err := getPrice(ctx, bitcoinID, currency)
+	if err != nil {
+		log.Println("Error fetching BTC price for digest:", err)
+		message += "💰 Price: unavailable\n\n"
+	} else {
+		message += fmt.Sprintf("💰 Price: %s\n\n", formatNumber(currentPrice, currency))
+
+		historicalData, _, err := getHistoricalData(ctx, bitcoinID, currency)
+		if err != nil {
+			log.Println("Error fetching historical data for digest:", err)
+			message += "📈 Change: unavailable\n\n"
+		} else {
+			message += "📈 Change:\n" + formatPriceChanges(currentPrice, historicalData) + "\n"
+		}
+	}
+
+	low, medium, high, _, err := getBTCFees(ctx, currency, defaultTxShape.vsize())
+	if err != nil {
+		log.Println("Error fetching BTC fees for digest:", err)
+		message += "⛽ Fees: unavailable\n"
+	} else {
+		message += fmt.Sprintf("⛽ Fees: Low %s / Medium %s / High %s\n",
+			formatNumber(low, currency), formatNumber(medium, currency), formatNumber(high, currency))
+	}
+
+	index, _, err := cached(ctx, "feargreed", func(ctx context.Context) (int, error) {
+		return getFearGreedIndex(ctx)
+	})
+	if err != nil {
+		log.Println("Error fetching Fear & Greed Index for digest:", err)
+		message += "😨 Fear & Greed Index: unavailable\n"
+	} else {
+		message += fmt.Sprintf("😨 Fear & Greed Index: %d\n", index)
+	}
+
+	hashrate, _, err := cached(ctx, "hashrate", func(ctx context.Context) (float64, error) {
+		return getBTCHashrate(ctx)
+	})
+	if err != nil {
+		log.Println("Error fetching BTC hashrate for digest:", err)
+		message += "⛏ Hashrate: unavailable\n"
+	} else {
+		message += fmt.Sprintf("⛏ Hashrate: %.2f EH/s\n", hashrate)
+	}
+
+	return message
+}
+
+// Function to deliver due digests until the process exits. Runs missed
+// deliveries once on startup, so downtime delays a digest rather than dropping it.
+func runDigestScheduler(ctx context.Context) {
+	log.Println("Starting digest scheduler")
+	ticker := time.NewTicker(digestSchedulerInterval)
+	defer ticker.Stop()
+
+	for {
+		deliverDueDigests(ctx, time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Function to send every digest whose scheduled time has passed since it was last sent
+func deliverDueDigests(ctx context.Context, now time.Time) {
+	subs, err := subscriptions.list(0)
+	if err != nil {
+		log.Println("Error loading subscriptions:", err)
+		return
+	}
+
+	for _, sub := range subs {
+		scheduled, err := sub.lastScheduled(now)
+		if err != nil {
+			log.Printf("Invalid time zone for subscription %s: %v", subscriptionKey(sub.ChatID, sub.Frequency), err)
+			continue
+		}
+		if !sub.LastSent.Before(scheduled) {
+			continue
+		}
+
+		title := "Daily BTC digest"
+		if sub.Frequency == "weekly" {
+			title = "Weekly BTC digest"
+		}
+		message := buildDigest(ctx, title, chatCurrency(sub.ChatID))
+
+		// Let the chat know when this is a catch-up after downtime
+		if now.Sub(scheduled) > 2*digestSchedulerInterval {
+			message += fmt.Sprintf("\n(Delayed: scheduled for %s)", scheduled.Format("Jan 2 15:04 MST"))
+		}
+
+		sendMessage(sub.ChatID, message)
+		if err := subscriptions.markSent(sub, now); err != nil {
+			log.Println("Error saving subscription:", err)
+		}
+	}
+}
+
+// Helper function to parse a weekday name such as mon or Monday
+func parseWeekday(text string) (time.Weekday, bool) {
+	text = strings.ToLower(text)
+	if len(text) < 3 {
+		return 0, false
+	}
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if strings.HasPrefix(strings.ToLower(day.String()), text) {
+			return day, true
+		}
+	}
+	return 0, false
+}
+
+// Helper function to parse a time of day such as 08:00
+func parseTimeOfDay(text string) (int, int, bool) {
+	hourText, minuteText, ok := strings.Cut(text, ":")
+	if !ok {
+		return 0, 0, false
+	}
+	hour, err := strconv.Atoi(hourText)
+	if err != nil || hour < 0 || hour > 23 {
+		return 0, 0, false
+	}
+	minute, err := strconv.Atoi(minuteText)
+	if err != nil || minute < 0 || minute > 59 {
+		return 0, 0, false
+	}
+	return hour, minute, true
+}
+
+// Handle /subscribe command
+func handleSubscribeCommand(ctx context.Context, update tgbotapi.Update) {
+	chatID := update.Message.Chat.ID
+	usage := "Usage: /subscribe daily 08:00 [time zone] or /subscribe weekly monday 08:00 [time zone]\nExample: /subscribe daily 08:00 Europe/Berlin"
+
+	args := strings.Fields(update.Message.CommandArguments())
+	if len(args) == 0 {
+		subs, err := subscriptions.list(chatID)
+		if err != nil {
+			log.Println("Error loading subscriptions:", err)
+			sendMessage(chatID, "Error loading subscriptions.")
+			return
+		}
+		if len(subs) == 0 {
+			sendMessage(chatID, "This chat has no digest subscriptions.\n\n"+usage)
+			return
+		}
+		message := "Digest subscriptions:\n"
+		for _, sub := range subs {
+			message += "• " + sub.describe() + "\n"
+		}
+		sendMessage(chatID, message)
+		return
+	}
+
+	sub := digestSubscription{ChatID: chatID, Frequency: strings.ToLower(args[0]), TimeZone: "UTC"}
+	args = args[1:]
+
+	switch sub.Frequency {
+	case "daily":
+	case "weekly":
+		if len(args) == 0 {
+			sendMessage(chatID, usage)
+			return
+		}
+		weekday, ok := parseWeekday(args[0])
+		if !ok {
+			sendMessage(chatID, "Invalid weekday. Example: /subscribe weekly monday 08:00")
+			return
+		}
+		sub.Weekday = int(weekday)
+		args = args[1:]
+	default:
+		sendMessage(chatID, usage)
+		return
+	}
+
+	if len(args) == 0 || len(args) > 2 {
+		sendMessage(chatID, usage)
+		return
+	}
+
+	var ok bool
+	sub.Hour, sub.Minute, ok = parseTimeOfDay(args[0])
+	if !ok {
+		sendMessage(chatID, "Invalid time. Use HH:MM, e.g. 08:00")
+		return
+	}
+
+	if len(args) == 2 {
+		if _, err := time.LoadLocation(args[1]); err != nil {
+			sendMessage(chatID, "Unknown time zone. Use a name like Europe/Berlin or America/New_York.")
+			return
+		}
+		sub.TimeZone = args[1]
+	}
+
+	// Don't deliver the slot that has already passed today
+	sub.CreatedAt = time.Now()
+	sub.LastSent = sub.CreatedAt
+
+	if err := subscriptions.save(sub); err != nil {
+		log.Println("Error saving subscription:", err)
+		sendMessage(chatID, "Error saving subscription.")
+		return
+	}
+
+	sendMessage(chatID, fmt.Sprintf("Subscribed: digest %s. Use /unsubscribe to stop.", sub.describe()))
+}
+
+// Handle /unsubscribe command
+func handleUnsubscribeCommand(ctx context.Context, update tgbotapi.Update) {
+	chatID := update.Message.Chat.ID
+
+	frequency := strings.ToLower(strings.TrimSpace(update.Message.CommandArguments()))
+	if frequency != "" && frequency != "daily" && frequency != "weekly" {
+		sendMessage(chatID, "Usage: /unsubscribe [daily|weekly]")
+		return
+	}
+
+	removed, err := subscriptions.remove(chatID, frequency)
+	if err != nil {
+		log.Println("Error removing subscription:", err)
+		sendMessage(chatID, "Error removing subscription.")
+		return
+	}
+
+	if removed == 0 {
+		sendMessage(chatID, "This chat has no matching digest subscription.")
+		return
+	}
+	sendMessage(chatID, fmt.Sprintf("Unsubscribed from %d digest(s).", removed))
+}
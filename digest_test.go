@@ -0,0 +1,66 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLastScheduled(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	utc := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2024, month, day, hour, minute, 0, 0, time.UTC)
+	}
+	daily := func(hour, minute int, zone string) digestSubscription {
+		return digestSubscription{Frequency: "daily", Hour: hour, Minute: minute, TimeZone: zone}
+	}
+	weekly := func(day time.Weekday, hour, minute int, zone string) digestSubscription {
+		return digestSubscription{Frequency: "weekly", Weekday: int(day), Hour: hour, Minute: minute, TimeZone: zone}
+	}
+
+	tests := []struct {
+		name string
+		sub  digestSubscription
+		now  time.Time
+		want time.Time
+	}{
+		{"later today", daily(8, 0, "UTC"), utc(4, 20, 9, 0), utc(4, 20, 8, 0)},
+		{"not yet today", daily(8, 0, "UTC"), utc(4, 20, 7, 59), utc(4, 19, 8, 0)},
+		{"exactly on time", daily(8, 0, "UTC"), utc(4, 20, 8, 0), utc(4, 20, 8, 0)},
+		{"at midnight", daily(0, 0, "UTC"), utc(4, 20, 0, 0), utc(4, 20, 0, 0)},
+		{"before midnight", daily(0, 0, "UTC"), utc(4, 19, 23, 59), utc(4, 19, 0, 0)},
+		// 00:10 in Berlin is still the previous day in UTC
+		{"local day ahead of UTC", daily(23, 30, "Europe/Berlin"), utc(4, 19, 22, 10), utc(4, 19, 21, 30)},
+		{"local midnight", daily(0, 0, "Europe/Berlin"), utc(4, 19, 22, 0), utc(4, 19, 22, 0)},
+		// Clocks go forward on March 31 and back on October 27, so the
+		// deliveries before and after are 23 and 25 hours apart
+		{"after DST starts", daily(8, 0, "Europe/Berlin"), utc(3, 31, 8, 0), utc(3, 31, 6, 0)},
+		{"before DST starts", daily(8, 0, "Europe/Berlin"), utc(3, 31, 5, 0), utc(3, 30, 7, 0)},
+		{"after DST ends", daily(8, 0, "Europe/Berlin"), utc(10, 27, 8, 0), utc(10, 27, 7, 0)},
+		{"before DST ends", daily(8, 0, "Europe/Berlin"), utc(10, 27, 6, 0), utc(10, 26, 6, 0)},
+		// 02:30 does not exist when clocks go forward and happens twice when they go back
+		{"skipped time", daily(2, 30, "Europe/Berlin"), utc(3, 31, 3, 0), time.Date(2024, 3, 31, 3, 30, 0, 0, berlin)},
+		{"repeated time", daily(2, 30, "Europe/Berlin"), utc(10, 27, 3, 0), utc(10, 27, 1, 30)},
+		// April 22, 2024 is a Monday
+		{"weekly later today", weekly(time.Monday, 9, 0, "UTC"), utc(4, 22, 10, 0), utc(4, 22, 9, 0)},
+		{"weekly not yet today", weekly(time.Monday, 9, 0, "UTC"), utc(4, 22, 8, 0), utc(4, 15, 9, 0)},
+		{"weekly day before", weekly(time.Monday, 9, 0, "UTC"), utc(4, 21, 23, 59), utc(4, 15, 9, 0)},
+		{"weekly day after", weekly(time.Monday, 9, 0, "UTC"), utc(4, 23, 0, 0), utc(4, 22, 9, 0)},
+		{"weekly on Sunday", weekly(time.Sunday, 0, 0, "UTC"), utc(4, 22, 0, 0), utc(4, 21, 0, 0)},
+		// Sunday 00:30 in Berlin is still Saturday in UTC
+		{"weekly across midnight", weekly(time.Sunday, 0, 15, "Europe/Berlin"), utc(4, 20, 22, 30), utc(4, 20, 22, 15)},
+		{"weekly across DST", weekly(time.Sunday, 8, 0, "Europe/Berlin"), utc(4, 6, 12, 0), utc(3, 31, 6, 0)},
+	}
+	for _, tt := range tests {
+		got, err := tt.sub.lastScheduled(tt.now)
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("%s: lastScheduled(%s) = %s, %v, want %s", tt.name, tt.now, got.UTC(), err, tt.want.UTC())
+		}
+	}
+
+	if _, err := daily(8, 0, "Mars/Olympus_Mons").lastScheduled(utc(4, 20, 9, 0)); err == nil {
+		t.Error("lastScheduled accepted an unknown time zone")
+	}
+}
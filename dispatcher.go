@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Largest number of updates queued for a chat while one of its updates is
+// being handled. Further updates of that chat are dropped.
+const maxQueuedUpdatesPerChat = 20
+
+// dispatcher handles updates on a bounded number of concurrent workers. Updates
+// of the same chat are handled one at a time, in the order they arrived. Once
+// its context is done it starts no more handlers, so the updates still queued
+// can be delivered again after a restart.
+type dispatcher struct {
+	ctx     context.Context
+	timeout time.Duration
+	slots   chan struct{}
+	handler func(ctx context.Context, update tgbotapi.Update)
+	// Called for updates dropped because their chat has too many queued
+	dropped func(update tgbotapi.Update)
+
+	mu sync.Mutex
+	// Updates waiting per chat. A chat has an entry, possibly empty, while
+	// one of its updates is being handled.
+	pending map[int64][]tgbotapi.Update
+	// Chats already told about a dropped update since their queue last emptied
+	warned map[int64]bool
+	// IDs of updates accepted but not handled to the end before the context was done
+	unhandled map[int]bool
+	wg        sync.WaitGroup
+	// Closed once the update channel is closed and all its updates are dispatched
+	done chan struct{}
+}
+
+// Function to create a dispatcher running handler on at most workers updates
+// at once, each with the given timeout. dropped is told about updates
+// dropped from a full queue, once until the queue empties.
+func newDispatcher(ctx context.Context, workers int, timeout time.Duration, handler func(ctx context.Context, update tgbotapi.Update), dropped func(update tgbotapi.Update)) *dispatcher {
+	return &dispatcher{
+		ctx:       ctx,
+		timeout:   timeout,
+		slots:     make(chan struct{}, workers),
+		handler:   handler,
+		dropped:   dropped,
+		pending:   make(map[int64][]tgbotapi.Update),
+		warned:    make(map[int64]bool),
+		unhandled: make(map[int]bool),
+		done:      make(chan struct{}),
+	}
+}
+
+// Helper function to get the queue an update goes in: its chat, or for
+// updates without a chat such as inline queries its sender, whose ID is also
+// that of their private chat. Updates with neither share queue 0.
+func updateQueueKey(update tgbotapi.Update) int64 {
+	if chat := update.FromChat(); chat != nil {
+		return chat.ID
+	}
+	if user := update.SentFrom(); user != nil {
+		return user.ID
+	}
+	return 0
+}
+
+// Function to tell a chat that its update was dropped
+func notifyDroppedUpdate(update tgbotapi.Update) {
+	if chat := update.FromChat(); chat != nil {
+		sendMessage(chat.ID, "Too many commands at once, some were skipped. Please wait for the answers before sending more.")
+	}
+}
+
+// Function to dispatch updates until the channel is closed
+func (d *dispatcher) run(updates tgbotapi.UpdatesChannel) {
+	defer close(d.done)
+	for update := range updates {
+		d.dispatch(update)
+	}
+}
+
+// Function to wait until the update channel is closed and all its updates are
+// handled. Returns false if handlers are still running after the timeout.
+func (d *dispatcher) wait(timeout time.Duration) bool {
+	drained := make(chan struct{})
+	go func() {
+		<-d.done
+		d.wg.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// Function to get the lowest ID of the updates that were not handled to the
+// end, if any. Telegram should deliver them again after a restart.
+func (d *dispatcher) firstUnhandled() (int, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	first, found := 0, false
+	for id := range d.unhandled {
+		if !found || id < first {
+			first, found = id, true
+		}
+	}
+	return first, found
+}
+
+// Function to hand an update to a worker, or queue it behind the update its
+// chat is already handling. Blocks while all workers are busy.
+func (d *dispatcher) dispatch(update tgbotapi.Update) {
+	chatID := updateQueueKey(update)
+
+	d.mu.Lock()
+	if d.ctx.Err() != nil {
+		d.unhandled[update.UpdateID] = true
+		d.mu.Unlock()
+		return
+	}
+	if queue, busy := d.pending[chatID]; busy {
+		if len(queue) >= maxQueuedUpdatesPerChat {
+			warn := !d.warned[chatID]
+			d.warned[chatID] = true
+			d.mu.Unlock()
+			log.Printf("Dropping update %d, chat %d has too many queued updates", update.UpdateID, chatID)
+			if warn {
+				// Sending must not hold up dispatching the updates of other chats
+				d.wg.Add(1)
+				go func() {
+					defer d.wg.Done()
+					d.dropped(update)
+				}()
+			}
+			return
+		}
+		d.pending[chatID] = append(queue, update)
+		d.unhandled[update.UpdateID] = true
+		d.mu.Unlock()
+		return
+	}
+	d.pending[chatID] = nil
+	d.unhandled[update.UpdateID] = true
+	d.mu.Unlock()
+
+	select {
+	case d.slots <- struct{}{}:
+	case <-d.ctx.Done():
+		// No update of the chat was queued meanwhile, as only run dispatches
+		d.mu.Lock()
+		delete(d.pending, chatID)
+		d.mu.Unlock()
+		return
+	}
+	d.wg.Add(1)
+	go d.work(chatID, update)
+}
+
+// Function to handle an update and then the updates queued behind it for the same chat
+func (d *dispatcher) work(chatID int64, update tgbotapi.Update) {
+	defer d.wg.Done()
+	defer func() { <-d.slots }()
+
+	for {
+		finished := d.handle(update)
+
+		d.mu.Lock()
+		if finished {
+			delete(d.unhandled, update.UpdateID)
+		}
+		// Once stopping, the queued updates are left unhandled rather than run
+		// with a cancelled context
+		queue := d.pending[chatID]
+		if len(queue) == 0 || d.ctx.Err() != nil {
+			delete(d.pending, chatID)
+			delete(d.warned, chatID)
+			d.mu.Unlock()
+			return
+		}
+		update = queue[0]
+		d.pending[chatID] = queue[1:]
+		d.mu.Unlock()
+	}
+}
+
+// Function to handle one update with its own timeout. Returns false if the
+// dispatcher was stopped before the handler returned.
+func (d *dispatcher) handle(update tgbotapi.Update) bool {
+	ctx, cancel := context.WithTimeout(d.ctx, d.timeout)
+	defer cancel()
+
+	start := time.Now()
+	d.handler(ctx, update)
+	if ctx.Err() == context.DeadlineExceeded {
+		log.Printf("Update %d timed out after %s", update.UpdateID, time.Since(start).Round(time.Millisecond))
+	}
+	return d.ctx.Err() == nil
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Helper function to build a message update in a chat
+func chatUpdate(id int, chatID int64) tgbotapi.Update {
+	return tgbotapi.Update{UpdateID: id, Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: chatID}}}
+}
+
+// recordingHandler records the updates handled per queue and blocks the
+// handlers of gated queues until released
+type recordingHandler struct {
+	mu      sync.Mutex
+	handled map[int64][]int
+	dropped []int
+	gates   map[int64]chan struct{}
+	started chan int64
+}
+
+func newRecordingHandler(gated ...int64) *recordingHandler {
+	h := &recordingHandler{
+		handled: make(map[int64][]int),
+		gates:   make(map[int64]chan struct{}),
+		started: make(chan int64, 100),
+	}
+	for _, key := range gated {
+		h.gates[key] = make(chan struct{})
+	}
+	return h
+}
+
+func (h *recordingHandler) handle(ctx context.Context, update tgbotapi.Update) {
+	key := updateQueueKey(update)
+	h.started <- key
+	if gate, ok := h.gates[key]; ok {
+		<-gate
+	}
+	h.mu.Lock()
+	h.handled[key] = append(h.handled[key], update.UpdateID)
+	h.mu.Unlock()
+}
+
+func (h *recordingHandler) drop(update tgbotapi.Update) {
+	h.mu.Lock()
+	h.dropped = append(h.dropped, update.UpdateID)
+	h.mu.Unlock()
+}
+
+func TestUpdateQueueKey(t *testing.T) {
+	user := &tgbotapi.User{ID: 42}
+	tests := []struct {
+		name   string
+		update tgbotapi.Update
+		want   int64
+	}{
+		{"group message", chatUpdate(1, -100), -100},
+		{"private message", tgbotapi.Update{Message: &tgbotapi.Message{From: user, Chat: &tgbotapi.Chat{ID: 42}}}, 42},
+		{"callback query", tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{From: user, Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: -100}}}}, -100},
+		{"inline query", tgbotapi.Update{InlineQuery: &tgbotapi.InlineQuery{From: user}}, 42},
+		{"chosen inline result", tgbotapi.Update{ChosenInlineResult: &tgbotapi.ChosenInlineResult{From: user}}, 42},
+		{"poll", tgbotapi.Update{Poll: &tgbotapi.Poll{ID: "1"}}, 0},
+	}
+	for _, tt := range tests {
+		if got := updateQueueKey(tt.update); got != tt.want {
+			t.Errorf("%s: queue %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDispatcherOrdersUpdatesPerChat(t *testing.T) {
+	h := newRecordingHandler(1)
+	d := newDispatcher(context.Background(), 4, time.Second, h.handle, h.drop)
+
+	updates := make(chan tgbotapi.Update)
+	go d.run(updates)
+
+	// Chat 1 is held up by its first update, chats 2 and 3 are not
+	updates <- chatUpdate(1, 1)
+	<-h.started
+	for id := 2; id <= 10; id++ {
+		updates <- chatUpdate(id, int64(1+id%3))
+	}
+	close(updates)
+
+	// The other chats are handled while chat 1 is still busy
+	time.Sleep(20 * time.Millisecond)
+	h.mu.Lock()
+	if len(h.handled[1]) != 0 || len(h.handled[2]) == 0 || len(h.handled[3]) == 0 {
+		t.Errorf("handled %v while chat 1 was blocked", h.handled)
+	}
+	h.mu.Unlock()
+
+	close(h.gates[1])
+	if !d.wait(time.Second) {
+		t.Fatal("dispatcher did not drain")
+	}
+
+	want := map[int64][]int{1: {1, 3, 6, 9}, 2: {4, 7, 10}, 3: {2, 5, 8}}
+	for chatID, ids := range want {
+		got := h.handled[chatID]
+		if len(got) != len(ids) {
+			t.Errorf("chat %d handled %v, want %v", chatID, got, ids)
+			continue
+		}
+		for i := range ids {
+			if got[i] != ids[i] {
+				t.Errorf("chat %d handled %v, want %v", chatID, got, ids)
+				break
+			}
+		}
+	}
+}
+
+func TestDispatcherLimitsWorkers(t *testing.T) {
+	h := newRecordingHandler(1, 2, 3)
+	d := newDispatcher(context.Background(), 2, time.Second, h.handle, h.drop)
+
+	d.dispatch(chatUpdate(1, 1))
+	d.dispatch(chatUpdate(2, 2))
+	third := make(chan struct{})
+	go func() {
+		d.dispatch(chatUpdate(3, 3))
+		close(third)
+	}()
+
+	<-h.started
+	<-h.started
+	select {
+	case <-third:
+		t.Fatal("a third worker started while both were busy")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(h.gates[1])
+	<-third
+	if key := <-h.started; key != 3 {
+		t.Errorf("started chat %d, want 3", key)
+	}
+	close(h.gates[2])
+	close(h.gates[3])
+	d.wg.Wait()
+}
+
+func TestDispatcherDropsOverflow(t *testing.T) {
+	h := newRecordingHandler(1)
+	d := newDispatcher(context.Background(), 4, time.Second, h.handle, h.drop)
+
+	// One update being handled, a full queue and five more
+	d.dispatch(chatUpdate(0, 1))
+	<-h.started
+	for id := 1; id <= maxQueuedUpdatesPerChat+5; id++ {
+		d.dispatch(chatUpdate(id, 1))
+	}
+	// Another chat is unaffected
+	d.dispatch(chatUpdate(100, 2))
+
+	close(h.gates[1])
+	d.wg.Wait()
+
+	if got := len(h.handled[1]); got != maxQueuedUpdatesPerChat+1 {
+		t.Errorf("handled %d updates of chat 1, want %d", got, maxQueuedUpdatesPerChat+1)
+	}
+	if got := len(h.handled[2]); got != 1 {
+		t.Errorf("handled %d updates of chat 2, want 1", got)
+	}
+	// The chat is told once about the first dropped update
+	if len(h.dropped) != 1 || h.dropped[0] != maxQueuedUpdatesPerChat+1 {
+		t.Errorf("told about dropped updates %v, want [%d]", h.dropped, maxQueuedUpdatesPerChat+1)
+	}
+
+	// Once the queue has emptied the chat is told again
+	h.gates[1] = make(chan struct{})
+	d.dispatch(chatUpdate(200, 1))
+	<-h.started
+	for id := 201; id <= 201+maxQueuedUpdatesPerChat; id++ {
+		d.dispatch(chatUpdate(id, 1))
+	}
+	close(h.gates[1])
+	d.wg.Wait()
+	if len(h.dropped) != 2 {
+		t.Errorf("told about %d dropped updates, want 2", len(h.dropped))
+	}
+}
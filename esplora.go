@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Transaction output as returned by the esplora API
+type esploraOutput struct {
+	ScriptPubKey        string `json:"scriptpubkey"`
+	ScriptPubKeyType    string `json:"scriptpubkey_type"`
+	ScriptPubKeyAddress string `json:"scriptpubkey_address"`
+	Value               int64  `json:"value"`
+}
+
+// Transaction input as returned by the esplora API
+type esploraInput struct {
+	Txid       string         `json:"txid"`
+	Vout       uint32         `json:"vout"`
+	Prevout    *esploraOutput `json:"prevout"`
+	Sequence   uint32         `json:"sequence"`
+	IsCoinbase bool           `json:"is_coinbase"`
+}
+
+// Confirmation status of a transaction
+type esploraStatus struct {
+	Confirmed   bool   `json:"confirmed"`
+	BlockHeight int64  `json:"block_height"`
+	BlockHash   string `json:"block_hash"`
+	BlockTime   int64  `json:"block_time"`
+}
+
+// Transaction as returned by the esplora API
+type esploraTx struct {
+	Txid     string          `json:"txid"`
+	Version  int32           `json:"version"`
+	Locktime uint32          `json:"locktime"`
+	Vin      []esploraInput  `json:"vin"`
+	Vout     []esploraOutput `json:"vout"`
+	Size     int64           `json:"size"`
+	Weight   int64           `json:"weight"`
+	Fee      int64           `json:"fee"`
+	Status   esploraStatus   `json:"status"`
+}
+
+// Function to get the virtual size of a transaction in vbytes
+func (tx esploraTx) vsize() int64 {
+	return (tx.Weight + 3) / 4
+}
+
+// Function to get the fee rate of a transaction in sat/vB
+func (tx esploraTx) feeRate() float64 {
+	if tx.Weight == 0 {
+		return 0
+	}
+	return float64(tx.Fee) / float64(tx.vsize())
+}
+
+// Function to check whether a transaction opts in to replace-by-fee (BIP 125)
+func (tx esploraTx) signalsRBF() bool {
+	for _, input := range tx.Vin {
+		if input.Sequence < 0xfffffffe {
+			return true
+		}
+	}
+	return false
+}
+
+// Function to check whether a transaction is a coinbase transaction
+func (tx esploraTx) isCoinbase() bool {
+	return len(tx.Vin) == 1 && tx.Vin[0].IsCoinbase
+}
+
+// Function to sum the values of the inputs and outputs of a transaction in sats
+func (tx esploraTx) totals() (in int64, out int64) {
+	for _, input := range tx.Vin {
+		if input.Prevout != nil {
+			in += input.Prevout.Value
+		}
+	}
+	for _, output := range tx.Vout {
+		out += output.Value
+	}
+	return in, out
+}
+
+// Helper function to check that a string is a 64-character hex transaction or block hash
+func isHash(s string) bool {
+	if len(s) != 64 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// Function to fetch a transaction from the esplora API
+func getTransaction(ctx context.Context, txid string) (esploraTx, error) {
+	var tx esploraTx
+	if err := fetchJSON(ctx, fmt.Sprintf("%s/tx/%s", cfg.MempoolURL, strings.ToLower(txid)), &tx); err != nil {
+		return esploraTx{}, fmt.Errorf("error fetching transaction: %w", err)
+	}
+	return tx, nil
+}
+
+// Spending status of a transaction output
+type esploraOutspend struct {
+	Spent  bool          `json:"spent"`
+	Txid   string        `json:"txid"`
+	Vin    int           `json:"vin"`
+	Status esploraStatus `json:"status"`
+}
+
+// Function to fetch which transaction, if any, spends an output
+func getOutspend(ctx context.Context, txid string, vout uint32) (esploraOutspend, error) {
+	var outspend esploraOutspend
+	if err := fetchJSON(ctx, fmt.Sprintf("%s/tx/%s/outspend/%d", cfg.MempoolURL, txid, vout), &outspend); err != nil {
+		return esploraOutspend{}, fmt.Errorf("error fetching outspend: %w", err)
+	}
+	return outspend, nil
+}
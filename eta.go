@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Block the mempool is projected to produce next, as returned by the mempool API
+type projectedBlock struct {
+	BlockVSize float64   `json:"blockVSize"`
+	NTx        int64     `json:"nTx"`
+	TotalFees  int64     `json:"totalFees"`
+	MedianFee  float64   `json:"medianFee"`
+	FeeRange   []float64 `json:"feeRange"`
+}
+
+// Function to fetch the projected next blocks from mempool
+func getProjectedBlocks(ctx context.Context) ([]projectedBlock, error) {
+	var blocks []projectedBlock
+	if err := fetchJSON(ctx, cfg.MempoolURL+"/v1/fees/mempool-blocks", &blocks); err != nil {
+		return nil, fmt.Errorf("error fetching projected blocks: %w", err)
+	}
+	return blocks, nil
+}
+
+// Function to estimate in which projected block a transaction paying a fee
+// rate confirms. Returns 0 if it is below all projected blocks. The last
+// projected block holds the rest of the mempool, so it is only a lower bound.
+func projectedConfirmation(blocks []projectedBlock, rate float64) int {
+	if len(blocks) == 0 {
+		return 1
+	}
+	for i, block := range blocks {
+		if len(block.FeeRange) == 0 || rate >= block.FeeRange[0] {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// Incremental relay fee in sat/vB, the default of Bitcoin Core. A replacement
+// must pay at least this rate for its own size on top of the original fee.
+const incrementalRelayFee = 1.0
+
+// Function to calculate the fee of a replacement paying the target rate for a
+// transaction with the given fee and size. BIP 125 also requires it to pay
+// the original fee plus the incremental relay fee for its own size, assuming
+// it keeps the same size.
+func replacementFee(fee, vsize int64, target float64) int64 {
+	return max(int64(target*float64(vsize)+0.5), fee+int64(incrementalRelayFee*float64(vsize)+0.5))
+}
+
+// Function to calculate the fee of a child transaction that brings a parent
+// with the given fee and size to the target rate. The child spends one output
+// of the parent to a single P2WPKH output, and the two are mined together once
+// their combined rate reaches the target. Also returns the size of the child.
+func cpfpChildFee(fee, vsize int64, target float64) (int64, int64) {
+	childVsize := txShape{Inputs: 1, Outputs: 1, Type: feeScriptTypes["p2wpkh"]}.vsize()
+	return int64(target*float64(vsize+childVsize)+0.5) - fee, childVsize
+}
+
+// Function to describe when a transaction paying a fee rate is expected to confirm
+func describeETA(blocks []projectedBlock, fees recommendedFees, rate float64) string {
+	if rate < fees.MinimumFee {
+		return fmt.Sprintf("Below the minimum relay fee of %g sat/vB; nodes will not accept it.", fees.MinimumFee)
+	}
+	n := projectedConfirmation(blocks, rate)
+	if n == 0 {
+		return fmt.Sprintf("Not within the next %d projected blocks (more than ~%s); it confirms once the mempool clears below %g sat/vB.",
+			len(blocks), formatDuration(time.Duration(len(blocks))*targetBlockInterval), rate)
+	}
+	eta := fmt.Sprintf("~%s", formatDuration(time.Duration(n)*targetBlockInterval))
+	if n == len(blocks) && n > 1 {
+		eta = "at least " + eta
+	}
+	if n == 1 {
+		return fmt.Sprintf("Expected in the next block (%s).", eta)
+	}
+	return fmt.Sprintf("Expected within %d blocks (%s).", n, eta)
+}
+
+// Handle /eta command
+func handleETACommand(ctx context.Context, update tgbotapi.Update) {
+	chatID := update.Message.Chat.ID
+
+	args := strings.Fields(update.Message.CommandArguments())
+	if len(args) != 1 {
+		sendMessage(chatID, "Usage: /eta <sat/vB> or /eta <txid>")
+		return
+	}
+
+	blocks, blocksAsOf, err := cached(ctx, "fees:projected", func(ctx context.Context) ([]projectedBlock, error) {
+		return getProjectedBlocks(ctx)
+	})
+	if err != nil {
+		log.Println("Error fetching projected blocks:", err)
+		sendMessage(chatID, "Error fetching mempool projection.")
+		return
+	}
+	fees, feesAsOf, err := cached(ctx, "fees", func(ctx context.Context) (recommendedFees, error) {
+		return getRecommendedFees(ctx)
+	})
+	if err != nil {
+		log.Println("Error fetching BTC fees:", err)
+		sendMessage(chatID, "Error fetching BTC fees.")
+		return
+	}
+
+	if !isHash(args[0]) {
+		rate, err := strconv.ParseFloat(strings.TrimSuffix(strings.ToLower(args[0]), "sat/vb"), 64)
+		if err != nil || rate <= 0 {
+			sendMessage(chatID, "Usage: /eta <sat/vB> or /eta <txid>")
+			return
+		}
+		message := fmt.Sprintf("%g sat/vB: %s", rate, describeETA(blocks, fees, rate))
+		sendMessage(chatID, message+dataAsOf(blocksAsOf, feesAsOf))
+		return
+	}
+
+	txid := strings.ToLower(args[0])
+	tx, txAsOf, err := cached(ctx, "tx:"+txid, func(ctx context.Context) (esploraTx, error) {
+		return getTransaction(ctx, txid)
+	})
+	if isNotFound(err) {
+		sendMessage(chatID, "Transaction not found.")
+		return
+	}
+	if err != nil {
+		log.Println("Error fetching transaction:", err)
+		sendMessage(chatID, "Error fetching transaction.")
+		return
+	}
+	if tx.Status.Confirmed {
+		sendMessage(chatID, fmt.Sprintf("Transaction %s is already confirmed in block %d.", shortTxid(txid), tx.Status.BlockHeight))
+		return
+	}
+
+	rate := tx.feeRate()
+	vsize := tx.vsize()
+	target := fees.FastestFee
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Transaction %s pays %.1f sat/vB (%d sats for %d vB).\n", shortTxid(txid), rate, tx.Fee, vsize)
+	b.WriteString(describeETA(blocks, fees, rate) + "\n")
+
+	if rate >= target {
+		fmt.Fprintf(&b, "\nIt already pays enough for the next block (%g sat/vB).", target)
+		sendMessage(chatID, b.String()+dataAsOf(blocksAsOf, feesAsOf, txAsOf))
+		return
+	}
+	fmt.Fprintf(&b, "\nTo reach the next block (%g sat/vB):\n", target)
+
+	replacement := replacementFee(tx.Fee, vsize, target)
+	fmt.Fprintf(&b, "RBF: replace it paying %d sats (+%d sats, %.1f sat/vB)", replacement, replacement-tx.Fee, float64(replacement)/float64(vsize))
+	if !tx.signalsRBF() {
+		b.WriteString(", only relayed by nodes with full RBF since it does not signal BIP 125")
+	}
+	b.WriteString(".\n")
+
+	childFee, childVsize := cpfpChildFee(tx.Fee, vsize, target)
+	fmt.Fprintf(&b, "CPFP: spend one of its outputs with a ~%d vB child paying %d sats (%.1f sat/vB).",
+		childVsize, childFee, float64(childFee)/float64(childVsize))
+
+	sendMessage(chatID, b.String()+dataAsOf(blocksAsOf, feesAsOf, txAsOf))
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// Projected blocks with minimum fee rates of 20, 10 and 5 sat/vB
+var testProjectedBlocks = []projectedBlock{
+	{FeeRange: []float64{20, 25, 80}},
+	{FeeRange: []float64{10, 12, 19}},
+	{FeeRange: []float64{5, 6, 9}},
+}
+
+func TestProjectedConfirmation(t *testing.T) {
+	tests := []struct {
+		name   string
+		blocks []projectedBlock
+		rate   float64
+		want   int
+	}{
+		{"above the next block", testProjectedBlocks, 30, 1},
+		{"at the minimum of the next block", testProjectedBlocks, 20, 1},
+		{"second block", testProjectedBlocks, 15, 2},
+		{"last block", testProjectedBlocks, 5, 3},
+		{"below all blocks", testProjectedBlocks, 4.9, 0},
+		{"no projection", nil, 1, 1},
+		{"block without fee range", []projectedBlock{{FeeRange: []float64{50}}, {}}, 2, 2},
+	}
+	for _, tt := range tests {
+		if got := projectedConfirmation(tt.blocks, tt.rate); got != tt.want {
+			t.Errorf("%s: projectedConfirmation(%g) = %d, want %d", tt.name, tt.rate, got, tt.want)
+		}
+	}
+}
+
+func TestDescribeETA(t *testing.T) {
+	fees := recommendedFees{MinimumFee: 2}
+	tests := []struct {
+		rate float64
+		want string
+	}{
+		{1, "Below the minimum relay fee of 2 sat/vB"},
+		{30, "Expected in the next block (~10m 0s)"},
+		{15, "Expected within 2 blocks (~20m 0s)"},
+		{5, "Expected within 3 blocks (at least ~30m 0s)"},
+		{3, "Not within the next 3 projected blocks"},
+	}
+	for _, tt := range tests {
+		if got := describeETA(testProjectedBlocks, fees, tt.rate); !strings.HasPrefix(got, tt.want) {
+			t.Errorf("describeETA(%g) = %q, want %q", tt.rate, got, tt.want)
+		}
+	}
+}
+
+func TestReplacementFee(t *testing.T) {
+	tests := []struct {
+		name   string
+		fee    int64
+		vsize  int64
+		target float64
+		want   int64
+	}{
+		{"target rate", 1000, 200, 10, 2000},
+		// Paying 5.5 sat/vB would add less than 1 sat/vB over the original
+		{"incremental relay fee", 1000, 200, 5.5, 1200},
+		{"rounded", 300, 141, 4.5, 635},
+		{"rounded incremental relay fee", 300, 141, 2.5, 441},
+	}
+	for _, tt := range tests {
+		if got := replacementFee(tt.fee, tt.vsize, tt.target); got != tt.want {
+			t.Errorf("%s: replacementFee(%d, %d, %g) = %d, want %d", tt.name, tt.fee, tt.vsize, tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestCPFPChildFee(t *testing.T) {
+	tests := []struct {
+		fee    int64
+		vsize  int64
+		target float64
+		want   int64
+	}{
+		// The 110 vB child pays for itself and brings the parent up to the target
+		{1000, 200, 10, 2100},
+		{0, 100, 1, 210},
+		{141, 141, 2.5, 487},
+	}
+	for _, tt := range tests {
+		childFee, childVsize := cpfpChildFee(tt.fee, tt.vsize, tt.target)
+		if childVsize != 110 {
+			t.Errorf("child vsize = %d, want 110", childVsize)
+		}
+		if childFee != tt.want {
+			t.Errorf("cpfpChildFee(%d, %d, %g) = %d, want %d", tt.fee, tt.vsize, tt.target, childFee, tt.want)
+		}
+		// Together the two pay at least the target rate
+		if rate := float64(tt.fee+childFee) / float64(tt.vsize+childVsize); rate < tt.target-0.01 {
+			t.Errorf("package rate = %.2f, want %g", rate, tt.target)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Input and output weights of a script type in weight units, assuming
+// 72-byte signatures and compressed public keys
+type scriptWeights struct {
+	Name   string
+	Input  int64
+	Output int64
+	Segwit bool
+}
+
+// Single-key script types accepted by /fees
+var feeScriptTypes = map[string]scriptWeights{
+	"p2pkh":       {Name: "P2PKH", Input: 148 * 4, Output: 34 * 4},
+	"p2sh-p2wpkh": {Name: "P2SH-P2WPKH", Input: 64*4 + 108, Output: 32 * 4, Segwit: true},
+	"p2wpkh":      {Name: "P2WPKH", Input: 41*4 + 108, Output: 31 * 4, Segwit: true},
+	"p2tr":        {Name: "P2TR", Input: 41*4 + 66, Output: 43 * 4, Segwit: true},
+}
+
+// Largest number of keys in a multisig script
+const maxMultisigKeys = 20
+
+// Largest number of inputs or outputs accepted by /fees
+const maxFeeTxParts = 10_000
+
+// Function to compute the weights of an m-of-n P2WSH multisig script
+func multisigWeights(m, n int64) scriptWeights {
+	// Witness: item count, empty item for CHECKMULTISIG, m signatures and the
+	// script OP_m <n keys> OP_n OP_CHECKMULTISIG with its length
+	script := 3 + 34*n
+	witness := 1 + 1 + m*73 + varIntSize(script) + script
+	return scriptWeights{
+		Name:   fmt.Sprintf("%d-of-%d P2WSH multisig", m, n),
+		Input:  41*4 + witness,
+		Output: 43 * 4,
+		Segwit: true,
+	}
+}
+
+// Helper function to get the encoded size of a Bitcoin variable-length integer
+func varIntSize(n int64) int64 {
+	switch {
+	case n < 0xfd:
+		return 1
+	case n <= 0xffff:
+		return 3
+	case n <= 0xffffffff:
+		return 5
+	default:
+		return 9
+	}
+}
+
+// Function to parse a script type for /fees: p2pkh, p2sh-p2wpkh, p2wpkh, p2tr
+// or an m-of-n multisig such as 2of3
+func parseFeeScriptType(s string) (scriptWeights, error) {
+	s = strings.ToLower(s)
+	if weights, ok := feeScriptTypes[s]; ok {
+		return weights, nil
+	}
+	if s == "multisig" {
+		return multisigWeights(2, 3), nil
+	}
+
+	mText, nText, found := strings.Cut(s, "of")
+	if !found {
+		return scriptWeights{}, fmt.Errorf("unknown transaction type %s", s)
+	}
+	m, errM := strconv.ParseInt(mText, 10, 64)
+	n, errN := strconv.ParseInt(nText, 10, 64)
+	if errM != nil || errN != nil || m < 1 || m > n || n > maxMultisigKeys {
+		return scriptWeights{}, fmt.Errorf("invalid multisig %s, use e.g. 2of3 with at most %d keys", s, maxMultisigKeys)
+	}
+	return multisigWeights(m, n), nil
+}
+
+// Shape of a transaction: its number of inputs and outputs, all of one script type
+type txShape struct {
+	Inputs  int64
+	Outputs int64
+	Type    scriptWeights
+}
+
+// Typical payment with change, used when /fees is given no shape
+var defaultTxShape = txShape{Inputs: 1, Outputs: 2, Type: feeScriptTypes["p2wpkh"]}
+
+// Function to estimate the virtual size of a transaction in vbytes
+func (s txShape) vsize() int64 {
+	// Version, locktime and the input and output counts
+	weight := (8 + varIntSize(s.Inputs) + varIntSize(s.Outputs)) * 4
+	if s.Type.Segwit {
+		// Marker and flag
+		weight += 2
+	}
+	weight += s.Inputs*s.Type.Input + s.Outputs*s.Type.Output
+	return (weight + 3) / 4
+}
+
+// Function to parse the /fees arguments [inputs] [outputs] [type] [currency],
+// where the currency may appear anywhere
+func parseFeeArgs(chatID int64, args []string) (txShape, string, error) {
+	shape := defaultTxShape
+	currency := chatCurrency(chatID)
+
+	var counts []int64
+	for _, arg := range args {
+		if code, ok := lookupCurrency(arg); ok {
+			currency = code.Code
+			continue
+		}
+		if count, err := strconv.ParseInt(arg, 10, 64); err == nil {
+			if count < 1 || count > maxFeeTxParts {
+				return txShape{}, "", fmt.Errorf("number of inputs and outputs must be between 1 and %d", maxFeeTxParts)
+			}
+			counts = append(counts, count)
+			continue
+		}
+		weights, err := parseFeeScriptType(arg)
+		if err != nil {
+			return txShape{}, "", err
+		}
+		shape.Type = weights
+	}
+
+	switch len(counts) {
+	case 0:
+	case 1:
+		shape.Inputs = counts[0]
+	case 2:
+		shape.Inputs, shape.Outputs = counts[0], counts[1]
+	default:
+		return txShape{}, "", errors.New("too many numbers, give inputs and outputs only")
+	}
+	return shape, currency, nil
+}
+
+// Handle /fees command
+func handleFeesCommand(ctx context.Context, update tgbotapi.Update) {
+	chatID := update.Message.Chat.ID
+
+	shape, currency, err := parseFeeArgs(chatID, strings.Fields(update.Message.CommandArguments()))
+	if err != nil {
+		sendMessage(chatID, fmt.Sprintf("%v.\nUsage: /fees [inputs] [outputs] [p2pkh|p2sh-p2wpkh|p2wpkh|p2tr|2of3] [currency]", err))
+		return
+	}
+
+	fees, feesAsOf, err := cached(ctx, "fees", func(ctx context.Context) (recommendedFees, error) {
+		return getRecommendedFees(ctx)
+	})
+	if err != nil {
+		log.Println("Error fetching BTC fees:", err)
+		sendMessage(chatID, "Error fetching BTC fees.")
+		return
+	}
+
+	// Amounts are still useful in BTC when the price is unavailable
+	price, priceAsOf, err := getPrice(ctx, bitcoinID, currency)
+	if err != nil {
+		log.Println("Error fetching BTC price:", err)
+		priceAsOf = feesAsOf
+	}
+
+	vsize := shape.vsize()
+	var b strings.Builder
+	fmt.Fprintf(&b, "BTC transaction fees for %d input(s) and %d output(s), %s (~%d vB):\n", shape.Inputs, shape.Outputs, shape.Type.Name, vsize)
+
+	tiers := []struct {
+		name string
+		rate float64
+	}{
+		{"Next block", fees.FastestFee},
+		{"30 minutes", fees.HalfHourFee},
+		{"1 hour", fees.HourFee},
+		{"Economy", fees.EconomyFee},
+		{"Minimum", fees.MinimumFee},
+	}
+	for _, tier := range tiers {
+		sats := int64(tier.rate*float64(vsize) + 0.5)
+		amount := formatBTC(sats)
+		if price != 0 {
+			amount = formatBTCWithFiat(sats, price, currency)
+		}
+		fmt.Fprintf(&b, "%s: %g sat/vB → %d sats, %s\n", tier.name, tier.rate, sats, amount)
+	}
+
+	sendMessage(chatID, strings.TrimSuffix(b.String(), "\n")+dataAsOf(feesAsOf, priceAsOf))
+}
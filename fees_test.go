@@ -0,0 +1,75 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestTxShapeVsize(t *testing.T) {
+	tests := []struct {
+		name  string
+		shape txShape
+		want  int64
+	}{
+		{"default payment", defaultTxShape, 141},
+		{"P2WPKH sweep", txShape{Inputs: 1, Outputs: 1, Type: feeScriptTypes["p2wpkh"]}, 110},
+		{"P2PKH payment", txShape{Inputs: 1, Outputs: 2, Type: feeScriptTypes["p2pkh"]}, 226},
+		{"P2SH-P2WPKH payment", txShape{Inputs: 1, Outputs: 2, Type: feeScriptTypes["p2sh-p2wpkh"]}, 166},
+		{"P2TR sweep", txShape{Inputs: 1, Outputs: 1, Type: feeScriptTypes["p2tr"]}, 111},
+		{"2-of-3 multisig payment", txShape{Inputs: 1, Outputs: 2, Type: multisigWeights(2, 3)}, 201},
+		// The input count takes 3 bytes from 253 inputs on
+		{"252 inputs", txShape{Inputs: 252, Outputs: 1, Type: feeScriptTypes["p2wpkh"]}, 17178},
+		{"253 inputs", txShape{Inputs: 253, Outputs: 1, Type: feeScriptTypes["p2wpkh"]}, 17248},
+	}
+	for _, tt := range tests {
+		if got := tt.shape.vsize(); got != tt.want {
+			t.Errorf("%s: vsize = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseFeeArgs(t *testing.T) {
+	oldCfg, oldChats := cfg, chats
+	t.Cleanup(func() { cfg, chats = oldCfg, oldChats })
+	cfg = defaultConfig()
+	chats = &chatRepository{store: openTestStore(t, filepath.Join(t.TempDir(), "btcbot.db"))}
+	if err := chats.setPreference(1, preferenceCurrency, "chf"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		args         []string
+		wantInputs   int64
+		wantOutputs  int64
+		wantType     string
+		wantCurrency string
+		wantErr      bool
+	}{
+		{nil, 1, 2, "P2WPKH", "chf", false},
+		{[]string{"3"}, 3, 2, "P2WPKH", "chf", false},
+		{[]string{"2", "3", "p2tr"}, 2, 3, "P2TR", "chf", false},
+		{[]string{"EUR", "5", "1"}, 5, 1, "P2WPKH", "eur", false},
+		{[]string{"P2PKH", "usd"}, 1, 2, "P2PKH", "usd", false},
+		{[]string{"2of3"}, 1, 2, "2-of-3 P2WSH multisig", "chf", false},
+		{[]string{"multisig", "4"}, 4, 2, "2-of-3 P2WSH multisig", "chf", false},
+		{[]string{"0"}, 0, 0, "", "", true},
+		{[]string{"10001"}, 0, 0, "", "", true},
+		{[]string{"1", "2", "3"}, 0, 0, "", "", true},
+		{[]string{"p2wsh"}, 0, 0, "", "", true},
+		{[]string{"3of2"}, 0, 0, "", "", true},
+		{[]string{"1of21"}, 0, 0, "", "", true},
+	}
+	for _, tt := range tests {
+		shape, currency, err := parseFeeArgs(1, tt.args)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseFeeArgs(%q) = %+v, want an error", tt.args, shape)
+			}
+			continue
+		}
+		if err != nil || shape.Inputs != tt.wantInputs || shape.Outputs != tt.wantOutputs ||
+			shape.Type.Name != tt.wantType || currency != tt.wantCurrency {
+			t.Errorf("parseFeeArgs(%q) = %d in, %d out, %s, %s, %v", tt.args, shape.Inputs, shape.Outputs, shape.Type.Name, currency, err)
+		}
+	}
+}
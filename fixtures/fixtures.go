@@ -0,0 +1,118 @@
+// Package fixtures serves canned responses of the upstream APIs the bot uses,
+// under the path prefixes of the offline profile. The files in data follow
+// the shape of the public API responses, trimmed to the fields the bot reads,
+// and do not depend on the query string. Price series are generated so that
+// they always end at the current time. The mempool websocket is not served,
+// so the block feed keeps reconnecting in the background.
+package fixtures
+
+import (
+	"embed"
+	"encoding/json"
+	"io/fs"
+	"math"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed data
+var data embed.FS
+
+// Handler returns the handler serving the fixtures
+func Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /coingecko/api/v3/coins/{coin}/market_chart", handleMarketChart)
+	mux.HandleFunc("GET /coingecko/api/v3/coins/{coin}/ohlc", handleOHLC)
+	mux.HandleFunc("GET /", handleFile)
+	return mux
+}
+
+// Function to serve the fixture file of a path. A path is served by the file
+// of the same name, or the file with a .json or .html extension added.
+func handleFile(w http.ResponseWriter, r *http.Request) {
+	name := path.Join("data", strings.TrimSuffix(r.URL.Path, "/"))
+	for _, candidate := range []string{name, name + ".json", name + ".html"} {
+		body, err := fs.ReadFile(data, candidate)
+		if err != nil {
+			continue
+		}
+		switch path.Ext(candidate) {
+		case ".json":
+			w.Header().Set("Content-Type", "application/json")
+		case ".html":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		default:
+			w.Header().Set("Content-Type", http.DetectContentType(body))
+		}
+		w.Write(body)
+		return
+	}
+	http.NotFound(w, r)
+}
+
+// Function to get the generated price at a time, a weekly swing around
+// 60,000 with a smaller daily one on top
+func price(t time.Time) float64 {
+	weeks := float64(t.Unix()) / (7 * 24 * 3600)
+	days := float64(t.Unix()) / (24 * 3600)
+	return 60000 + 5000*math.Sin(2*math.Pi*weeks) + 800*math.Sin(2*math.Pi*days)
+}
+
+// Helper function to read the days query parameter, defaulting to 1
+func requestDays(r *http.Request) int {
+	days, err := strconv.Atoi(r.URL.Query().Get("days"))
+	if err != nil || days < 1 {
+		return 1
+	}
+	return days
+}
+
+// Helper function to write a JSON response
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// Handle the CoinGecko market chart, which is 5-minutely for a day, hourly
+// up to 90 days and daily beyond
+func handleMarketChart(w http.ResponseWriter, r *http.Request) {
+	days := requestDays(r)
+	step := 24 * time.Hour
+	if days == 1 {
+		step = 5 * time.Minute
+	} else if days <= 90 {
+		step = time.Hour
+	}
+
+	end := time.Now().Truncate(step)
+	var prices [][2]float64
+	for t := end.AddDate(0, 0, -days); !t.After(end); t = t.Add(step) {
+		prices = append(prices, [2]float64{float64(t.UnixMilli()), price(t)})
+	}
+	writeJSON(w, map[string]interface{}{"prices": prices})
+}
+
+// Handle the CoinGecko OHLC endpoint, whose candles are 30 minutes for up to
+// 2 days, 4 hours for up to 30 days and 4 days beyond, stamped at their close
+func handleOHLC(w http.ResponseWriter, r *http.Request) {
+	days := requestDays(r)
+	step := 4 * 24 * time.Hour
+	if days <= 2 {
+		step = 30 * time.Minute
+	} else if days <= 30 {
+		step = 4 * time.Hour
+	}
+
+	end := time.Now().Truncate(step)
+	var candles [][5]float64
+	for t := end.AddDate(0, 0, -days).Add(step); !t.After(end); t = t.Add(step) {
+		open, closePrice := price(t.Add(-step)), price(t)
+		high := math.Max(open, closePrice) * 1.002
+		low := math.Min(open, closePrice) * 0.998
+		candles = append(candles, [5]float64{float64(t.UnixMilli()), open, high, low, closePrice})
+	}
+	writeJSON(w, candles)
+}
@@ -7,11 +7,12 @@ toolchain go1.23.9
 require (
 	github.com/PuerkitoBio/goquery v1.10.3
 	github.com/go-telegram-bot-api/telegram-bot-api/v5 v5.5.1
-	github.com/superoo7/go-gecko v1.0.0
+	go.etcd.io/bbolt v1.4.3
+	golang.org/x/net v0.39.0
 	golang.org/x/text v0.25.0
 )
 
 require (
 	github.com/andybalholm/cascadia v1.3.3 // indirect
-	golang.org/x/net v0.39.0 // indirect
+	golang.org/x/sys v0.32.0 // indirect
 )
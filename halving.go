@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Number of recent blocks the halving ETA is based on, about one day
+const halvingETABlocks = 144
+
+// Expected number of blocks per year at the target interval
+const blocksPerYear = 365 * 24 * time.Hour / targetBlockInterval
+
+// Function to compute the number of sats issued by the emission schedule up
+// to and including the block at height
+func totalSupplyAt(height int64) int64 {
+	var supply int64
+	blocks := height + 1
+	for epoch := int64(0); blocks > 0; epoch++ {
+		subsidy := blockSubsidy(epoch * halvingInterval)
+		if subsidy == 0 {
+			break
+		}
+		inEpoch := min(blocks, halvingInterval)
+		supply += inEpoch * subsidy
+		blocks -= inEpoch
+	}
+	return supply
+}
+
+// Handle /halving command
+func handleHalvingCommand(ctx context.Context, update tgbotapi.Update) {
+	chatID := update.Message.Chat.ID
+
+	tipHeight, asOf, err := cached(ctx, "block", func(ctx context.Context) (int64, error) {
+		return getBTCBlockNumber(ctx)
+	})
+	if err != nil {
+		log.Println("Error fetching BTC block number:", err)
+		sendMessage(chatID, "Error fetching BTC block number.")
+		return
+	}
+
+	nextHalving := (tipHeight/halvingInterval + 1) * halvingInterval
+	remaining := nextHalving - tipHeight
+	subsidy := blockSubsidy(tipHeight)
+	supply := totalSupplyAt(tipHeight)
+	maxSupply := totalSupplyAt(64 * halvingInterval)
+
+	var b strings.Builder
+	b.WriteString("⏳ Bitcoin halving\n")
+	fmt.Fprintf(&b, "Current block: %d\n", tipHeight)
+	fmt.Fprintf(&b, "Next halving: block %d (halving #%d)\n", nextHalving, nextHalving/halvingInterval)
+	fmt.Fprintf(&b, "Blocks remaining: %d\n", remaining)
+
+	// The ETA is still estimated from the target interval when recent blocks cannot be fetched
+	interval, err := averageBlockInterval(ctx, tipHeight, halvingETABlocks)
+	basis := fmt.Sprintf("%s average over the last %d blocks", formatDuration(interval), halvingETABlocks)
+	if err != nil || interval <= 0 {
+		log.Println("Error fetching recent blocks for halving ETA:", err)
+		interval = targetBlockInterval
+		basis = "10m target interval"
+	}
+	eta := time.Duration(remaining) * interval
+	fmt.Fprintf(&b, "ETA: %s UTC, in about %s (%s)\n", time.Now().Add(eta).UTC().Format("2006-01-02 15:04"), formatDuration(eta), basis)
+
+	fmt.Fprintf(&b, "Subsidy: %s → %s\n", formatBTC(subsidy), formatBTC(blockSubsidy(nextHalving)))
+	fmt.Fprintf(&b, "Circulating supply: %s (%.2f%% of %s)\n", formatBTC(supply), float64(supply)/float64(maxSupply)*100, formatBTC(maxSupply))
+	fmt.Fprintf(&b, "Annual inflation: %.2f%%", float64(subsidy)*float64(blocksPerYear)/float64(supply)*100)
+
+	sendMessage(chatID, b.String()+dataAsOf(asOf))
+}
@@ -0,0 +1,46 @@
+package main
+
+import "testing"
+
+func TestBlockSubsidy(t *testing.T) {
+	tests := []struct {
+		height int64
+		want   int64
+	}{
+		{0, 50 * satsPerBTC},
+		{halvingInterval - 1, 50 * satsPerBTC},
+		{halvingInterval, 25 * satsPerBTC},
+		{840_000, 312_500_000},
+		{32 * halvingInterval, 1},
+		{33 * halvingInterval, 0},
+		{64 * halvingInterval, 0},
+	}
+	for _, tt := range tests {
+		if got := blockSubsidy(tt.height); got != tt.want {
+			t.Errorf("blockSubsidy(%d) = %d, want %d", tt.height, got, tt.want)
+		}
+	}
+}
+
+func TestTotalSupplyAt(t *testing.T) {
+	tests := []struct {
+		height int64
+		want   int64
+	}{
+		{0, 50 * satsPerBTC},
+		{1, 100 * satsPerBTC},
+		// Last block of the first epoch, and the first at the halved subsidy
+		{halvingInterval - 1, 10_500_000 * satsPerBTC},
+		{halvingInterval, 10_500_025 * satsPerBTC},
+		{2*halvingInterval - 1, 15_750_000 * satsPerBTC},
+		{840_000, 1_968_750_312_500_000},
+		// The schedule ends just short of 21 million
+		{33 * halvingInterval, 2_099_999_997_690_000},
+		{64 * halvingInterval, 2_099_999_997_690_000},
+	}
+	for _, tt := range tests {
+		if got := totalSupplyAt(tt.height); got != tt.want {
+			t.Errorf("totalSupplyAt(%d) = %d, want %d", tt.height, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Output script types addresses can be derived for
+const (
+	scriptP2PKH      = "pkh"
+	scriptP2SHP2WPKH = "sh-wpkh"
+	scriptP2WPKH     = "wpkh"
+	scriptP2TR       = "tr"
+)
+
+// Human-readable names of the derivable script types
+var scriptTypeNames = map[string]string{
+	scriptP2PKH:      "P2PKH",
+	scriptP2SHP2WPKH: "P2SH-P2WPKH",
+	scriptP2WPKH:     "P2WPKH",
+	scriptP2TR:       "P2TR",
+}
+
+// Mainnet extended public key versions and the script type they imply (SLIP-132)
+var extendedKeyVersions = map[uint32]string{
+	0x0488b21e: scriptP2PKH,      // xpub
+	0x049d7cb2: scriptP2SHP2WPKH, // ypub
+	0x04b24746: scriptP2WPKH,     // zpub
+}
+
+// Child indexes from this one up are hardened and cannot be derived from a public key
+const hardenedIndex = 0x80000000
+
+// extendedKey is a BIP 32 extended public key
+type extendedKey struct {
+	Version   uint32
+	ChainCode []byte
+	Key       *ecPoint
+}
+
+// Function to parse a base58 extended public key such as xpub..., ypub... or zpub...
+func parseExtendedKey(s string) (extendedKey, error) {
+	payload, err := base58CheckDecode(s)
+	if err != nil {
+		return extendedKey{}, err
+	}
+	if len(payload) != 78 {
+		return extendedKey{}, errors.New("invalid extended key length")
+	}
+
+	version := binary.BigEndian.Uint32(payload[:4])
+	if _, ok := extendedKeyVersions[version]; !ok {
+		return extendedKey{}, errors.New("only mainnet extended public keys (xpub, ypub, zpub) are supported")
+	}
+
+	// Skip depth, parent fingerprint and child number
+	key, err := parsePublicKey(payload[45:78])
+	if err != nil {
+		return extendedKey{}, err
+	}
+	return extendedKey{Version: version, ChainCode: payload[13:45], Key: key}, nil
+}
+
+// Function to derive a non-hardened child public key (BIP 32 CKDpub)
+func (k extendedKey) child(index uint32) (extendedKey, error) {
+	if index >= hardenedIndex {
+		return extendedKey{}, errors.New("cannot derive hardened child from a public key")
+	}
+
+	mac := hmac.New(sha512.New, k.ChainCode)
+	mac.Write(k.Key.compressed())
+	mac.Write(binary.BigEndian.AppendUint32(nil, index))
+	sum := mac.Sum(nil)
+
+	tweak := new(big.Int).SetBytes(sum[:32])
+	if tweak.Cmp(secpN) >= 0 {
+		return extendedKey{}, errors.New("invalid child key")
+	}
+	key := ecAdd(ecMul(secpG, tweak), k.Key)
+	if key == nil {
+		return extendedKey{}, errors.New("invalid child key")
+	}
+	return extendedKey{Version: k.Version, ChainCode: sum[32:], Key: key}, nil
+}
+
+// Function to derive the key at a path of non-hardened indexes
+func (k extendedKey) derive(path []uint32) (extendedKey, error) {
+	var err error
+	for _, index := range path {
+		if k, err = k.child(index); err != nil {
+			return extendedKey{}, err
+		}
+	}
+	return k, nil
+}
+
+// Helper function to compute HASH160, i.e. RIPEMD-160 of SHA-256
+func hash160(data []byte) []byte {
+	sum := sha256.Sum256(data)
+	return ripemd160Sum(sum[:])
+}
+
+// Helper function to compute a BIP 340 tagged hash
+func taggedHash(tag string, data []byte) []byte {
+	tagHash := sha256.Sum256([]byte(tag))
+	h := sha256.New()
+	h.Write(tagHash[:])
+	h.Write(tagHash[:])
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// Function to compute the Taproot output key for a key-path-only output (BIP 86)
+func taprootOutputKey(internal *ecPoint) (*ecPoint, error) {
+	// The internal key is used with an even y coordinate
+	even, err := ecLiftX(internal.x, false)
+	if err != nil {
+		return nil, err
+	}
+	tweak := new(big.Int).SetBytes(taggedHash("TapTweak", even.xOnly()))
+	if tweak.Cmp(secpN) >= 0 {
+		return nil, errors.New("invalid taproot tweak")
+	}
+	output := ecAdd(even, ecMul(secpG, tweak))
+	if output == nil {
+		return nil, errors.New("invalid taproot output key")
+	}
+	return output, nil
+}
+
+// Function to encode the mainnet address of a public key for a script type
+func publicKeyAddress(key *ecPoint, scriptType string) (string, error) {
+	switch scriptType {
+	case scriptP2PKH:
+		return base58CheckEncode(append([]byte{0x00}, hash160(key.compressed())...)), nil
+	case scriptP2SHP2WPKH:
+		redeemScript := append([]byte{0x00, 0x14}, hash160(key.compressed())...)
+		return base58CheckEncode(append([]byte{0x05}, hash160(redeemScript)...)), nil
+	case scriptP2WPKH:
+		return encodeSegwitAddress(0, hash160(key.compressed())), nil
+	case scriptP2TR:
+		output, err := taprootOutputKey(key)
+		if err != nil {
+			return "", err
+		}
+		return encodeSegwitAddress(1, output.xOnly()), nil
+	default:
+		return "", fmt.Errorf("unknown script type %s", scriptType)
+	}
+}
+
+// Character set of output descriptors, ordered for the checksum (BIP 380)
+const descriptorInputCharset = "0123456789()[],'/*abcdefgh@:$%{}" +
+	"IJKLMNOPQRSTUVWXYZ&+-.;<=>?!^_|~" +
+	"ijklmnopqrstuvwxyzABCDEFGH`#\"\\ "
+
+// Function to compute the descriptor checksum polynomial
+func descriptorPolymod(c uint64, value int) uint64 {
+	top := c >> 35
+	c = (c&0x7ffffffff)<<5 ^ uint64(value)
+	generator := [5]uint64{0xf5dee51989, 0xa9fdca3312, 0x1bab10e32d, 0x3706b1677a, 0x644d626ffd}
+	for i := 0; i < 5; i++ {
+		if (top>>i)&1 == 1 {
+			c ^= generator[i]
+		}
+	}
+	return c
+}
+
+// Function to compute the 8-character checksum of an output descriptor
+func descriptorChecksum(descriptor string) (string, error) {
+	c := uint64(1)
+	class, classCount := 0, 0
+	for _, r := range descriptor {
+		position := strings.IndexRune(descriptorInputCharset, r)
+		if position < 0 {
+			return "", fmt.Errorf("invalid character %q in descriptor", r)
+		}
+		c = descriptorPolymod(c, position&31)
+		class = class*3 + position>>5
+		classCount++
+		if classCount == 3 {
+			c = descriptorPolymod(c, class)
+			class, classCount = 0, 0
+		}
+	}
+	if classCount > 0 {
+		c = descriptorPolymod(c, class)
+	}
+	for i := 0; i < 8; i++ {
+		c = descriptorPolymod(c, 0)
+	}
+	c ^= 1
+
+	checksum := make([]byte, 8)
+	for i := range checksum {
+		checksum[i] = bech32Alphabet[(c>>(5*(7-i)))&31]
+	}
+	return string(checksum), nil
+}
+
+// watchSource is what a /watch target resolves to: either a single address,
+// or an extended key with the chains to derive addresses from
+type watchSource struct {
+	Address    string `json:"address,omitempty"`
+	ScriptType string `json:"script_type,omitempty"`
+	Key        string `json:"key,omitempty"`
+	// Derivation path prefixes below the key, one per chain, e.g. [[0] [1]]
+	// for receive and change addresses
+	Chains [][]uint32 `json:"chains,omitempty"`
+}
+
+// Function to parse the derivation path after the key in a descriptor, e.g.
+// /0/*, /<0;1>/* or /*, into one path prefix per chain
+func parseDescriptorPath(path string) ([][]uint32, error) {
+	if !strings.HasSuffix(path, "/*") {
+		return nil, errors.New("descriptor key must end with /* to derive addresses")
+	}
+	path = strings.TrimSuffix(path, "/*")
+
+	chains := [][]uint32{{}}
+	if path == "" {
+		return chains, nil
+	}
+	if !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("invalid derivation path %s", path)
+	}
+
+	for _, element := range strings.Split(path[1:], "/") {
+		// A multipath element such as <0;1> splits the descriptor into one chain per index
+		if strings.HasPrefix(element, "<") && strings.HasSuffix(element, ">") {
+			if len(chains) > 1 {
+				return nil, errors.New("only one multipath element is supported")
+			}
+			var split [][]uint32
+			for _, option := range strings.Split(element[1:len(element)-1], ";") {
+				index, err := parseDerivationIndex(option)
+				if err != nil {
+					return nil, err
+				}
+				split = append(split, append(append([]uint32{}, chains[0]...), index))
+			}
+			chains = split
+			continue
+		}
+
+		index, err := parseDerivationIndex(element)
+		if err != nil {
+			return nil, err
+		}
+		for i := range chains {
+			chains[i] = append(chains[i], index)
+		}
+	}
+	return chains, nil
+}
+
+// Helper function to parse one non-hardened index of a derivation path
+func parseDerivationIndex(element string) (uint32, error) {
+	if strings.HasSuffix(element, "'") || strings.HasSuffix(element, "h") {
+		return 0, errors.New("hardened derivation after an extended public key is not possible")
+	}
+	index, err := strconv.ParseUint(element, 10, 32)
+	if err != nil || index >= hardenedIndex {
+		return 0, fmt.Errorf("invalid derivation index %s", element)
+	}
+	return uint32(index), nil
+}
+
+// Function to parse a descriptor key expression such as
+// [d34db33f/84h/0h/0h]xpub.../<0;1>/*
+func parseDescriptorKey(expression, scriptType string) (watchSource, error) {
+	// Key origin information is not needed to derive addresses
+	if strings.HasPrefix(expression, "[") {
+		end := strings.Index(expression, "]")
+		if end < 0 {
+			return watchSource{}, errors.New("unterminated key origin")
+		}
+		expression = expression[end+1:]
+	}
+
+	key, path, found := strings.Cut(expression, "/")
+	if !found {
+		return watchSource{}, errors.New("descriptor key must end with /* to derive addresses")
+	}
+	if _, err := parseExtendedKey(key); err != nil {
+		return watchSource{}, fmt.Errorf("invalid extended key: %v", err)
+	}
+	chains, err := parseDescriptorPath("/" + path)
+	if err != nil {
+		return watchSource{}, err
+	}
+	return watchSource{ScriptType: scriptType, Key: key, Chains: chains}, nil
+}
+
+// Function to parse an output descriptor such as wpkh([...]xpub.../<0;1>/*)#checksum
+func parseDescriptor(descriptor string) (watchSource, error) {
+	if body, checksum, found := strings.Cut(descriptor, "#"); found {
+		expected, err := descriptorChecksum(body)
+		if err != nil {
+			return watchSource{}, err
+		}
+		if checksum != expected {
+			return watchSource{}, errors.New("invalid descriptor checksum")
+		}
+		descriptor = body
+	}
+
+	wrappers := []struct {
+		prefix, scriptType string
+	}{
+		{"sh(wpkh(", scriptP2SHP2WPKH},
+		{"wpkh(", scriptP2WPKH},
+		{"pkh(", scriptP2PKH},
+		{"tr(", scriptP2TR},
+	}
+	for _, wrapper := range wrappers {
+		if strings.HasPrefix(descriptor, wrapper.prefix) {
+			closing := strings.Count(wrapper.prefix, "(")
+			inner := descriptor[len(wrapper.prefix):]
+			if !strings.HasSuffix(inner, strings.Repeat(")", closing)) {
+				return watchSource{}, errors.New("unbalanced parentheses in descriptor")
+			}
+			inner = inner[:len(inner)-closing]
+			if strings.ContainsAny(inner, "(),") {
+				return watchSource{}, errors.New("only single-key descriptors are supported")
+			}
+			return parseDescriptorKey(inner, wrapper.scriptType)
+		}
+	}
+
+	if strings.HasPrefix(descriptor, "addr(") && strings.HasSuffix(descriptor, ")") {
+		return parseWatchAddress(descriptor[len("addr(") : len(descriptor)-1])
+	}
+	return watchSource{}, errors.New("unsupported descriptor, use pkh(), sh(wpkh()), wpkh(), tr() or addr()")
+}
+
+// Function to validate a single address to watch
+func parseWatchAddress(s string) (watchSource, error) {
+	address, err := parseAddress(s)
+	if err != nil {
+		return watchSource{}, err
+	}
+	if address.Network != networkMainnet {
+		return watchSource{}, errors.New("only mainnet addresses can be watched")
+	}
+	if address.isSegwit() {
+		s = strings.ToLower(s)
+	}
+	return watchSource{Address: s}, nil
+}
+
+// Function to parse what /watch was given: an address, an extended public key or a descriptor
+func parseWatchTarget(target string) (watchSource, error) {
+	if strings.Contains(target, "(") {
+		return parseDescriptor(target)
+	}
+
+	if key, err := parseExtendedKey(target); err == nil {
+		// A bare extended key is taken to be an account key with receive and change chains
+		return watchSource{
+			ScriptType: extendedKeyVersions[key.Version],
+			Key:        target,
+			Chains:     [][]uint32{{0}, {1}},
+		}, nil
+	} else if strings.HasPrefix(target, "xpub") || strings.HasPrefix(target, "ypub") || strings.HasPrefix(target, "zpub") {
+		return watchSource{}, fmt.Errorf("invalid extended key: %v", err)
+	}
+
+	return parseWatchAddress(target)
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestExtendedKeyChildBIP32Vectors(t *testing.T) {
+	// Public derivation steps of BIP 32 test vectors 1 and 2
+	tests := []struct {
+		name   string
+		parent string
+		index  uint32
+		child  string
+	}{
+		{"vector 1 m/0H -> m/0H/1",
+			"xpub68Gmy5EdvgibQVfPdqkBBCHxA5htiqg55crXYuXoQRKfDBFA1WEjWgP6LHhwBZeNK1VTsfTFUHCdrfp1bgwQ9xv5ski8PX9rL2dZXvgGDnw", 1,
+			"xpub6ASuArnXKPbfEwhqN6e3mwBcDTgzisQN1wXN9BJcM47sSikHjJf3UFHKkNAWbWMiGj7Wf5uMash7SyYq527Hqck2AxYysAA7xmALppuCkwQ"},
+		{"vector 1 m/0H/1/2H -> m/0H/1/2H/2",
+			"xpub6D4BDPcP2GT577Vvch3R8wDkScZWzQzMMUm3PWbmWvVJrZwQY4VUNgqFJPMM3No2dFDFGTsxxpG5uJh7n7epu4trkrX7x7DogT5Uv6fcLW5", 2,
+			"xpub6FHa3pjLCk84BayeJxFW2SP4XRrFd1JYnxeLeU8EqN3vDfZmbqBqaGJAyiLjTAwm6ZLRQUMv1ZACTj37sR62cfN7fe5JnJ7dh8zL4fiyLHV"},
+		{"vector 1 m/0H/1/2H/2 -> m/0H/1/2H/2/1000000000",
+			"xpub6FHa3pjLCk84BayeJxFW2SP4XRrFd1JYnxeLeU8EqN3vDfZmbqBqaGJAyiLjTAwm6ZLRQUMv1ZACTj37sR62cfN7fe5JnJ7dh8zL4fiyLHV", 1000000000,
+			"xpub6H1LXWLaKsWFhvm6RVpEL9P4KfRZSW7abD2ttkWP3SSQvnyA8FSVqNTEcYFgJS2UaFcxupHiYkro49S8yGasTvXEYBVPamhGW6cFJodrTHy"},
+		{"vector 2 m -> m/0",
+			"xpub661MyMwAqRbcFW31YEwpkMuc5THy2PSt5bDMsktWQcFF8syAmRUapSCGu8ED9W6oDMSgv6Zz8idoc4a6mr8BDzTJY47LJhkJ8UB7WEGuduB", 0,
+			"xpub69H7F5d8KSRgmmdJg2KhpAK8SR3DjMwAdkxj3ZuxV27CprR9LgpeyGmXUbC6wb7ERfvrnKZjXoUmmDznezpbZb7ap6r1D3tgFxHmwMkQTPH"},
+		{"vector 2 m/0/2147483647H -> m/0/2147483647H/1",
+			"xpub6ASAVgeehLbnwdqV6UKMHVzgqAG8Gr6riv3Fxxpj8ksbH9ebxaEyBLZ85ySDhKiLDBrQSARLq1uNRts8RuJiHjaDMBU4Zn9h8LZNnBC5y4a", 1,
+			"xpub6DF8uhdarytz3FWdA8TvFSvvAh8dP3283MY7p2V4SeE2wyWmG5mg5EwVvmdMVCQcoNJxGoWaU9DCWh89LojfZ537wTfunKau47EL2dhHKon"},
+		{"vector 2 m/0/2147483647H/1/2147483646H -> m/0/2147483647H/1/2147483646H/2",
+			"xpub6ERApfZwUNrhLCkDtcHTcxd75RbzS1ed54G1LkBUHQVHQKqhMkhgbmJbZRkrgZw4koxb5JaHWkY4ALHY2grBGRjaDMzQLcgJvLJuZZvRcEL", 2,
+			"xpub6FnCn6nSzZAw5Tw7cgR9bi15UV96gLZhjDstkXXxvCLsUXBGXPdSnLFbdpq8p9HmGsApME5hQTZ3emM2rnY5agb9rXpVGyy3bdW6EEgAtqt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parent, err := parseExtendedKey(tt.parent)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := parseExtendedKey(tt.child)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := parent.child(tt.index)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Key.x.Cmp(want.Key.x) != 0 || got.Key.y.Cmp(want.Key.y) != 0 {
+				t.Errorf("child key = %x, want %x", got.Key.compressed(), want.Key.compressed())
+			}
+			if !bytes.Equal(got.ChainCode, want.ChainCode) {
+				t.Errorf("child chain code = %x, want %x", got.ChainCode, want.ChainCode)
+			}
+		})
+	}
+}
+
+func TestExtendedKeyRejectsHardenedChild(t *testing.T) {
+	key, err := parseExtendedKey(testXpub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := key.child(hardenedIndex); err == nil {
+		t.Error("derived a hardened child from a public key")
+	}
+}
+
+func TestParseExtendedKeyRejectsInvalidKeys(t *testing.T) {
+	tests := []struct {
+		name, key string
+	}{
+		{"bad checksum", testXpub[:len(testXpub)-1] + "9"},
+		{"testnet key", "tpubD6NzVbkrYhZ4XgiXtGrdW5XDAPFCL9h7we1vwNCpn8tGbBcgfVYjXyhWo4E1xkh56hjod1RhGjxbaTLV3X4FyWuejifB9jusQ46QzG87VKp"},
+		{"not base58", "xpub0OIl"},
+	}
+	for _, tt := range tests {
+		if _, err := parseExtendedKey(tt.key); err == nil {
+			t.Errorf("%s: parseExtendedKey accepted %s", tt.name, tt.key)
+		}
+	}
+}
+
+func TestPublicKeyAddressAccountVectors(t *testing.T) {
+	// Account 0 keys of the BIP 39 test mnemonic "abandon abandon ... about"
+	// and their first addresses, as given in BIP 84 and BIP 86 and commonly
+	// used for BIP 44 and BIP 49
+	const (
+		bip44 = "xpub6BosfCnifzxcFwrSzQiqu2DBVTshkCXacvNsWGYJVVhhawA7d4R5WSWGFNbi8Aw6ZRc1brxMyWMzG3DSSSSoekkudhUd9yLb6qx39T9nMdj"
+		bip49 = "ypub6Ww3ibxVfGzLrAH1PNcjyAWenMTbbAosGNB6VvmSEgytSER9azLDWCxoJwW7Ke7icmizBMXrzBx9979FfaHxHcrArf3zbeJJJUZPf663zsP"
+		bip84 = "zpub6rFR7y4Q2AijBEqTUquhVz398htDFrtymD9xYYfG1m4wAcvPhXNfE3EfH1r1ADqtfSdVCToUG868RvUUkgDKf31mGDtKsAYz2oz2AGutZYs"
+		bip86 = "xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ"
+	)
+	tests := []struct {
+		name, key, scriptType string
+		path                  []uint32
+		want                  string
+	}{
+		{"BIP 44 first receiving", bip44, scriptP2PKH, []uint32{0, 0}, "1LqBGSKuX5yYUonjxT5qGfpUsXKYYWeabA"},
+		{"BIP 44 second receiving", bip44, scriptP2PKH, []uint32{0, 1}, "1Ak8PffB2meyfYnbXZR9EGfLfFZVpzJvQP"},
+		{"BIP 49 first receiving", bip49, scriptP2SHP2WPKH, []uint32{0, 0}, "37VucYSaXLCAsxYyAPfbSi9eh4iEcbShgf"},
+		{"BIP 84 first receiving", bip84, scriptP2WPKH, []uint32{0, 0}, "bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu"},
+		{"BIP 84 second receiving", bip84, scriptP2WPKH, []uint32{0, 1}, "bc1qnjg0jd8228aq7egyzacy8cys3knf9xvrerkf9g"},
+		{"BIP 84 first change", bip84, scriptP2WPKH, []uint32{1, 0}, "bc1q8c6fshw2dlwun7ekn9qwf37cu2rn755upcp6el"},
+		{"BIP 86 first receiving", bip86, scriptP2TR, []uint32{0, 0}, "bc1p5cyxnuxmeuwuvkwfem96lqzszd02n6xdcjrs20cac6yqjjwudpxqkedrcr"},
+		{"BIP 86 second receiving", bip86, scriptP2TR, []uint32{0, 1}, "bc1p4qhjn9zdvkux4e44uhx8tc55attvtyu358kutcqkudyccelu0was9fqzwh"},
+		{"BIP 86 first change", bip86, scriptP2TR, []uint32{1, 0}, "bc1p3qkhfews2uk44qtvauqyr2ttdsw7svhkl9nkm9s9c3x4ax5h60wqwruhk7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := parseExtendedKey(tt.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			child, err := key.derive(tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := publicKeyAddress(child.Key, tt.scriptType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("address = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDescriptorChecksumBIP380(t *testing.T) {
+	// Test vectors of BIP 380: only the first descriptor is valid
+	tests := []struct {
+		descriptor string
+		valid      bool
+	}{
+		{"raw(deadbeef)#89f8spxm", true},
+		{"raw(deadbeef)#", false},
+		{"raw(deadbeef)#89f8spxmx", false},
+		{"raw(deadbeef)#89f8spx", false},
+		{"raw(deedbeef)#89f8spxm", false},
+		{"raw(deadbeef)#89f8spxn", false},
+		{"raw(deadbeef)##9f8spxm", false},
+		{"raw(Ü)#00000000", false},
+	}
+	for _, tt := range tests {
+		body, checksum, _ := strings.Cut(tt.descriptor, "#")
+		expected, err := descriptorChecksum(body)
+		if valid := err == nil && checksum == expected; valid != tt.valid {
+			t.Errorf("%s: valid = %v, want %v (computed %q, %v)", tt.descriptor, valid, tt.valid, expected, err)
+		}
+	}
+}
+
+func TestParseDescriptor(t *testing.T) {
+	// Example from Bitcoin Core's descriptor documentation
+	const key = "xpub6DJ2dNUysrn5Vt36jH2KLBT2i1auw1tTSSomg8PhqNiUtx8QX2SvC9nrHu81fT41fvDUnhMjEzQgXnQjKEu3oaqMSzhSrHMxyyoEAmUHQbY"
+	tests := []struct {
+		descriptor string
+		scriptType string
+		chains     [][]uint32
+		wantErr    bool
+	}{
+		{"wpkh([d34db33f/84h/0h/0h]" + key + "/0/*)#cjjspncu", scriptP2WPKH, [][]uint32{{0}}, false},
+		{"wpkh([d34db33f/84h/0h/0h]" + key + "/0/*)#cjjspncv", "", nil, true},
+		{"wpkh(" + key + "/<0;1>/*)", scriptP2WPKH, [][]uint32{{0}, {1}}, false},
+		{"sh(wpkh(" + key + "/*))", scriptP2SHP2WPKH, [][]uint32{{}}, false},
+		{"tr(" + key + "/1/<0;1>/*)", scriptP2TR, [][]uint32{{1, 0}, {1, 1}}, false},
+		{"pkh(" + key + "/0h/*)", "", nil, true},
+		{"wpkh(" + key + "/0)", "", nil, true},
+		{"wsh(multi(1," + key + "/0/*))", "", nil, true},
+	}
+	for _, tt := range tests {
+		source, err := parseDescriptor(tt.descriptor)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseDescriptor(%s) error = %v, want error %v", tt.descriptor, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		if source.Key != key || source.ScriptType != tt.scriptType {
+			t.Errorf("parseDescriptor(%s) = %s %s", tt.descriptor, source.ScriptType, source.Key)
+		}
+		if len(source.Chains) != len(tt.chains) {
+			t.Errorf("parseDescriptor(%s) chains = %v, want %v", tt.descriptor, source.Chains, tt.chains)
+			continue
+		}
+		for i := range tt.chains {
+			if len(source.Chains[i]) != len(tt.chains[i]) {
+				t.Errorf("parseDescriptor(%s) chains = %v, want %v", tt.descriptor, source.Chains, tt.chains)
+				break
+			}
+			for j := range tt.chains[i] {
+				if source.Chains[i][j] != tt.chains[i][j] {
+					t.Errorf("parseDescriptor(%s) chains = %v, want %v", tt.descriptor, source.Chains, tt.chains)
+				}
+			}
+		}
+	}
+}
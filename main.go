@@ -1,41 +1,76 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
-	gecko "github.com/superoo7/go-gecko/v3"
-	"golang.org/x/text/language"
-	"golang.org/x/text/message"
 )
 
 // Global variables
 var bot *tgbotapi.BotAPI
 
-// Function to fetch BTC price data
-func getBTCPrice() (float64, error) {
-	cg := gecko.NewClient(nil)
-	price, err := cg.SimpleSinglePrice("bitcoin", "usd")
-	if err != nil {
-		return 0, err
-	}
-	return float64(price.MarketPrice), nil
+// Function to fetch the price of a coin in a currency
+func getPrice(ctx context.Context, coin, currency string) (float64, time.Time, error) {
+	return cached(ctx, fmt.Sprintf("price:%s:%s", coin, currency), func(ctx context.Context) (float64, error) {
+		return marketData.Price(ctx, coin, currency)
+	})
+}
+
+// Function to fetch the market cap of a coin in a currency
+func getMarketCap(ctx context.Context, coin, currency string) (float64, time.Time, error) {
+	return cached(ctx, fmt.Sprintf("marketcap:%s:%s", coin, currency), func(ctx context.Context) (float64, error) {
+		return marketData.MarketCap(ctx, coin, currency)
+	})
+}
+
+// Function to fetch the 24-hour trading volume of a coin in a currency
+func getVolume(ctx context.Context, coin, currency string) (float64, time.Time, error) {
+	return cached(ctx, fmt.Sprintf("volume:%s:%s", coin, currency), func(ctx context.Context) (float64, error) {
+		return marketData.Volume(ctx, coin, currency)
+	})
+}
+
+// Function to fetch daily prices of a coin in a currency for the last given number of days
+func getPriceHistory(ctx context.Context, coin, currency string, days int) ([]PricePoint, time.Time, error) {
+	return cached(ctx, fmt.Sprintf("history:%s:%s:%d", coin, currency, days), func(ctx context.Context) ([]PricePoint, error) {
+		return marketData.PriceHistory(ctx, coin, currency, days)
+	})
+}
+
+// Function to fetch OHLC candles of a coin for the last given number of days
+func getCandles(ctx context.Context, coin, currency string, interval time.Duration, days int) ([]Candle, time.Time, error) {
+	return cached(ctx, fmt.Sprintf("candles:%s:%s:%s:%d", coin, currency, interval, days), func(ctx context.Context) ([]Candle, error) {
+		candles, err := marketData.Candles(ctx, coin, currency, interval, days)
+		if err != nil {
+			return nil, err
+		}
+
+		// Drop candles from before the range, e.g. when a provider only offers fixed ranges
+		start := time.Now().AddDate(0, 0, -days).Add(-interval)
+		for len(candles) > 0 && candles[0].Time.Before(start) {
+			candles = candles[1:]
+		}
+		return candles, nil
+	})
 }
 
-// Function to fetch BTC historical market data
-func getHistoricalData() (map[string]float64, error) {
-	cg := gecko.NewClient(nil)
-	data, err := cg.CoinsIDMarketChart("bitcoin", "usd", "365")
+// Function to fetch historical market data of a coin
+func getHistoricalData(ctx context.Context, coin, currency string) (map[string]float64, time.Time, error) {
+	data, asOf, err := getPriceHistory(ctx, coin, currency, 365)
 	if err != nil {
-		return nil, err
+		return nil, asOf, err
 	}
 
 	historicalPrices := make(map[string]float64)
@@ -55,21 +90,21 @@ func getHistoricalData() (map[string]float64, error) {
 	}
 
 	for _, period := range periods {
-		date := now.AddDate(0, 0, -period.days).Unix() * 1000 // Convert to milliseconds
-		for _, pricePoint := range *data.Prices {
-			if int64(pricePoint[0]) >= date {
-				historicalPrices[period.label] = float64(pricePoint[1]) // Convert float32 to float64
+		date := now.AddDate(0, 0, -period.days)
+		for _, pricePoint := range data {
+			if !pricePoint.Time.Before(date) {
+				historicalPrices[period.label] = pricePoint.Price
 				break
 			}
 		}
 	}
 
-	return historicalPrices, nil
+	return historicalPrices, asOf, nil
 }
 
 // Function to fetch BTC current block number
-func getBTCBlockNumber() (int64, error) {
-	response, err := http.Get("https://mempool.space/api/blocks/tip/height")
+func getBTCBlockNumber(ctx context.Context) (int64, error) {
+	response, err := httpGet(ctx, cfg.MempoolURL+"/blocks/tip/height")
 	if err != nil {
 		return 0, err
 	}
@@ -84,69 +119,63 @@ func getBTCBlockNumber() (int64, error) {
 	return blockNumber, nil
 }
 
-// Function to fetch BTC average transaction fees
-func getBTCFees() (float64, float64, float64, error) {
-	currentPrice, err := getBTCPrice()
-	if err != nil {
-		return 0, 0, 0, err
-	}
+// Recommended fee rates in sat/vB
+type recommendedFees struct {
+	FastestFee  float64 `json:"fastestFee"`
+	HalfHourFee float64 `json:"halfHourFee"`
+	HourFee     float64 `json:"hourFee"`
+	EconomyFee  float64 `json:"economyFee"`
+	MinimumFee  float64 `json:"minimumFee"`
+}
 
-	response, err := http.Get("https://mempool.space/api/v1/fees/recommended")
+// Function to fetch recommended fee rates from mempool
+func getRecommendedFees(ctx context.Context) (recommendedFees, error) {
+	response, err := httpGet(ctx, cfg.MempoolURL+"/v1/fees/recommended")
 	if err != nil {
-		return 0, 0, 0, err
+		return recommendedFees{}, err
 	}
 	defer response.Body.Close()
 
-	var fees struct {
-		FastestFee  float64 `json:"fastestFee"`
-		HalfHourFee float64 `json:"halfHourFee"`
-		HourFee     float64 `json:"hourFee"`
-	}
+	var fees recommendedFees
 	err = json.NewDecoder(response.Body).Decode(&fees)
 	if err != nil {
-		return 0, 0, 0, err
-	}
-
-	// Convert sat/vB to USD
-	toUSD := func(satPerVByte float64) float64 {
-		// 1 BTC = 100,000,000 satoshis
-		// Transaction size is assumed to be 250 bytes (average)
-		return (satPerVByte * 250 * currentPrice) / 100000000
+		return recommendedFees{}, err
 	}
 
-	return toUSD(fees.HourFee), toUSD(fees.HalfHourFee), toUSD(fees.FastestFee), nil
+	return fees, nil
 }
 
-// Function to fetch BTC market cap
-func getBTCMarketCap() (float64, error) {
-	// Use CoinGecko simple price endpoint for market cap
-	response, err := http.Get("https://api.coingecko.com/api/v3/simple/price?ids=bitcoin&vs_currencies=usd&include_market_cap=true")
+// Function to fetch BTC transaction fees in a currency for a transaction of
+// the given virtual size, along with the time the oldest underlying data was fetched
+func getBTCFees(ctx context.Context, currency string, vsize int64) (float64, float64, float64, time.Time, error) {
+	currentPrice, priceAsOf, err := getPrice(ctx, bitcoinID, currency)
 	if err != nil {
-		return 0, fmt.Errorf("error fetching market cap: %v", err)
+		return 0, 0, 0, time.Time{}, err
 	}
-	defer response.Body.Close()
 
-	if response.StatusCode != http.StatusOK {
-		return 0, fmt.Errorf("API returned non-200 status code: %d", response.StatusCode)
+	fees, feesAsOf, err := cached(ctx, "fees", func(ctx context.Context) (recommendedFees, error) {
+		return getRecommendedFees(ctx)
+	})
+	if err != nil {
+		return 0, 0, 0, time.Time{}, err
 	}
 
-	var data struct {
-		Bitcoin struct {
-			MarketCap float64 `json:"usd_market_cap"`
-		} `json:"bitcoin"`
+	asOf := priceAsOf
+	if feesAsOf.Before(asOf) {
+		asOf = feesAsOf
 	}
 
-	err = json.NewDecoder(response.Body).Decode(&data)
-	if err != nil {
-		return 0, fmt.Errorf("error parsing market cap data: %v", err)
+	// Convert sat/vB to fiat
+	toFiat := func(satPerVByte float64) float64 {
+		return satPerVByte * float64(vsize) * currentPrice / satsPerBTC
 	}
 
-	return data.Bitcoin.MarketCap, nil
+	return toFiat(fees.HourFee), toFiat(fees.HalfHourFee), toFiat(fees.FastestFee), asOf, nil
 }
 
 // Function to fetch BTC hashrate
-func getBTCHashrate() (float64, error) {
-	resp, err := http.Get("https://api.blockchain.info/stats")
+func getBTCHashrate(ctx context.Context) (float64, error) {
+	resp, err := httpGet(ctx, cfg.BlockchainInfoURL+"/stats")
 	if err != nil {
 		return 0, fmt.Errorf("error fetching hashrate: %v", err)
 	}
@@ -168,73 +197,9 @@ func getBTCHashrate() (float64, error) {
 	return data.Hashrate / 1e9, nil
 }
 
-// Function to fetch BTC all-time high
-func getBTCATH() (float64, error) {
-	cg := gecko.NewClient(nil)
-	// Use CoinsID with specific parameters to get ATH data
-	coin, err := cg.CoinsID("bitcoin", false, false, true, false, false, false)
-	if err != nil {
-		return 0, fmt.Errorf("error fetching coin data: %v", err)
-	}
-
-	if coin.MarketData == nil {
-		return 0, fmt.Errorf("market data is nil")
-	}
-
-	ath, ok := coin.MarketData.ATH["usd"]
-	if !ok {
-		return 0, fmt.Errorf("ATH data not found")
-	}
-
-	// Get the date of ATH
-	athDate, ok := coin.MarketData.ATHDate["usd"]
-	if !ok {
-		return ath, nil // Return ATH even if we can't get the date
-	}
-
-	// Parse the date string
-	date, err := time.Parse(time.RFC3339, athDate)
-	if err != nil {
-		log.Printf("Error parsing ATH date: %v", err)
-		return ath, nil // Return ATH even if we can't parse the date
-	}
-
-	// Format the message to include the date
-	message := fmt.Sprintf("Bitcoin All-Time High: $%.2f (reached on %s)", ath, date.Format("January 2, 2006"))
-	log.Println(message) // Log the full message for debugging
-
-	return ath, nil
-}
-
-// Function to fetch BTC 24-hour trading volume
-func getBTCVolume() (float64, error) {
-	response, err := http.Get("https://api.coingecko.com/api/v3/simple/price?ids=bitcoin&vs_currencies=usd&include_24hr_vol=true")
-	if err != nil {
-		return 0, fmt.Errorf("error fetching volume: %v", err)
-	}
-	defer response.Body.Close()
-
-	if response.StatusCode != http.StatusOK {
-		return 0, fmt.Errorf("API returned non-200 status code: %d", response.StatusCode)
-	}
-
-	var data struct {
-		Bitcoin struct {
-			Volume24h float64 `json:"usd_24h_vol"`
-		} `json:"bitcoin"`
-	}
-
-	err = json.NewDecoder(response.Body).Decode(&data)
-	if err != nil {
-		return 0, fmt.Errorf("error parsing volume data: %v", err)
-	}
-
-	return data.Bitcoin.Volume24h, nil
-}
-
 // Function to fetch the Fear & Greed Index
-func getFearGreedIndex() (int, error) {
-	response, err := http.Get("https://api.alternative.me/fng/")
+func getFearGreedIndex(ctx context.Context) (int, error) {
+	response, err := httpGet(ctx, cfg.FearGreedURL+"/fng/")
 	if err != nil {
 		return 0, fmt.Errorf("error fetching Fear & Greed Index: %v", err)
 	}
@@ -267,6 +232,38 @@ func getFearGreedIndex() (int, error) {
 	return value, nil
 }
 
+// Function to fetch the Fear & Greed Index image
+func getFearGreedImage(ctx context.Context) ([]byte, error) {
+	response, err := httpGet(ctx, cfg.FearGreedImageURL)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching Fear & Greed Index image: %v", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("image returned non-200 status code: %d", response.StatusCode)
+	}
+
+	return io.ReadAll(response.Body)
+}
+
+// All-time high price and the date it was reached
+type allTimeHigh struct {
+	Price float64
+	Date  time.Time
+}
+
+// Function to fetch the all-time high of a coin in a currency
+func getATH(ctx context.Context, coin, currency string) (allTimeHigh, time.Time, error) {
+	return cached(ctx, fmt.Sprintf("ath:%s:%s", coin, currency), func(ctx context.Context) (allTimeHigh, error) {
+		price, date, err := marketData.ATH(ctx, coin, currency)
+		if err != nil {
+			return allTimeHigh{}, err
+		}
+		return allTimeHigh{Price: price, Date: date}, nil
+	})
+}
+
 // Function to send a message
 func sendMessage(chatID int64, message string) {
 	if bot == nil {
@@ -282,107 +279,161 @@ func sendMessage(chatID int64, message string) {
 }
 
 // Handle /btc command
-func handleBTCCommand(update tgbotapi.Update) {
-	log.Println("Received /btc command")
-	currentPrice, err := getBTCPrice()
+func handleBTCCommand(ctx context.Context, update tgbotapi.Update) {
+	currency, err := currencyFromArgs(update.Message.Chat.ID, strings.Fields(update.Message.CommandArguments()))
+	if err != nil {
+		sendCurrencyError(update.Message.Chat.ID)
+		return
+	}
+	currentPrice, asOf, err := getPrice(ctx, bitcoinID, currency)
 	if err != nil {
 		log.Println("Error fetching BTC price:", err)
 		sendMessage(update.Message.Chat.ID, "Error fetching BTC price.")
 		return
 	}
-	message := fmt.Sprintf("Current BTC price: $%.2f", currentPrice)
+	message := fmt.Sprintf("Current BTC price: %s", formatNumber(currentPrice, currency)) + dataAsOf(asOf)
 	sendMessage(update.Message.Chat.ID, message)
 }
 
 // Handle /block command
-func handleBlockCommand(update tgbotapi.Update) {
-	log.Println("Received /block command")
-	blockNumber, err := getBTCBlockNumber()
+func handleBlockCommand(ctx context.Context, update tgbotapi.Update) {
+	chatID := update.Message.Chat.ID
+
+	args := strings.Fields(update.Message.CommandArguments())
+	if len(args) > 1 {
+		sendMessage(chatID, "Usage: /block [height|hash]")
+		return
+	}
+
+	// Without arguments show the chain tip
+	var hash string
+	var err error
+	switch {
+	case len(args) == 0:
+		var tipHeight int64
+		tipHeight, _, err = cached(ctx, "block", func(ctx context.Context) (int64, error) {
+			return getBTCBlockNumber(ctx)
+		})
+		if err != nil {
+			log.Println("Error fetching BTC block number:", err)
+			sendMessage(chatID, "Error fetching BTC block number.")
+			return
+		}
+		hash, _, err = cached(ctx, fmt.Sprintf("block:height:%d", tipHeight), func(ctx context.Context) (string, error) {
+			return getBlockHash(ctx, tipHeight)
+		})
+	case isHash(args[0]):
+		hash = strings.ToLower(args[0])
+	default:
+		height, parseErr := strconv.ParseInt(args[0], 10, 64)
+		if parseErr != nil || height < 0 {
+			sendMessage(chatID, "Usage: /block [height|hash]")
+			return
+		}
+		hash, _, err = cached(ctx, fmt.Sprintf("block:height:%d", height), func(ctx context.Context) (string, error) {
+			return getBlockHash(ctx, height)
+		})
+	}
+	if isNotFound(err) {
+		sendMessage(chatID, "Block not found.")
+		return
+	}
 	if err != nil {
-		log.Println("Error fetching BTC block number:", err)
-		sendMessage(update.Message.Chat.ID, "Error fetching BTC block number.")
+		log.Println("Error fetching block hash:", err)
+		sendMessage(chatID, "Error fetching block.")
 		return
 	}
-	message := fmt.Sprintf("Current BTC block number: %d", blockNumber)
-	sendMessage(update.Message.Chat.ID, message)
-}
 
-// Handle /fees command
-func handleFeesCommand(update tgbotapi.Update) {
-	log.Println("Received /fees command")
-	low, medium, high, err := getBTCFees()
+	block, asOf, err := cached(ctx, "block:"+hash, func(ctx context.Context) (mempoolBlock, error) {
+		return getBlock(ctx, hash)
+	})
+	if isNotFound(err) {
+		sendMessage(chatID, "Block not found.")
+		return
+	}
 	if err != nil {
-		log.Println("Error fetching BTC fees:", err)
-		sendMessage(update.Message.Chat.ID, "Error fetching BTC fees.")
+		log.Println("Error fetching block:", err)
+		sendMessage(chatID, "Error fetching block.")
 		return
 	}
-	message := fmt.Sprintf("BTC Transaction Fees:\nLow: $%.2f\nMedium: $%.2f\nHigh: $%.2f", low, medium, high)
-	sendMessage(update.Message.Chat.ID, message)
+
+	// The previous block is only needed for the time between blocks
+	var previous *mempoolBlock
+	if block.PreviousBlockHash != "" {
+		previousBlock, _, err := cached(ctx, "block:"+block.PreviousBlockHash, func(ctx context.Context) (mempoolBlock, error) {
+			return getBlock(ctx, block.PreviousBlockHash)
+		})
+		if err != nil {
+			log.Println("Error fetching previous block:", err)
+		} else {
+			previous = &previousBlock
+		}
+	}
+
+	sendMessage(chatID, formatBlockDetails(block, previous)+dataAsOf(asOf))
 }
 
 // Handle /marketcap command
-func handleMarketCapCommand(update tgbotapi.Update) {
-	log.Println("Received /marketcap command")
-	marketCap, err := getBTCMarketCap()
+func handleMarketCapCommand(ctx context.Context, update tgbotapi.Update) {
+	currency, err := currencyFromArgs(update.Message.Chat.ID, strings.Fields(update.Message.CommandArguments()))
+	if err != nil {
+		sendCurrencyError(update.Message.Chat.ID)
+		return
+	}
+	marketCap, asOf, err := getMarketCap(ctx, bitcoinID, currency)
 	if err != nil {
 		log.Println("Error fetching BTC market cap:", err)
 		sendMessage(update.Message.Chat.ID, "Error fetching BTC market cap.")
 		return
 	}
-	message := fmt.Sprintf("Current BTC market cap: $%s", formatNumber(marketCap))
+	message := fmt.Sprintf("Current BTC market cap: %s", formatNumber(marketCap, currency)) + dataAsOf(asOf)
 	sendMessage(update.Message.Chat.ID, message)
 }
 
-// Helper function to format large numbers with commas
-func formatNumber(num float64) string {
-	p := message.NewPrinter(language.English)
-	return p.Sprintf("%0.2f", num)
-}
-
-// Helper function to format large numbers in a readable way
-func formatLargeNumber(num float64) string {
-	if num >= 1e12 {
-		return fmt.Sprintf("%.1fT", num/1e12)
-	} else if num >= 1e9 {
-		return fmt.Sprintf("%.1fB", num/1e9)
-	} else if num >= 1e6 {
-		return fmt.Sprintf("%.1fM", num/1e6)
-	} else if num >= 1e3 {
-		return fmt.Sprintf("%.1fK", num/1e3)
-	}
-	return fmt.Sprintf("%.0f", num)
-}
-
 // Handle /hashrate command
-func handleHashrateCommand(update tgbotapi.Update) {
-	log.Println("Received /hashrate command")
-	hashrate, err := getBTCHashrate()
+func handleHashrateCommand(ctx context.Context, update tgbotapi.Update) {
+	hashrate, asOf, err := cached(ctx, "hashrate", func(ctx context.Context) (float64, error) {
+		return getBTCHashrate(ctx)
+	})
 	if err != nil {
 		log.Println("Error fetching BTC hashrate:", err)
 		sendMessage(update.Message.Chat.ID, "Error fetching BTC hashrate.")
 		return
 	}
-	message := fmt.Sprintf("Current BTC hashrate: %.2f EH/s", hashrate)
+	message := fmt.Sprintf("Current BTC hashrate: %.2f EH/s", hashrate) + dataAsOf(asOf)
 	sendMessage(update.Message.Chat.ID, message)
 }
 
 // Handle /change command
-func handleChangeCommand(update tgbotapi.Update) {
-	log.Println("Received /change command")
-	currentPrice, err := getBTCPrice()
+func handleChangeCommand(ctx context.Context, update tgbotapi.Update) {
+	coin, currency, err := coinAndCurrencyFromArgs(ctx, update.Message.Chat.ID, strings.Fields(update.Message.CommandArguments()), true)
 	if err != nil {
-		log.Println("Error fetching current BTC price:", err)
-		sendMessage(update.Message.Chat.ID, "Error fetching current BTC price.")
+		sendCoinError(update.Message.Chat.ID, err)
 		return
 	}
+	symbol := strings.ToUpper(coin.Symbol)
 
-	historicalData, err := getHistoricalData()
+	currentPrice, priceAsOf, err := getPrice(ctx, coin.ID, currency)
+	if err != nil {
+		log.Printf("Error fetching current %s price: %v", symbol, err)
+		sendMessage(update.Message.Chat.ID, fmt.Sprintf("Error fetching current %s price.", symbol))
+		return
+	}
+
+	historicalData, historyAsOf, err := getHistoricalData(ctx, coin.ID, currency)
 	if err != nil {
 		log.Println("Error fetching historical data:", err)
 		sendMessage(update.Message.Chat.ID, "Error fetching historical data.")
 		return
 	}
 
+	message := fmt.Sprintf("Percentage changes in %s price (%s):\n", symbol, strings.ToUpper(currency)) + formatPriceChanges(currentPrice, historicalData)
+	message += dataAsOf(priceAsOf, historyAsOf)
+	sendMessage(update.Message.Chat.ID, message)
+}
+
+// Helper function to format the percentage change for each period, one per line
+func formatPriceChanges(currentPrice float64, historicalData map[string]float64) string {
 	// Define the order of periods
 	periods := []string{
 		"1 Day",
@@ -393,66 +444,63 @@ func handleChangeCommand(update tgbotapi.Update) {
 		"1 Year",
 	}
 
-	message := "Percentage changes in BTC price:\n"
+	message := ""
 	for _, period := range periods {
 		if historicalPrice, ok := historicalData[period]; ok {
 			change := ((currentPrice - historicalPrice) / historicalPrice) * 100
 			message += fmt.Sprintf("%s: %.2f%%\n", period, change)
 		}
 	}
-	sendMessage(update.Message.Chat.ID, message)
+	return message
 }
 
 // Handle /ath command
-func handleATHCommand(update tgbotapi.Update) {
-	log.Println("Received /ath command")
-	ath, err := getBTCATH()
+func handleATHCommand(ctx context.Context, update tgbotapi.Update) {
+	coin, currency, err := coinAndCurrencyFromArgs(ctx, update.Message.Chat.ID, strings.Fields(update.Message.CommandArguments()), true)
 	if err != nil {
-		log.Println("Error fetching BTC ATH:", err)
-		sendMessage(update.Message.Chat.ID, "Error fetching BTC all-time high.")
+		sendCoinError(update.Message.Chat.ID, err)
 		return
 	}
 
-	// Get the date of ATH
-	coin, err := gecko.NewClient(nil).CoinsID("bitcoin", false, false, true, false, false, false)
+	ath, asOf, err := getATH(ctx, coin.ID, currency)
 	if err != nil {
-		sendMessage(update.Message.Chat.ID, fmt.Sprintf("Bitcoin All-Time High: $%.2f", ath))
-		return
-	}
-
-	athDate, ok := coin.MarketData.ATHDate["usd"]
-	if !ok {
-		sendMessage(update.Message.Chat.ID, fmt.Sprintf("Bitcoin All-Time High: $%.2f", ath))
+		log.Printf("Error fetching %s ATH: %v", strings.ToUpper(coin.Symbol), err)
+		sendMessage(update.Message.Chat.ID, fmt.Sprintf("Error fetching %s all-time high.", strings.ToUpper(coin.Symbol)))
 		return
 	}
 
-	date, err := time.Parse(time.RFC3339, athDate)
-	if err != nil {
-		sendMessage(update.Message.Chat.ID, fmt.Sprintf("Bitcoin All-Time High: $%.2f", ath))
+	// The provider may not know when the ATH was reached
+	if ath.Date.IsZero() {
+		sendMessage(update.Message.Chat.ID, fmt.Sprintf("%s All-Time High: %s", coin.Name, formatNumber(ath.Price, currency))+dataAsOf(asOf))
 		return
 	}
 
-	message := fmt.Sprintf("Bitcoin All-Time High: $%.2f (reached on %s)", ath, date.Format("January 2, 2006"))
+	message := fmt.Sprintf("%s All-Time High: %s (reached on %s)", coin.Name, formatNumber(ath.Price, currency), ath.Date.Format("January 2, 2006")) + dataAsOf(asOf)
 	sendMessage(update.Message.Chat.ID, message)
 }
 
 // Handle /volume command
-func handleVolumeCommand(update tgbotapi.Update) {
-	log.Println("Received /volume command")
-	volume, err := getBTCVolume()
+func handleVolumeCommand(ctx context.Context, update tgbotapi.Update) {
+	currency, err := currencyFromArgs(update.Message.Chat.ID, strings.Fields(update.Message.CommandArguments()))
+	if err != nil {
+		sendCurrencyError(update.Message.Chat.ID)
+		return
+	}
+	volume, asOf, err := getVolume(ctx, bitcoinID, currency)
 	if err != nil {
 		log.Println("Error fetching BTC volume:", err)
 		sendMessage(update.Message.Chat.ID, "Error fetching BTC 24-hour trading volume.")
 		return
 	}
-	message := fmt.Sprintf("BTC 24-hour trading volume: $%s", formatNumber(volume))
+	message := fmt.Sprintf("BTC 24-hour trading volume: %s", formatNumber(volume, currency)) + dataAsOf(asOf)
 	sendMessage(update.Message.Chat.ID, message)
 }
 
 // Handle /feargreed command
-func handleFearGreedCommand(update tgbotapi.Update) {
-	log.Println("Received /feargreed command")
-	index, err := getFearGreedIndex()
+func handleFearGreedCommand(ctx context.Context, update tgbotapi.Update) {
+	index, asOf, err := cached(ctx, "feargreed", func(ctx context.Context) (int, error) {
+		return getFearGreedIndex(ctx)
+	})
 	if err != nil {
 		log.Println("Error fetching Fear & Greed Index:", err)
 		sendMessage(update.Message.Chat.ID, "Error fetching Fear & Greed Index.")
@@ -460,27 +508,21 @@ func handleFearGreedCommand(update tgbotapi.Update) {
 	}
 
 	// Fetch the Fear & Greed Index image
-	imageURL := fmt.Sprintf("https://alternative.me/crypto/fear-and-greed-index.png")
-	response, err := http.Get(imageURL)
+	image, _, err := cached(ctx, "feargreed_image", func(ctx context.Context) ([]byte, error) {
+		return getFearGreedImage(ctx)
+	})
 	if err != nil {
 		log.Println("Error fetching Fear & Greed Index image:", err)
 		sendMessage(update.Message.Chat.ID, "Error fetching Fear & Greed Index image.")
 		return
 	}
-	defer response.Body.Close()
-
-	if response.StatusCode != http.StatusOK {
-		log.Println("Error fetching Fear & Greed Index image: non-200 status code")
-		sendMessage(update.Message.Chat.ID, "Error fetching Fear & Greed Index image.")
-		return
-	}
 
 	// Create a new photo message
-	photo := tgbotapi.NewPhoto(update.Message.Chat.ID, tgbotapi.FileReader{
-		Name:   "fear_and_greed.png",
-		Reader: response.Body,
+	photo := tgbotapi.NewPhoto(update.Message.Chat.ID, tgbotapi.FileBytes{
+		Name:  "fear_and_greed.png",
+		Bytes: image,
 	})
-	photo.Caption = fmt.Sprintf("Current Fear & Greed Index: %d", index)
+	photo.Caption = fmt.Sprintf("Current Fear & Greed Index: %d", index) + dataAsOf(asOf)
 
 	// Send the photo
 	_, err = bot.Send(photo)
@@ -491,14 +533,17 @@ func handleFearGreedCommand(update tgbotapi.Update) {
 	}
 }
 
-// Function to scrape assets from the website
-func scrapeAssetsFromWebsite() ([]struct {
+// Asset ranked by market cap
+type asset struct {
 	Rank      int
 	Name      string
 	Symbol    string
 	MarketCap float64
-}, error) {
-	response, err := http.Get("https://companiesmarketcap.com/assets-by-market-cap/")
+}
+
+// Function to scrape assets from the website
+func scrapeAssetsFromWebsite(ctx context.Context) ([]asset, error) {
+	response, err := httpGet(ctx, cfg.CompaniesMarketCapURL+"/assets-by-market-cap/")
 	if err != nil {
 		return nil, fmt.Errorf("error fetching website: %v", err)
 	}
@@ -513,12 +558,7 @@ func scrapeAssetsFromWebsite() ([]struct {
 		return nil, fmt.Errorf("error parsing HTML: %v", err)
 	}
 
-	var assets []struct {
-		Rank      int
-		Name      string
-		Symbol    string
-		MarketCap float64
-	}
+	var assets []asset
 
 	// Try different table selectors
 	selectors := []string{
@@ -603,12 +643,7 @@ func scrapeAssetsFromWebsite() ([]struct {
 					}
 				}
 
-				assets = append(assets, struct {
-					Rank      int
-					Name      string
-					Symbol    string
-					MarketCap float64
-				}{
+				assets = append(assets, asset{
 					Rank:      rank,
 					Name:      name,
 					Symbol:    symbol,
@@ -640,35 +675,19 @@ func scrapeAssetsFromWebsite() ([]struct {
 	return assets, nil
 }
 
-// Handle /assets command
-func handleAssetsCommand(update tgbotapi.Update) {
-	log.Println("Received /assets command")
-
+// Function to fetch the top 10 assets by market cap, falling back to scraping the website
+func getTopAssets(ctx context.Context) ([]asset, error) {
 	// Try API first
-	response, err := http.Get("https://companiesmarketcap.com/api/assets/")
+	response, err := httpGet(ctx, cfg.CompaniesMarketCapURL+"/api/assets/")
 	if err != nil {
 		log.Println("API failed, trying web scraping...")
-		assets, err := scrapeAssetsFromWebsite()
-		if err != nil {
-			log.Println("Error scraping assets:", err)
-			sendMessage(update.Message.Chat.ID, "Error fetching assets list.")
-			return
-		}
-		displayAssets(update, assets)
-		return
+		return scrapeAssetsFromWebsite(ctx)
 	}
 	defer response.Body.Close()
 
 	if response.StatusCode != http.StatusOK {
 		log.Println("API returned non-200, trying web scraping...")
-		assets, err := scrapeAssetsFromWebsite()
-		if err != nil {
-			log.Println("Error scraping assets:", err)
-			sendMessage(update.Message.Chat.ID, "Error fetching assets list.")
-			return
-		}
-		displayAssets(update, assets)
-		return
+		return scrapeAssetsFromWebsite(ctx)
 	}
 
 	var data struct {
@@ -683,69 +702,105 @@ func handleAssetsCommand(update tgbotapi.Update) {
 	err = json.NewDecoder(response.Body).Decode(&data)
 	if err != nil {
 		log.Println("Error parsing API data, trying web scraping...")
-		assets, err := scrapeAssetsFromWebsite()
-		if err != nil {
-			log.Println("Error scraping assets:", err)
-			sendMessage(update.Message.Chat.ID, "Error fetching assets list.")
-			return
-		}
-		displayAssets(update, assets)
-		return
+		return scrapeAssetsFromWebsite(ctx)
 	}
 
 	// Convert API data to common format
-	var assets []struct {
-		Rank      int
-		Name      string
-		Symbol    string
-		MarketCap float64
-	}
-	for i, asset := range data.Assets {
+	var assets []asset
+	for i, item := range data.Assets {
 		if i >= 10 {
 			break
 		}
-		assets = append(assets, struct {
-			Rank      int
-			Name      string
-			Symbol    string
-			MarketCap float64
-		}{
-			Rank:      asset.Rank,
-			Name:      asset.Name,
-			Symbol:    asset.Symbol,
-			MarketCap: asset.MarketCap,
+		assets = append(assets, asset{
+			Rank:      item.Rank,
+			Name:      item.Name,
+			Symbol:    item.Symbol,
+			MarketCap: item.MarketCap,
 		})
 	}
-	displayAssets(update, assets)
+	return assets, nil
+}
+
+// Handle /assets command
+func handleAssetsCommand(ctx context.Context, update tgbotapi.Update) {
+
+	assets, asOf, err := cached(ctx, "assets", func(ctx context.Context) ([]asset, error) {
+		return getTopAssets(ctx)
+	})
+	if err != nil {
+		log.Println("Error fetching assets:", err)
+		sendMessage(update.Message.Chat.ID, "Error fetching assets list.")
+		return
+	}
+	displayAssets(update, assets, asOf)
 }
 
 // Helper function to display assets
-func displayAssets(update tgbotapi.Update, assets []struct {
-	Rank      int
-	Name      string
-	Symbol    string
-	MarketCap float64
-}) {
+func displayAssets(update tgbotapi.Update, assets []asset, asOf time.Time) {
 	message := "🏆 Top 10 Assets by Market Cap\n\n"
 	for _, asset := range assets {
 		// Check if this is Bitcoin and format accordingly
 		if strings.ToLower(asset.Name) == "bitcoin" || strings.ToLower(asset.Symbol) == "btc" {
-			message += fmt.Sprintf("%2d. 🟡 **%s** (%s)\n   $%s\n",
+			message += fmt.Sprintf("%2d. 🟡 **%s** (%s)\n   %s\n",
 				asset.Rank,
 				asset.Name,
 				asset.Symbol,
-				formatLargeNumber(asset.MarketCap))
+				formatLargeNumber(asset.MarketCap, "usd"))
 		} else {
-			message += fmt.Sprintf("%2d. %s (%s)\n   $%s\n",
+			message += fmt.Sprintf("%2d. %s (%s)\n   %s\n",
 				asset.Rank,
 				asset.Name,
 				asset.Symbol,
-				formatLargeNumber(asset.MarketCap))
+				formatLargeNumber(asset.MarketCap, "usd"))
 		}
 	}
+	message += dataAsOf(asOf)
 	sendMessage(update.Message.Chat.ID, message)
 }
 
+// Handle changes to the bot's own membership in a chat
+func handleMyChatMember(update tgbotapi.Update) {
+	member := update.MyChatMember
+	status := member.NewChatMember.Status
+	log.Printf("Bot membership in chat %d changed to %s", member.Chat.ID, status)
+
+	if status != "left" && status != "kicked" {
+		return
+	}
+
+	// The bot can no longer post here, so drop the chat's alerts, subscriptions and watches
+	if err := chats.deactivate(member.Chat.ID); err != nil {
+		log.Println("Error deactivating chat:", err)
+	}
+	if err := alerts.removeChat(member.Chat.ID); err != nil {
+		log.Println("Error removing alerts of chat:", err)
+	}
+	if _, err := subscriptions.remove(member.Chat.ID, ""); err != nil {
+		log.Println("Error removing subscriptions of chat:", err)
+	}
+	if _, err := txWatches.remove(member.Chat.ID, ""); err != nil {
+		log.Println("Error removing transaction watches of chat:", err)
+	}
+	if _, err := addressWatches.remove(member.Chat.ID, 0); err != nil {
+		log.Println("Error removing address watches of chat:", err)
+	}
+}
+
+// Function to process one update from Telegram
+func handleUpdate(ctx context.Context, update tgbotapi.Update) {
+	if update.MyChatMember != nil {
+		handleMyChatMember(update)
+	}
+	if update.Message != nil {
+		if err := chats.touch(update.Message.Chat); err != nil {
+			log.Println("Error saving chat:", err)
+		}
+		if update.Message.IsCommand() {
+			commands.route(ctx, update)
+		}
+	}
+}
+
 // HTTP handler for local testing
 func handler(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("Hello, this is the BTC Bot!"))
@@ -766,48 +821,112 @@ func main() {
 		log.Panic(err)
 	}
 
+	cfg, err = loadConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := configureCacheTTLs(cfg.CacheTTLs); err != nil {
+		log.Fatal(err)
+	}
+
+	marketData, err = newMarketDataProvider(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Println("Using market data provider:", marketData.Name())
+
+	store, err = openStore(cfg.StoragePath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	chats = &chatRepository{store: store}
+	alerts = &alertRepository{store: store}
+	subscriptions = &subscriptionRepository{store: store}
+	txWatches = &txWatchRepository{store: store}
+	addressWatches = &addressWatchRepository{store: store}
+
+	if err := configureRateLimits(cfg.RateLimits); err != nil {
+		log.Fatal(err)
+	}
+	banDuration, err := time.ParseDuration(cfg.BanDuration)
+	if err != nil {
+		log.Fatal("Invalid ban duration: ", err)
+	}
+	var banStore *Store
+	if cfg.PersistBans {
+		banStore = store
+	}
+	limiter, err = newRateLimiter(banDuration, banStore)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	commands = newCommandRouter()
+	if err := commands.publish(); err != nil {
+		log.Println("Error publishing bot commands:", err)
+	}
+
+	// Background jobs run until the process is asked to stop
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+
+	alertPollInterval, err := time.ParseDuration(cfg.AlertPollInterval)
+	if err != nil {
+		log.Fatal("Invalid alert poll interval: ", err)
+	}
+	startJob(func() { runAlertEvaluator(jobsCtx, alertPollInterval) })
+	startJob(func() { runDigestScheduler(jobsCtx) })
+
+	chainPollInterval, err := time.ParseDuration(cfg.ChainPollInterval)
+	if err != nil {
+		log.Fatal("Invalid chain poll interval: ", err)
+	}
+	startJob(func() { runTxWatcher(jobsCtx, chainPollInterval) })
+	newBlocks := newBlockListener()
+	startJob(func() { runAddressWatcher(jobsCtx, chainPollInterval, newBlocks) })
+	startJob(func() { runBlockFeed(jobsCtx) })
+
 	log.Println("Bot started and ready to receive commands!")
 
 	// Setting up command handler
-	u := tgbotapi.NewUpdate(0)
-	u.Timeout = 60
-	updates := bot.GetUpdatesChan(u)
+	var receiver updateReceiver
+	if cfg.UpdateMode == updateModeWebhook {
+		receiver, err = startWebhook()
+	} else {
+		receiver, err = startPolling()
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	handlerTimeout, err := time.ParseDuration(cfg.HandlerTimeout)
+	if err != nil {
+		log.Fatal("Invalid handler timeout: ", err)
+	}
+	shutdownTimeout, err := time.ParseDuration(cfg.ShutdownTimeout)
+	if err != nil {
+		log.Fatal("Invalid shutdown timeout: ", err)
+	}
+	// Handlers are not tied to the signal, so in-flight ones can finish while shutting down
+	handlersCtx, stopHandlers := context.WithCancel(context.Background())
+	updateDispatcher := newDispatcher(handlersCtx, cfg.Workers, handlerTimeout, handleUpdate, notifyDroppedUpdate)
+	go updateDispatcher.run(receiver.updates())
 
+	// HTTP server for local testing and command metrics, also serving the
+	// webhook in webhook mode
+	http.HandleFunc("/", handler)
+	http.Handle("/metrics", metrics)
+	server := &http.Server{Addr: cfg.ListenAddr}
 	go func() {
-		for update := range updates {
-			if update.Message != nil {
-				if update.Message.IsCommand() {
-					switch update.Message.Command() {
-					case "btc":
-						handleBTCCommand(update)
-					case "block":
-						handleBlockCommand(update)
-					case "fees":
-						handleFeesCommand(update)
-					case "marketcap":
-						handleMarketCapCommand(update)
-					case "hashrate":
-						handleHashrateCommand(update)
-					case "change":
-						handleChangeCommand(update)
-					case "ath":
-						handleATHCommand(update)
-					case "volume":
-						handleVolumeCommand(update)
-					case "feargreed":
-						handleFearGreedCommand(update)
-					case "assets":
-						handleAssetsCommand(update)
-					default:
-						log.Println("Unknown command received:", update.Message.Command())
-					}
-				}
-			}
+		log.Println("Starting server on", cfg.ListenAddr)
+		if err := server.ListenAndServe(); err != http.ErrServerClosed {
+			log.Fatal(err)
 		}
 	}()
 
-	// HTTP server for local testing
-	http.HandleFunc("/", handler)
-	log.Println("Starting server on :8080")
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	// A second signal while shutting down kills the process as usual
+	<-ctx.Done()
+	stop()
+	shutdown(time.Now().Add(shutdownTimeout), receiver, updateDispatcher, stopHandlers, stopJobs, server)
 }
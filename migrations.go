@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// Storage migrations, applied in order. Migration i brings the store from
+// schema version i to i+1. Only ever append to this list.
+var migrations = []func(dir string, tx *storeTx) error{
+	migrateImportLegacyAlerts,
+}
+
+// Migration 1: import price alerts from the alerts.json file used before the
+// storage layer existed
+func migrateImportLegacyAlerts(dir string, tx *storeTx) error {
+	path := filepath.Join(dir, "alerts.json")
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading legacy alerts file: %v", err)
+	}
+
+	var legacy []priceAlert
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		return fmt.Errorf("error parsing legacy alerts file: %v", err)
+	}
+
+	var nextID int64 = 1
+	for _, alert := range legacy {
+		if err := tx.Put(bucketAlerts, alertKey(alert.ID), alert); err != nil {
+			return err
+		}
+		if alert.ID >= nextID {
+			nextID = alert.ID + 1
+		}
+	}
+	if err := tx.Put(bucketMeta, metaNextAlertID, nextID); err != nil {
+		return err
+	}
+
+	log.Printf("Imported %d price alerts from %s", len(legacy), path)
+	return nil
+}
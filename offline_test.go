@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image/png"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"btcBot/fixtures"
+)
+
+func TestOfflineConfig(t *testing.T) {
+	c, defaults := offlineConfig("http://127.0.0.1:8090/"), defaultConfig()
+
+	urls := map[string]string{
+		"mempool":    c.MempoolURL,
+		"blockchain": c.BlockchainInfoURL,
+		"fear greed": c.FearGreedURL,
+		"image":      c.FearGreedImageURL,
+		"assets":     c.CompaniesMarketCapURL,
+		"coingecko":  c.CoinGeckoURL,
+		"kraken":     c.KrakenURL,
+		"coinbase":   c.CoinbaseURL,
+		"binance":    c.BinanceURL,
+		"explorer":   c.ExplorerURL,
+		"block feed": strings.Replace(c.MempoolWebSocketURL, "ws://", "http://", 1),
+	}
+	for name, url := range urls {
+		if !strings.HasPrefix(url, "http://127.0.0.1:8090/") || strings.Contains(url, "8090//") {
+			t.Errorf("%s URL = %s, want it on the fixture server", name, url)
+		}
+	}
+
+	// Everything but the endpoints keeps its default
+	c.MempoolURL, c.MempoolWebSocketURL, c.BlockchainInfoURL = defaults.MempoolURL, defaults.MempoolWebSocketURL, defaults.BlockchainInfoURL
+	c.FearGreedURL, c.FearGreedImageURL, c.CompaniesMarketCapURL = defaults.FearGreedURL, defaults.FearGreedImageURL, defaults.CompaniesMarketCapURL
+	c.CoinGeckoURL, c.KrakenURL, c.CoinbaseURL, c.BinanceURL = defaults.CoinGeckoURL, defaults.KrakenURL, defaults.CoinbaseURL, defaults.BinanceURL
+	c.ExplorerURL = defaults.ExplorerURL
+	if fmt.Sprintf("%+v", c) != fmt.Sprintf("%+v", defaults) {
+		t.Errorf("offline config differs from the default beyond its endpoints:\n%+v\n%+v", c, defaults)
+	}
+}
+
+func TestOfflineFixtures(t *testing.T) {
+	server := httptest.NewServer(fixtures.Handler())
+	defer server.Close()
+
+	oldCfg, oldMarketData, oldCache := cfg, marketData, upstreamCache
+	defer func() { cfg, marketData, upstreamCache = oldCfg, oldMarketData, oldCache }()
+	cfg = offlineConfig(server.URL)
+	provider, err := newMarketDataProvider(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	marketData, upstreamCache = provider, newTestCache()
+
+	const genesisTxid = "4a5e1e4baab89f3a32518a88c31bc87f618f76673e2cc77ab2127b7afdeda33b"
+	tests := []struct {
+		name  string
+		check func(ctx context.Context) error
+	}{
+		{"tip height", func(ctx context.Context) error {
+			height, err := getBTCBlockNumber(ctx)
+			if err == nil && height != 840000 {
+				err = fmt.Errorf("height %d", height)
+			}
+			return err
+		}},
+		{"fees", func(ctx context.Context) error {
+			fees, err := getRecommendedFees(ctx)
+			if err == nil && fees.FastestFee == 0 {
+				err = fmt.Errorf("no fastest fee")
+			}
+			return err
+		}},
+		{"projected blocks", func(ctx context.Context) error {
+			blocks, err := getProjectedBlocks(ctx)
+			if err == nil && len(blocks) == 0 {
+				err = fmt.Errorf("no blocks")
+			}
+			return err
+		}},
+		{"hashrate", func(ctx context.Context) error {
+			hashrate, err := getBTCHashrate(ctx)
+			if err == nil && hashrate == 0 {
+				err = fmt.Errorf("no hashrate")
+			}
+			return err
+		}},
+		{"fear greed", func(ctx context.Context) error {
+			_, err := getFearGreedIndex(ctx)
+			return err
+		}},
+		{"fear greed image", func(ctx context.Context) error {
+			image, err := getFearGreedImage(ctx)
+			if err != nil {
+				return err
+			}
+			_, err = png.Decode(bytes.NewReader(image))
+			return err
+		}},
+		{"assets", func(ctx context.Context) error {
+			assets, err := getTopAssets(ctx)
+			if err == nil && len(assets) != 10 {
+				err = fmt.Errorf("%d assets", len(assets))
+			}
+			return err
+		}},
+		{"coin list", func(ctx context.Context) error {
+			coins, err := getCoinList(ctx)
+			if err == nil && len(coins) == 0 {
+				err = fmt.Errorf("no coins")
+			}
+			return err
+		}},
+		{"price", func(ctx context.Context) error {
+			_, _, err := getPrice(ctx, bitcoinID, "eur")
+			return err
+		}},
+		{"ATH", func(ctx context.Context) error {
+			ath, _, err := getATH(ctx, bitcoinID, "usd")
+			if err == nil && ath.Date.IsZero() {
+				err = fmt.Errorf("no ATH date")
+			}
+			return err
+		}},
+		{"chart", func(ctx context.Context) error {
+			for _, chartRange := range chartRanges {
+				history, _, err := getChartHistory(ctx, bitcoinID, "usd", chartRange.days, chartRange.interval)
+				if err == nil && len(history) < 2 {
+					err = fmt.Errorf("%d prices", len(history))
+				}
+				if err != nil {
+					return fmt.Errorf("%s: %v", chartRange.name, err)
+				}
+			}
+			return nil
+		}},
+		{"candles", func(ctx context.Context) error {
+			candles, _, err := getCandles(ctx, bitcoinID, "usd", 4*time.Hour, 30)
+			if err == nil && len(candles) < 150 {
+				err = fmt.Errorf("%d candles", len(candles))
+			}
+			return err
+		}},
+		{"blocks", func(ctx context.Context) error {
+			block, err := getBlockAtHeight(ctx, 840000)
+			if err != nil {
+				return err
+			}
+			blocks, err := getBlockRange(ctx, 839997, 840000)
+			if err == nil && (len(blocks) != 3 || blocks[2].ID != block.ID) {
+				err = fmt.Errorf("range does not end at the tip")
+			}
+			return err
+		}},
+		{"transaction", func(ctx context.Context) error {
+			tx, err := getTransaction(ctx, genesisTxid)
+			if err != nil {
+				return err
+			}
+			if !tx.isCoinbase() {
+				return fmt.Errorf("genesis transaction is not a coinbase")
+			}
+			_, err = getOutspend(ctx, genesisTxid, 0)
+			return err
+		}},
+		{"address", func(ctx context.Context) error {
+			address, err := getAddressStats(ctx, "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa")
+			if err == nil && address.balance() == 0 {
+				err = fmt.Errorf("no balance")
+			}
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		if err := tt.check(context.Background()); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// errNotSupported is returned by providers that cannot serve a given data point
+var errNotSupported = errors.New("not supported by this provider")
+
+// PricePoint is a single sample of a price series
+type PricePoint struct {
+	Time  time.Time
+	Price float64
+}
+
+// Candle is the open, high, low and close price over one interval, with the
+// traded volume in the quote currency
+type Candle struct {
+	Time   time.Time
+	Open   float64
+	High   float64
+	Low    float64
+	Close  float64
+	Volume float64
+}
+
+// CoinGecko id of Bitcoin
+const bitcoinID = "bitcoin"
+
+// MarketDataProvider is a source of crypto market data. Coins are CoinGecko
+// ids such as "bitcoin" or "ethereum" and currencies are lower-case ISO codes
+// such as "usd" or "eur"; providers return errNotSupported for coins or
+// currencies they have no market for.
+type MarketDataProvider interface {
+	// Name returns the provider name used in logs and config
+	Name() string
+	// Price returns the current price
+	Price(ctx context.Context, coin, currency string) (float64, error)
+	// MarketCap returns the current market capitalisation
+	MarketCap(ctx context.Context, coin, currency string) (float64, error)
+	// Volume returns the 24-hour trading volume
+	Volume(ctx context.Context, coin, currency string) (float64, error)
+	// ATH returns the all-time high and the date it was reached
+	ATH(ctx context.Context, coin, currency string) (float64, time.Time, error)
+	// PriceHistory returns daily prices for the last given number of days, oldest first
+	PriceHistory(ctx context.Context, coin, currency string, days int) ([]PricePoint, error)
+	// Candles returns OHLC candles of the given interval for the last given number of days, oldest first
+	Candles(ctx context.Context, coin, currency string, interval time.Duration, days int) ([]Candle, error)
+}
+
+// Global market data provider used by the command handlers
+var marketData MarketDataProvider
+
+// HTTP client shared by all upstream fetches
+var httpClient = &http.Client{Timeout: 15 * time.Second}
+
+// statusError is returned by fetchJSON when an API answers with a non-200 status
+type statusError struct {
+	StatusCode int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("API returned non-200 status code: %d", e.StatusCode)
+}
+
+// candleLimitError is returned by providers that cannot serve candles of an
+// interval that far back. MaxDays is 0 when they have no such candles at all.
+type candleLimitError struct {
+	Provider string
+	Interval time.Duration
+	MaxDays  int
+}
+
+func (e *candleLimitError) Error() string {
+	if e.MaxDays == 0 {
+		return fmt.Sprintf("%s has no %s candles", e.Provider, e.Interval)
+	}
+	return fmt.Sprintf("%s serves at most %d days of %s candles", e.Provider, e.MaxDays, e.Interval)
+}
+
+// Helper function to check whether an API reported that a resource does not exist
+func isNotFound(err error) bool {
+	var statusErr *statusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound
+}
+
+// Helper function to GET a URL, giving up when ctx is done
+func httpGet(ctx context.Context, url string) (*http.Response, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return httpClient.Do(request)
+}
+
+// Helper function to GET a URL and decode the JSON response into v
+func fetchJSON(ctx context.Context, url string, v interface{}) error {
+	response, err := httpGet(ctx, url)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return &statusError{StatusCode: response.StatusCode}
+	}
+
+	return json.NewDecoder(response.Body).Decode(v)
+}
+
+// Function to create the market data provider selected in the config
+func newMarketDataProvider(c *Config) (MarketDataProvider, error) {
+	coingecko := newCoinGeckoProvider(c.CoinGeckoURL)
+
+	var primary MarketDataProvider
+	switch strings.ToLower(c.MarketDataProvider) {
+	case "", "coingecko":
+		return coingecko, nil
+	case "kraken":
+		primary = newKrakenProvider(c.KrakenURL)
+	case "coinbase":
+		primary = newCoinbaseProvider(c.CoinbaseURL)
+	case "binance":
+		primary = newBinanceProvider(c.BinanceURL)
+	default:
+		return nil, fmt.Errorf("unknown market data provider: %s", c.MarketDataProvider)
+	}
+
+	// Exchanges have no market cap or ATH data and only BTC in a few fiat pairs, so fall back to CoinGecko for those
+	return &fallbackProvider{primary: primary, fallback: coingecko}, nil
+}
+
+// fallbackProvider serves data from primary and uses fallback for anything primary does not support
+type fallbackProvider struct {
+	primary  MarketDataProvider
+	fallback MarketDataProvider
+}
+
+func (p *fallbackProvider) Name() string {
+	return p.primary.Name()
+}
+
+func (p *fallbackProvider) Price(ctx context.Context, coin, currency string) (float64, error) {
+	price, err := p.primary.Price(ctx, coin, currency)
+	if errors.Is(err, errNotSupported) {
+		return p.fallback.Price(ctx, coin, currency)
+	}
+	return price, err
+}
+
+func (p *fallbackProvider) MarketCap(ctx context.Context, coin, currency string) (float64, error) {
+	marketCap, err := p.primary.MarketCap(ctx, coin, currency)
+	if errors.Is(err, errNotSupported) {
+		log.Printf("%s has no market cap data, using %s", p.primary.Name(), p.fallback.Name())
+		return p.fallback.MarketCap(ctx, coin, currency)
+	}
+	return marketCap, err
+}
+
+func (p *fallbackProvider) Volume(ctx context.Context, coin, currency string) (float64, error) {
+	volume, err := p.primary.Volume(ctx, coin, currency)
+	if errors.Is(err, errNotSupported) {
+		return p.fallback.Volume(ctx, coin, currency)
+	}
+	return volume, err
+}
+
+func (p *fallbackProvider) ATH(ctx context.Context, coin, currency string) (float64, time.Time, error) {
+	ath, date, err := p.primary.ATH(ctx, coin, currency)
+	if errors.Is(err, errNotSupported) {
+		log.Printf("%s has no ATH data, using %s", p.primary.Name(), p.fallback.Name())
+		return p.fallback.ATH(ctx, coin, currency)
+	}
+	return ath, date, err
+}
+
+func (p *fallbackProvider) PriceHistory(ctx context.Context, coin, currency string, days int) ([]PricePoint, error) {
+	history, err := p.primary.PriceHistory(ctx, coin, currency, days)
+	if errors.Is(err, errNotSupported) {
+		return p.fallback.PriceHistory(ctx, coin, currency, days)
+	}
+	return history, err
+}
+
+func (p *fallbackProvider) Candles(ctx context.Context, coin, currency string, interval time.Duration, days int) ([]Candle, error) {
+	candles, err := p.primary.Candles(ctx, coin, currency, interval, days)
+	if errors.Is(err, errNotSupported) {
+		return p.fallback.Candles(ctx, coin, currency, interval, days)
+	}
+	return candles, err
+}
+
+// Helper function to pick the largest interval offered by a provider that
+// evenly divides the requested interval
+func nativeInterval(offered []time.Duration, interval time.Duration) (time.Duration, error) {
+	var best time.Duration
+	for _, candidate := range offered {
+		if candidate <= interval && interval%candidate == 0 && candidate > best {
+			best = candidate
+		}
+	}
+	if best == 0 {
+		return 0, fmt.Errorf("no candles available for a %s interval", interval)
+	}
+	return best, nil
+}
+
+// Function to combine consecutive candles into candles of a larger interval.
+// Candles must be sorted oldest first.
+func resampleCandles(candles []Candle, interval time.Duration) []Candle {
+	var resampled []Candle
+	for _, candle := range candles {
+		bucket := candle.Time.UTC().Truncate(interval)
+		if n := len(resampled); n > 0 && resampled[n-1].Time.Equal(bucket) {
+			last := &resampled[n-1]
+			last.High = math.Max(last.High, candle.High)
+			last.Low = math.Min(last.Low, candle.Low)
+			last.Close = candle.Close
+			last.Volume += candle.Volume
+			continue
+		}
+		candle.Time = bucket
+		resampled = append(resampled, candle)
+	}
+	return resampled
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const defaultBinanceURL = "https://api.binance.com"
+
+// Binance returns at most 1000 klines per request
+const binanceMaxKlines = 1000
+
+// binanceProvider fetches market data from the Binance spot API. USD prices come from the BTCUSDT pair.
+type binanceProvider struct {
+	baseURL string
+}
+
+func newBinanceProvider(baseURL string) *binanceProvider {
+	if baseURL == "" {
+		baseURL = defaultBinanceURL
+	}
+	return &binanceProvider{baseURL: baseURL}
+}
+
+func (p *binanceProvider) Name() string {
+	return "binance"
+}
+
+// Binance symbols by fiat currency
+var binanceSymbols = map[string]string{
+	"usd": "BTCUSDT",
+	"eur": "BTCEUR",
+	"try": "BTCTRY",
+	"brl": "BTCBRL",
+}
+
+// Function to fetch the 24-hour ticker for BTC in the given currency
+func (p *binanceProvider) ticker(ctx context.Context, coin, currency string) (price float64, volume float64, err error) {
+	symbol, ok := binanceSymbols[currency]
+	if !ok || coin != bitcoinID {
+		return 0, 0, errNotSupported
+	}
+	url := fmt.Sprintf("%s/api/v3/ticker/24hr?symbol=%s", p.baseURL, symbol)
+
+	var data struct {
+		LastPrice   string `json:"lastPrice"`
+		QuoteVolume string `json:"quoteVolume"`
+	}
+	if err := fetchJSON(ctx, url, &data); err != nil {
+		return 0, 0, err
+	}
+
+	price, err = strconv.ParseFloat(data.LastPrice, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error parsing price: %v", err)
+	}
+	volume, err = strconv.ParseFloat(data.QuoteVolume, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error parsing volume: %v", err)
+	}
+	return price, volume, nil
+}
+
+func (p *binanceProvider) Price(ctx context.Context, coin, currency string) (float64, error) {
+	price, _, err := p.ticker(ctx, coin, currency)
+	if errors.Is(err, errNotSupported) {
+		return 0, err
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error fetching price: %v", err)
+	}
+	return price, nil
+}
+
+func (p *binanceProvider) MarketCap(ctx context.Context, coin, currency string) (float64, error) {
+	return 0, errNotSupported
+}
+
+func (p *binanceProvider) Volume(ctx context.Context, coin, currency string) (float64, error) {
+	_, volume, err := p.ticker(ctx, coin, currency)
+	if errors.Is(err, errNotSupported) {
+		return 0, err
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error fetching volume: %v", err)
+	}
+	return volume, nil
+}
+
+func (p *binanceProvider) ATH(ctx context.Context, coin, currency string) (float64, time.Time, error) {
+	return 0, time.Time{}, errNotSupported
+}
+
+func (p *binanceProvider) PriceHistory(ctx context.Context, coin, currency string, days int) ([]PricePoint, error) {
+	symbol, ok := binanceSymbols[currency]
+	if !ok || coin != bitcoinID {
+		return nil, errNotSupported
+	}
+
+	limit := days + 1
+	if limit > binanceMaxKlines {
+		limit = binanceMaxKlines
+	}
+	url := fmt.Sprintf("%s/api/v3/klines?symbol=%s&interval=1d&limit=%d", p.baseURL, symbol, limit)
+
+	// Each kline is [openTime, open, high, low, close, volume, closeTime, ...]
+	var klines [][]json.RawMessage
+	if err := fetchJSON(ctx, url, &klines); err != nil {
+		return nil, fmt.Errorf("error fetching klines: %v", err)
+	}
+
+	history := make([]PricePoint, 0, len(klines))
+	for _, kline := range klines {
+		if len(kline) < 5 {
+			continue
+		}
+		var openTime int64
+		var closeText string
+		if err := json.Unmarshal(kline[0], &openTime); err != nil {
+			continue
+		}
+		if err := json.Unmarshal(kline[4], &closeText); err != nil {
+			continue
+		}
+		closePrice, err := strconv.ParseFloat(closeText, 64)
+		if err != nil {
+			continue
+		}
+		history = append(history, PricePoint{
+			Time:  time.UnixMilli(openTime),
+			Price: closePrice,
+		})
+	}
+	return history, nil
+}
+
+// Kline intervals offered by Binance
+var binanceIntervals = map[time.Duration]string{
+	time.Minute:        "1m",
+	5 * time.Minute:    "5m",
+	15 * time.Minute:   "15m",
+	30 * time.Minute:   "30m",
+	time.Hour:          "1h",
+	2 * time.Hour:      "2h",
+	4 * time.Hour:      "4h",
+	6 * time.Hour:      "6h",
+	12 * time.Hour:     "12h",
+	24 * time.Hour:     "1d",
+	7 * 24 * time.Hour: "1w",
+}
+
+func (p *binanceProvider) Candles(ctx context.Context, coin, currency string, interval time.Duration, days int) ([]Candle, error) {
+	symbol, ok := binanceSymbols[currency]
+	if !ok || coin != bitcoinID {
+		return nil, errNotSupported
+	}
+
+	offered := make([]time.Duration, 0, len(binanceIntervals))
+	for d := range binanceIntervals {
+		offered = append(offered, d)
+	}
+	native, err := nativeInterval(offered, interval)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now().AddDate(0, 0, -days)
+	url := fmt.Sprintf("%s/api/v3/klines?symbol=%s&interval=%s&startTime=%d&limit=%d",
+		p.baseURL, symbol, binanceIntervals[native], start.UnixMilli(), binanceMaxKlines)
+
+	// Each kline is [openTime, open, high, low, close, volume, closeTime, quoteVolume, ...]
+	var klines [][]json.RawMessage
+	if err := fetchJSON(ctx, url, &klines); err != nil {
+		return nil, fmt.Errorf("error fetching klines: %v", err)
+	}
+
+	candles := make([]Candle, 0, len(klines))
+	for _, kline := range klines {
+		if len(kline) < 8 {
+			continue
+		}
+		var openTime int64
+		if err := json.Unmarshal(kline[0], &openTime); err != nil {
+			continue
+		}
+		var values [5]float64
+		valid := true
+		for i, index := range []int{1, 2, 3, 4, 7} {
+			var text string
+			if err := json.Unmarshal(kline[index], &text); err != nil {
+				valid = false
+				break
+			}
+			if values[i], err = strconv.ParseFloat(text, 64); err != nil {
+				valid = false
+				break
+			}
+		}
+		if !valid {
+			continue
+		}
+		candles = append(candles, Candle{
+			Time:   time.UnixMilli(openTime),
+			Open:   values[0],
+			High:   values[1],
+			Low:    values[2],
+			Close:  values[3],
+			Volume: values[4],
+		})
+	}
+	return resampleCandles(candles, interval), nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Responses of the Binance API, trimmed to a few entries
+var binanceResponses = map[string]string{
+	"/api/v3/ticker/24hr": `{"symbol":"BTCUSDT","priceChange":"1012.50000000","priceChangePercent":"1.607","weightedAvgPrice":"63658.31",
+		"lastPrice":"64012.50000000","volume":"28470.12345000","quoteVolume":"1812345678.12000000","openTime":1713485160000,
+		"closeTime":1713571560000,"count":2109854}`,
+	// Each kline is [openTime, open, high, low, close, volume, closeTime, quoteVolume, trades, takerBase, takerQuote, ignore]
+	"/api/v3/klines": `[
+		[1713484800000,"63000.00","63500.00","62800.00","63400.00","100.5",1713488399999,"6361500.00",25000,"50.2","3180000.00","0"],
+		[1713488400000,"63400.00","64100.00","63300.00","64000.00","120.0",1713491999999,"7656000.00",31000,"60.0","3828000.00","0"],
+		[1713492000000,"64000.00","64200.00","63800.00","64012.50","80.0",1713495599999,"5119000.00",21000,"40.0","2560000.00","0"]]`,
+}
+
+func TestBinanceProvider(t *testing.T) {
+	server := newProviderServer(t, binanceResponses)
+	provider := newBinanceProvider(server.URL)
+	ctx := context.Background()
+
+	price, err := provider.Price(ctx, bitcoinID, "usd")
+	if err != nil || price != 64012.5 {
+		t.Errorf("Price = %v, %v", price, err)
+	}
+	// Volume is the quote volume, already in the fiat currency
+	volume, err := provider.Volume(ctx, bitcoinID, "usd")
+	if err != nil || volume != 1812345678.12 {
+		t.Errorf("Volume = %v, %v", volume, err)
+	}
+
+	history, err := provider.PriceHistory(ctx, bitcoinID, "usd", 2)
+	if err != nil || len(history) != 3 || history[2].Price != 64012.5 || !history[2].Time.Equal(time.UnixMilli(1713492000000)) {
+		t.Errorf("PriceHistory = %v, %v", history, err)
+	}
+	if requests := server.made(); !strings.Contains(requests[len(requests)-1], "symbol=BTCUSDT&interval=1d&limit=3") {
+		t.Errorf("requested %s", requests[len(requests)-1])
+	}
+
+	candles, err := provider.Candles(ctx, bitcoinID, "usd", time.Hour, 1)
+	if err != nil || len(candles) != 3 || candles[0].Open != 63000 || candles[0].Volume != 6361500 {
+		t.Errorf("Candles = %+v, %v", candles, err)
+	}
+	if requests := server.made(); !strings.Contains(requests[len(requests)-1], "interval=1h") {
+		t.Errorf("requested %s", requests[len(requests)-1])
+	}
+
+	// Unsupported pairs are left to the fallback without asking Binance
+	before := len(server.made())
+	unsupported := []func() error{
+		func() error { _, err := provider.Price(ctx, "ethereum", "usd"); return err },
+		func() error { _, err := provider.Price(ctx, bitcoinID, "gbp"); return err },
+		func() error { _, err := provider.MarketCap(ctx, bitcoinID, "usd"); return err },
+		func() error { _, _, err := provider.ATH(ctx, bitcoinID, "usd"); return err },
+	}
+	for i, fetch := range unsupported {
+		if err := fetch(); !errors.Is(err, errNotSupported) {
+			t.Errorf("unsupported fetch %d returned %v", i, err)
+		}
+	}
+	if len(server.made()) != before {
+		t.Error("unsupported fetches were sent to Binance")
+	}
+}
+
+func TestBinanceProviderErrors(t *testing.T) {
+	server := newProviderServer(t, map[string]string{
+		"/api/v3/ticker/24hr": `400 {"code":-1121,"msg":"Invalid symbol."}`,
+		"/api/v3/klines":      `[[1713484800000,"63000.00","63500.00","62800.00"],["bad"]]`,
+	})
+	provider := newBinanceProvider(server.URL)
+	ctx := context.Background()
+
+	if _, err := provider.Price(ctx, bitcoinID, "usd"); err == nil || !strings.Contains(err.Error(), "400") {
+		t.Errorf("Price returned %v, want the 400 status", err)
+	}
+
+	// Malformed klines are skipped
+	candles, err := provider.Candles(ctx, bitcoinID, "usd", time.Hour, 1)
+	if err != nil || len(candles) != 0 {
+		t.Errorf("Candles = %v, %v", candles, err)
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultCoinbaseURL = "https://api.exchange.coinbase.com"
+
+// Coinbase returns at most 300 candles per request
+const coinbaseMaxCandles = 300
+
+// coinbaseProvider fetches market data from the Coinbase Exchange public API
+type coinbaseProvider struct {
+	baseURL string
+}
+
+func newCoinbaseProvider(baseURL string) *coinbaseProvider {
+	if baseURL == "" {
+		baseURL = defaultCoinbaseURL
+	}
+	return &coinbaseProvider{baseURL: baseURL}
+}
+
+func (p *coinbaseProvider) Name() string {
+	return "coinbase"
+}
+
+// Fiat currencies Coinbase lists BTC against
+var coinbaseCurrencies = map[string]bool{
+	"usd": true,
+	"eur": true,
+	"gbp": true,
+}
+
+// Helper function to build the Coinbase product ID for BTC in a currency
+func coinbaseProduct(coin, currency string) (string, error) {
+	if !coinbaseCurrencies[currency] || coin != bitcoinID {
+		return "", errNotSupported
+	}
+	return "BTC-" + strings.ToUpper(currency), nil
+}
+
+// Function to fetch the 24-hour stats for BTC in the given currency
+func (p *coinbaseProvider) stats(ctx context.Context, coin, currency string) (last float64, volume float64, err error) {
+	product, err := coinbaseProduct(coin, currency)
+	if err != nil {
+		return 0, 0, err
+	}
+	url := fmt.Sprintf("%s/products/%s/stats", p.baseURL, product)
+
+	var data struct {
+		Last   string `json:"last"`
+		Volume string `json:"volume"`
+	}
+	if err := fetchJSON(ctx, url, &data); err != nil {
+		return 0, 0, err
+	}
+
+	last, err = strconv.ParseFloat(data.Last, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error parsing price: %v", err)
+	}
+	volume, err = strconv.ParseFloat(data.Volume, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error parsing volume: %v", err)
+	}
+
+	// Volume is quoted in BTC
+	return last, volume * last, nil
+}
+
+func (p *coinbaseProvider) Price(ctx context.Context, coin, currency string) (float64, error) {
+	price, _, err := p.stats(ctx, coin, currency)
+	if errors.Is(err, errNotSupported) {
+		return 0, err
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error fetching price: %v", err)
+	}
+	return price, nil
+}
+
+func (p *coinbaseProvider) MarketCap(ctx context.Context, coin, currency string) (float64, error) {
+	return 0, errNotSupported
+}
+
+func (p *coinbaseProvider) Volume(ctx context.Context, coin, currency string) (float64, error) {
+	_, volume, err := p.stats(ctx, coin, currency)
+	if errors.Is(err, errNotSupported) {
+		return 0, err
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error fetching volume: %v", err)
+	}
+	return volume, nil
+}
+
+func (p *coinbaseProvider) ATH(ctx context.Context, coin, currency string) (float64, time.Time, error) {
+	return 0, time.Time{}, errNotSupported
+}
+
+func (p *coinbaseProvider) PriceHistory(ctx context.Context, coin, currency string, days int) ([]PricePoint, error) {
+	product, err := coinbaseProduct(coin, currency)
+	if err != nil {
+		return nil, err
+	}
+
+	end := time.Now().UTC()
+	start := end.AddDate(0, 0, -days)
+
+	var history []PricePoint
+	// Page through the range in windows of at most 300 daily candles
+	for windowStart := start; windowStart.Before(end); {
+		windowEnd := windowStart.AddDate(0, 0, coinbaseMaxCandles)
+		if windowEnd.After(end) {
+			windowEnd = end
+		}
+
+		url := fmt.Sprintf("%s/products/%s/candles?granularity=86400&start=%s&end=%s",
+			p.baseURL, product, windowStart.Format(time.RFC3339), windowEnd.Format(time.RFC3339))
+
+		// Each candle is [time, low, high, open, close, volume]
+		var candles [][6]float64
+		if err := fetchJSON(ctx, url, &candles); err != nil {
+			return nil, fmt.Errorf("error fetching candles: %v", err)
+		}
+
+		for _, candle := range candles {
+			history = append(history, PricePoint{
+				Time:  time.Unix(int64(candle[0]), 0),
+				Price: candle[4],
+			})
+		}
+		windowStart = windowEnd
+	}
+
+	// Coinbase returns candles newest first
+	sort.Slice(history, func(i, j int) bool {
+		return history[i].Time.Before(history[j].Time)
+	})
+	return history, nil
+}
+
+// Candle intervals offered by Coinbase
+var coinbaseIntervals = []time.Duration{
+	time.Minute,
+	5 * time.Minute,
+	15 * time.Minute,
+	time.Hour,
+	6 * time.Hour,
+	24 * time.Hour,
+}
+
+func (p *coinbaseProvider) Candles(ctx context.Context, coin, currency string, interval time.Duration, days int) ([]Candle, error) {
+	product, err := coinbaseProduct(coin, currency)
+	if err != nil {
+		return nil, err
+	}
+	native, err := nativeInterval(coinbaseIntervals, interval)
+	if err != nil {
+		return nil, err
+	}
+
+	end := time.Now().UTC()
+	start := end.AddDate(0, 0, -days)
+
+	var candles []Candle
+	// Page through the range in windows of at most 300 candles
+	for windowStart := start; windowStart.Before(end); {
+		windowEnd := windowStart.Add(native * coinbaseMaxCandles)
+		if windowEnd.After(end) {
+			windowEnd = end
+		}
+
+		url := fmt.Sprintf("%s/products/%s/candles?granularity=%d&start=%s&end=%s",
+			p.baseURL, product, int(native.Seconds()), windowStart.Format(time.RFC3339), windowEnd.Format(time.RFC3339))
+
+		// Each candle is [time, low, high, open, close, volume]
+		var data [][6]float64
+		if err := fetchJSON(ctx, url, &data); err != nil {
+			return nil, fmt.Errorf("error fetching candles: %v", err)
+		}
+
+		for _, candle := range data {
+			candles = append(candles, Candle{
+				Time:  time.Unix(int64(candle[0]), 0),
+				Open:  candle[3],
+				High:  candle[2],
+				Low:   candle[1],
+				Close: candle[4],
+				// Volume is quoted in BTC
+				Volume: candle[5] * candle[4],
+			})
+		}
+		windowStart = windowEnd
+	}
+
+	// Coinbase returns candles newest first
+	sort.Slice(candles, func(i, j int) bool {
+		return candles[i].Time.Before(candles[j].Time)
+	})
+	return resampleCandles(candles, interval), nil
+}
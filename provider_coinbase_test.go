@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Responses of the Coinbase Exchange API, trimmed to a few entries
+var coinbaseResponses = map[string]string{
+	"/products/BTC-USD/stats": `{"open":"63000.00","high":"64500.00","low":"62500.00","last":"64012.50","volume":"12345.67890000",
+		"volume_30day":"350123.12345678"}`,
+	// Each candle is [time, low, high, open, close, volume], newest first
+	"/products/BTC-USD/candles": `[[1713492000,63800.0,64200.0,64000.0,64012.5,80.0],[1713488400,63300.0,64100.0,63400.0,64000.0,120.0],
+		[1713484800,62800.0,63500.0,63000.0,63400.0,100.5]]`,
+	"/products/BTC-EUR/stats": `404 {"message":"NotFound"}`,
+}
+
+func TestCoinbaseProvider(t *testing.T) {
+	server := newProviderServer(t, coinbaseResponses)
+	provider := newCoinbaseProvider(server.URL)
+	ctx := context.Background()
+
+	price, err := provider.Price(ctx, bitcoinID, "usd")
+	if err != nil || price != 64012.5 {
+		t.Errorf("Price = %v, %v", price, err)
+	}
+	// Volume is quoted in BTC and converted at the last price
+	volume, err := provider.Volume(ctx, bitcoinID, "usd")
+	if err != nil || math.Abs(volume-12345.6789*64012.5) > 1e-3 {
+		t.Errorf("Volume = %v, %v", volume, err)
+	}
+	if _, err := provider.Price(ctx, bitcoinID, "eur"); err == nil || errors.Is(err, errNotSupported) {
+		t.Errorf("Price in a missing product returned %v", err)
+	}
+	if _, err := provider.Price(ctx, bitcoinID, "jpy"); !errors.Is(err, errNotSupported) {
+		t.Errorf("Price in an unlisted currency returned %v", err)
+	}
+
+	// History is sorted oldest first
+	history, err := provider.PriceHistory(ctx, bitcoinID, "usd", 30)
+	if err != nil || len(history) != 3 || history[0].Price != 63400 || history[2].Price != 64012.5 {
+		t.Errorf("PriceHistory = %v, %v", history, err)
+	}
+}
+
+func TestCoinbaseCandlesPaging(t *testing.T) {
+	tests := []struct {
+		interval        time.Duration
+		days            int
+		wantGranularity string
+		wantRequests    int
+	}{
+		{time.Hour, 7, "granularity=3600", 1},
+		// 720 hourly candles take three requests of at most 300
+		{4 * time.Hour, 30, "granularity=3600", 3},
+		{24 * time.Hour, 365, "granularity=86400", 2},
+	}
+	for _, tt := range tests {
+		server := newProviderServer(t, coinbaseResponses)
+		provider := newCoinbaseProvider(server.URL)
+
+		candles, err := provider.Candles(context.Background(), bitcoinID, "usd", tt.interval, tt.days)
+		if err != nil || len(candles) == 0 {
+			t.Errorf("%s candles over %d days = %d, %v", tt.interval, tt.days, len(candles), err)
+			continue
+		}
+		for i := 1; i < len(candles); i++ {
+			if !candles[i-1].Time.Before(candles[i].Time) {
+				t.Errorf("%s candles are not sorted oldest first", tt.interval)
+				break
+			}
+		}
+
+		requests := server.made()
+		if len(requests) != tt.wantRequests {
+			t.Errorf("%s candles over %d days took %d requests, want %d", tt.interval, tt.days, len(requests), tt.wantRequests)
+		}
+		for _, request := range requests {
+			if !strings.Contains(request, tt.wantGranularity) {
+				t.Errorf("requested %s, want %s", request, tt.wantGranularity)
+			}
+		}
+	}
+}
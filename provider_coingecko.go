@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const defaultCoinGeckoURL = "https://api.coingecko.com/api/v3"
+
+// coinGeckoProvider fetches market data from the CoinGecko v3 API
+type coinGeckoProvider struct {
+	baseURL string
+}
+
+func newCoinGeckoProvider(baseURL string) *coinGeckoProvider {
+	if baseURL == "" {
+		baseURL = defaultCoinGeckoURL
+	}
+	return &coinGeckoProvider{baseURL: baseURL}
+}
+
+func (p *coinGeckoProvider) Name() string {
+	return "coingecko"
+}
+
+// Function to fetch a single field from the simple price endpoint
+func (p *coinGeckoProvider) simplePrice(ctx context.Context, coin, currency, field string) (float64, error) {
+	url := fmt.Sprintf("%s/simple/price?ids=%s&vs_currencies=%s&include_market_cap=true&include_24hr_vol=true", p.baseURL, coin, currency)
+
+	var data map[string]map[string]float64
+	if err := fetchJSON(ctx, url, &data); err != nil {
+		return 0, err
+	}
+
+	value, ok := data[coin][field]
+	if !ok {
+		return 0, fmt.Errorf("%s not found in CoinGecko response", field)
+	}
+	return value, nil
+}
+
+func (p *coinGeckoProvider) Price(ctx context.Context, coin, currency string) (float64, error) {
+	price, err := p.simplePrice(ctx, coin, currency, currency)
+	if err != nil {
+		return 0, fmt.Errorf("error fetching price: %v", err)
+	}
+	return price, nil
+}
+
+func (p *coinGeckoProvider) MarketCap(ctx context.Context, coin, currency string) (float64, error) {
+	marketCap, err := p.simplePrice(ctx, coin, currency, currency+"_market_cap")
+	if err != nil {
+		return 0, fmt.Errorf("error fetching market cap: %v", err)
+	}
+	return marketCap, nil
+}
+
+func (p *coinGeckoProvider) Volume(ctx context.Context, coin, currency string) (float64, error) {
+	volume, err := p.simplePrice(ctx, coin, currency, currency+"_24h_vol")
+	if err != nil {
+		return 0, fmt.Errorf("error fetching volume: %v", err)
+	}
+	return volume, nil
+}
+
+func (p *coinGeckoProvider) ATH(ctx context.Context, coin, currency string) (float64, time.Time, error) {
+	url := fmt.Sprintf("%s/coins/markets?vs_currency=%s&ids=%s", p.baseURL, currency, coin)
+
+	var data []struct {
+		ATH     float64 `json:"ath"`
+		ATHDate string  `json:"ath_date"`
+	}
+	if err := fetchJSON(ctx, url, &data); err != nil {
+		return 0, time.Time{}, fmt.Errorf("error fetching coin data: %v", err)
+	}
+
+	if len(data) == 0 {
+		return 0, time.Time{}, fmt.Errorf("ATH data not found")
+	}
+
+	// Return ATH even if we can't parse the date
+	date, err := time.Parse(time.RFC3339, data[0].ATHDate)
+	if err != nil {
+		return data[0].ATH, time.Time{}, nil
+	}
+
+	return data[0].ATH, date, nil
+}
+
+func (p *coinGeckoProvider) PriceHistory(ctx context.Context, coin, currency string, days int) ([]PricePoint, error) {
+	url := fmt.Sprintf("%s/coins/%s/market_chart?vs_currency=%s&days=%d", p.baseURL, coin, currency, days)
+
+	var data struct {
+		Prices [][2]float64 `json:"prices"`
+	}
+	if err := fetchJSON(ctx, url, &data); err != nil {
+		return nil, fmt.Errorf("error fetching market chart: %v", err)
+	}
+
+	history := make([]PricePoint, 0, len(data.Prices))
+	for _, pricePoint := range data.Prices {
+		history = append(history, PricePoint{
+			Time:  time.UnixMilli(int64(pricePoint[0])),
+			Price: pricePoint[1],
+		})
+	}
+	return history, nil
+}
+
+// Ranges accepted by the CoinGecko OHLC endpoint, in days
+var coinGeckoOHLCDays = []int{1, 7, 14, 30, 90, 180, 365}
+
+// Function to get the candle size CoinGecko picks for a range: 30 minutes
+// for up to 2 days, 4 hours for up to 30 days and 4 days beyond that
+func coinGeckoCandleSize(days int) time.Duration {
+	if days <= 2 {
+		return 30 * time.Minute
+	} else if days <= 30 {
+		return 4 * time.Hour
+	}
+	return 4 * 24 * time.Hour
+}
+
+func (p *coinGeckoProvider) Candles(ctx context.Context, coin, currency string, interval time.Duration, days int) ([]Candle, error) {
+	// Use the shortest range covering the request whose candles add up to the
+	// interval, as longer ranges come in coarser candles
+	requestDays, maxDays := 0, 0
+	for _, d := range coinGeckoOHLCDays {
+		if interval%coinGeckoCandleSize(d) != 0 {
+			continue
+		}
+		maxDays = d
+		if d >= days {
+			requestDays = d
+			break
+		}
+	}
+	if requestDays == 0 {
+		return nil, &candleLimitError{Provider: "CoinGecko", Interval: interval, MaxDays: maxDays}
+	}
+	native := coinGeckoCandleSize(requestDays)
+
+	url := fmt.Sprintf("%s/coins/%s/ohlc?vs_currency=%s&days=%d", p.baseURL, coin, currency, requestDays)
+
+	// Each candle is [time, open, high, low, close] and has no volume
+	var data [][5]float64
+	if err := fetchJSON(ctx, url, &data); err != nil {
+		return nil, fmt.Errorf("error fetching OHLC data: %v", err)
+	}
+
+	candles := make([]Candle, 0, len(data))
+	for _, candle := range data {
+		candles = append(candles, Candle{
+			// CoinGecko timestamps the close of each candle
+			Time:  time.UnixMilli(int64(candle[0])).Add(-native),
+			Open:  candle[1],
+			High:  candle[2],
+			Low:   candle[3],
+			Close: candle[4],
+		})
+	}
+	return resampleCandles(candles, interval), nil
+}
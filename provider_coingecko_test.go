@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Responses of the CoinGecko API, trimmed to a few entries
+var coinGeckoResponses = map[string]string{
+	"/simple/price": `{"bitcoin":{"usd":64012.5,"usd_market_cap":1260412873561.2,"usd_24h_vol":28301937552.4}}`,
+	"/coins/markets": `[{"id":"bitcoin","symbol":"btc","name":"Bitcoin","image":"https://coin-images.coingecko.com/coins/images/1/large/bitcoin.png",
+		"current_price":64012.5,"market_cap":1260412873561,"market_cap_rank":1,"ath":73738,"ath_change_percentage":-13.19,
+		"ath_date":"2024-03-14T07:10:36.635Z","atl":67.81,"atl_date":"2013-07-06T00:00:00.000Z"}]`,
+	"/coins/bitcoin/market_chart": `{"prices":[[1713398400000,61275.3],[1713484800000,63811.9],[1713571200000,64012.5]],
+		"market_caps":[[1713398400000,1206564710313.6],[1713484800000,1256490217394.1],[1713571200000,1260412873561.2]],
+		"total_volumes":[[1713398400000,41370394101.2],[1713484800000,48592017326.4],[1713571200000,28301937552.4]]}`,
+	"/coins/bitcoin/ohlc": `[[1713384000000,61000.0,61400.0,60800.0,61275.3],[1713398400000,61275.3,62100.0,61200.0,62050.0],
+		[1713412800000,62050.0,62300.0,61900.0,62200.0],[1713427200000,62200.0,64100.0,62150.0,63811.9]]`,
+	"/coins/ethereum/ohlc": `429 {"status":{"error_code":429,"error_message":"You've exceeded the Rate Limit."}}`,
+}
+
+func TestCoinGeckoProvider(t *testing.T) {
+	server := newProviderServer(t, coinGeckoResponses)
+	provider := newCoinGeckoProvider(server.URL)
+	ctx := context.Background()
+
+	tests := []struct {
+		name  string
+		fetch func() (float64, error)
+		want  float64
+	}{
+		{"price", func() (float64, error) { return provider.Price(ctx, bitcoinID, "usd") }, 64012.5},
+		{"market cap", func() (float64, error) { return provider.MarketCap(ctx, bitcoinID, "usd") }, 1260412873561.2},
+		{"volume", func() (float64, error) { return provider.Volume(ctx, bitcoinID, "usd") }, 28301937552.4},
+	}
+	for _, tt := range tests {
+		got, err := tt.fetch()
+		if err != nil || got != tt.want {
+			t.Errorf("%s = %v, %v, want %v", tt.name, got, err, tt.want)
+		}
+	}
+	if _, err := provider.Price(ctx, bitcoinID, "eur"); err == nil {
+		t.Error("price in a currency missing from the response did not fail")
+	}
+
+	ath, date, err := provider.ATH(ctx, bitcoinID, "usd")
+	if err != nil || ath != 73738 || !date.Equal(time.Date(2024, 3, 14, 7, 10, 36, 635e6, time.UTC)) {
+		t.Errorf("ATH = %v at %s, %v", ath, date, err)
+	}
+
+	history, err := provider.PriceHistory(ctx, bitcoinID, "usd", 2)
+	if err != nil || len(history) != 3 || history[2].Price != 64012.5 || !history[2].Time.Equal(time.UnixMilli(1713571200000)) {
+		t.Errorf("PriceHistory = %v, %v", history, err)
+	}
+}
+
+func TestCoinGeckoCandles(t *testing.T) {
+	server := newProviderServer(t, coinGeckoResponses)
+	provider := newCoinGeckoProvider(server.URL)
+	ctx := context.Background()
+
+	tests := []struct {
+		name        string
+		coin        string
+		interval    time.Duration
+		days        int
+		wantRequest string
+		wantCandles int
+		wantErr     bool
+	}{
+		{"native candles", bitcoinID, 4 * time.Hour, 7, "days=7", 4, false},
+		{"range rounded up", bitcoinID, 4 * time.Hour, 10, "days=14", 4, false},
+		{"resampled", bitcoinID, 8 * time.Hour, 7, "days=7", 2, false},
+		{"finer than native", bitcoinID, time.Hour, 7, "", 0, true},
+		{"finer range", bitcoinID, time.Hour, 1, "days=1", 4, false},
+		{"rate limited", "ethereum", 4 * time.Hour, 7, "days=7", 0, true},
+	}
+	for _, tt := range tests {
+		before := len(server.made())
+		candles, err := provider.Candles(ctx, tt.coin, "usd", tt.interval, tt.days)
+		if (err != nil) != tt.wantErr || len(candles) != tt.wantCandles {
+			t.Errorf("%s: got %d candles, %v", tt.name, len(candles), err)
+		}
+
+		requests := server.made()[before:]
+		if tt.wantRequest == "" {
+			if len(requests) != 0 {
+				t.Errorf("%s: requested %v", tt.name, requests)
+			}
+			continue
+		}
+		if len(requests) != 1 || !strings.Contains(requests[0], tt.wantRequest) {
+			t.Errorf("%s: requested %v, want %s", tt.name, requests, tt.wantRequest)
+		}
+	}
+
+	// Candles are stamped at their open, CoinGecko stamps them at their close
+	candles, _ := provider.Candles(ctx, bitcoinID, "usd", 4*time.Hour, 7)
+	first := candles[0]
+	if !first.Time.Equal(time.UnixMilli(1713384000000).Add(-4*time.Hour)) || first.Open != 61000 || first.Close != 61275.3 {
+		t.Errorf("first candle = %+v", first)
+	}
+}
+
+func TestCoinGeckoCandleLimits(t *testing.T) {
+	server := newProviderServer(t, coinGeckoResponses)
+	provider := newCoinGeckoProvider(server.URL)
+
+	// Every /candles interval over its default range, and a few explicit ranges
+	tests := []struct {
+		interval    time.Duration
+		days        int
+		wantRequest string
+		wantMaxDays int
+	}{
+		{15 * time.Minute, 1, "", 0},
+		{30 * time.Minute, 1, "days=1", 0},
+		{time.Hour, 7, "", 1},
+		{time.Hour, 1, "days=1", 0},
+		{4 * time.Hour, 30, "days=30", 0},
+		{4 * time.Hour, 90, "", 30},
+		{6 * time.Hour, 30, "", 1},
+		{12 * time.Hour, 90, "", 30},
+		{12 * time.Hour, 14, "days=14", 0},
+		{24 * time.Hour, 180, "", 30},
+		{24 * time.Hour, 30, "days=30", 0},
+		{7 * 24 * time.Hour, 365, "", 30},
+		{8 * 24 * time.Hour, 365, "days=365", 0},
+	}
+	for _, tt := range tests {
+		before := len(server.made())
+		_, err := provider.Candles(context.Background(), bitcoinID, "usd", tt.interval, tt.days)
+		requests := server.made()[before:]
+
+		if tt.wantRequest != "" {
+			if err != nil || len(requests) != 1 || !strings.Contains(requests[0], tt.wantRequest) {
+				t.Errorf("%s candles over %d days: requested %v, %v, want %s", tt.interval, tt.days, requests, err, tt.wantRequest)
+			}
+			continue
+		}
+		var limitErr *candleLimitError
+		if !errors.As(err, &limitErr) || limitErr.MaxDays != tt.wantMaxDays {
+			t.Errorf("%s candles over %d days: got %v, want a limit of %d days", tt.interval, tt.days, err, tt.wantMaxDays)
+		}
+		if len(requests) != 0 {
+			t.Errorf("%s candles over %d days requested %v", tt.interval, tt.days, requests)
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultKrakenURL = "https://api.kraken.com"
+
+// Kraken returns at most the 720 most recent candles of any interval
+const krakenMaxCandles = 720
+
+// krakenProvider fetches market data from the Kraken public REST API
+type krakenProvider struct {
+	baseURL string
+}
+
+func newKrakenProvider(baseURL string) *krakenProvider {
+	if baseURL == "" {
+		baseURL = defaultKrakenURL
+	}
+	return &krakenProvider{baseURL: baseURL}
+}
+
+func (p *krakenProvider) Name() string {
+	return "kraken"
+}
+
+// Kraken pair names by fiat currency
+var krakenPairs = map[string]string{
+	"usd": "XBTUSD",
+	"eur": "XBTEUR",
+	"gbp": "XBTGBP",
+	"jpy": "XBTJPY",
+	"chf": "XBTCHF",
+	"cad": "XBTCAD",
+	"aud": "XBTAUD",
+}
+
+// Function to call a Kraken public endpoint and return the entry for our pair
+func (p *krakenProvider) public(ctx context.Context, path string) (json.RawMessage, error) {
+	url := fmt.Sprintf("%s/0/public/%s", p.baseURL, path)
+
+	var data struct {
+		Error  []string                   `json:"error"`
+		Result map[string]json.RawMessage `json:"result"`
+	}
+	if err := fetchJSON(ctx, url, &data); err != nil {
+		return nil, err
+	}
+
+	if len(data.Error) > 0 {
+		return nil, fmt.Errorf("kraken error: %s", strings.Join(data.Error, ", "))
+	}
+
+	// Kraken keys the result by its own pair name (e.g. XXBTZUSD)
+	for key, value := range data.Result {
+		if key != "last" {
+			return value, nil
+		}
+	}
+	return nil, fmt.Errorf("no result returned from Kraken")
+}
+
+// Function to fetch the 24-hour ticker for BTC in the given currency
+func (p *krakenProvider) ticker(ctx context.Context, coin, currency string) (price float64, volume float64, err error) {
+	pair, ok := krakenPairs[currency]
+	if !ok || coin != bitcoinID {
+		return 0, 0, errNotSupported
+	}
+
+	raw, err := p.public(ctx, "Ticker?pair="+pair)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var ticker struct {
+		Last   []string `json:"c"`
+		Volume []string `json:"v"`
+		VWAP   []string `json:"p"`
+	}
+	if err := json.Unmarshal(raw, &ticker); err != nil {
+		return 0, 0, fmt.Errorf("error parsing ticker data: %v", err)
+	}
+
+	if len(ticker.Last) < 1 || len(ticker.Volume) < 2 || len(ticker.VWAP) < 2 {
+		return 0, 0, fmt.Errorf("incomplete ticker data")
+	}
+
+	price, err = strconv.ParseFloat(ticker.Last[0], 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error parsing price: %v", err)
+	}
+
+	// Volume is quoted in BTC, convert it to fiat using the 24-hour VWAP
+	baseVolume, err := strconv.ParseFloat(ticker.Volume[1], 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error parsing volume: %v", err)
+	}
+	vwap, err := strconv.ParseFloat(ticker.VWAP[1], 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error parsing VWAP: %v", err)
+	}
+
+	return price, baseVolume * vwap, nil
+}
+
+func (p *krakenProvider) Price(ctx context.Context, coin, currency string) (float64, error) {
+	price, _, err := p.ticker(ctx, coin, currency)
+	if errors.Is(err, errNotSupported) {
+		return 0, err
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error fetching price: %v", err)
+	}
+	return price, nil
+}
+
+func (p *krakenProvider) MarketCap(ctx context.Context, coin, currency string) (float64, error) {
+	return 0, errNotSupported
+}
+
+func (p *krakenProvider) Volume(ctx context.Context, coin, currency string) (float64, error) {
+	_, volume, err := p.ticker(ctx, coin, currency)
+	if errors.Is(err, errNotSupported) {
+		return 0, err
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error fetching volume: %v", err)
+	}
+	return volume, nil
+}
+
+func (p *krakenProvider) ATH(ctx context.Context, coin, currency string) (float64, time.Time, error) {
+	return 0, time.Time{}, errNotSupported
+}
+
+func (p *krakenProvider) PriceHistory(ctx context.Context, coin, currency string, days int) ([]PricePoint, error) {
+	pair, ok := krakenPairs[currency]
+	if !ok || coin != bitcoinID {
+		return nil, errNotSupported
+	}
+
+	// 720 daily candles cover just under two years
+	since := time.Now().AddDate(0, 0, -days).Unix()
+	raw, err := p.public(ctx, fmt.Sprintf("OHLC?pair=%s&interval=1440&since=%d", pair, since))
+	if err != nil {
+		return nil, fmt.Errorf("error fetching OHLC data: %v", err)
+	}
+
+	// Each candle is [time, open, high, low, close, vwap, volume, count]
+	var candles [][]interface{}
+	if err := json.Unmarshal(raw, &candles); err != nil {
+		return nil, fmt.Errorf("error parsing OHLC data: %v", err)
+	}
+
+	history := make([]PricePoint, 0, len(candles))
+	for _, candle := range candles {
+		if len(candle) < 5 {
+			continue
+		}
+		timestamp, ok := candle[0].(float64)
+		if !ok {
+			continue
+		}
+		closeText, ok := candle[4].(string)
+		if !ok {
+			continue
+		}
+		closePrice, err := strconv.ParseFloat(closeText, 64)
+		if err != nil {
+			continue
+		}
+		history = append(history, PricePoint{
+			Time:  time.Unix(int64(timestamp), 0),
+			Price: closePrice,
+		})
+	}
+	return history, nil
+}
+
+// Candle intervals offered by Kraken
+var krakenIntervals = []time.Duration{
+	time.Minute,
+	5 * time.Minute,
+	15 * time.Minute,
+	30 * time.Minute,
+	time.Hour,
+	4 * time.Hour,
+	24 * time.Hour,
+	7 * 24 * time.Hour,
+}
+
+func (p *krakenProvider) Candles(ctx context.Context, coin, currency string, interval time.Duration, days int) ([]Candle, error) {
+	pair, ok := krakenPairs[currency]
+	if !ok || coin != bitcoinID {
+		return nil, errNotSupported
+	}
+	native, err := nativeInterval(krakenIntervals, interval)
+	if err != nil {
+		return nil, err
+	}
+
+	// Older candles are not served at all, so refuse rather than draw a shorter range
+	if time.Duration(days)*24*time.Hour > krakenMaxCandles*native {
+		return nil, &candleLimitError{Provider: "Kraken", Interval: interval, MaxDays: int(krakenMaxCandles * native / (24 * time.Hour))}
+	}
+	since := time.Now().AddDate(0, 0, -days).Unix()
+	raw, err := p.public(ctx, fmt.Sprintf("OHLC?pair=%s&interval=%d&since=%d", pair, int(native.Minutes()), since))
+	if err != nil {
+		return nil, fmt.Errorf("error fetching OHLC data: %v", err)
+	}
+
+	// Each candle is [time, open, high, low, close, vwap, volume, count]
+	var data [][]interface{}
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, fmt.Errorf("error parsing OHLC data: %v", err)
+	}
+
+	candles := make([]Candle, 0, len(data))
+	for _, candle := range data {
+		if len(candle) < 7 {
+			continue
+		}
+		timestamp, ok := candle[0].(float64)
+		if !ok {
+			continue
+		}
+		var values [6]float64
+		valid := true
+		for i := range values {
+			text, ok := candle[i+1].(string)
+			if !ok {
+				valid = false
+				break
+			}
+			if values[i], err = strconv.ParseFloat(text, 64); err != nil {
+				valid = false
+				break
+			}
+		}
+		if !valid {
+			continue
+		}
+		candles = append(candles, Candle{
+			Time:  time.Unix(int64(timestamp), 0),
+			Open:  values[0],
+			High:  values[1],
+			Low:   values[2],
+			Close: values[3],
+			// Volume is quoted in BTC, the VWAP converts it to the fiat currency
+			Volume: values[5] * values[4],
+		})
+	}
+	return resampleCandles(candles, interval), nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKrakenCandleLimit(t *testing.T) {
+	server := newProviderServer(t, krakenResponses)
+	provider := newKrakenProvider(server.URL)
+
+	tests := []struct {
+		interval    time.Duration
+		days        int
+		wantMaxDays int
+	}{
+		{time.Hour, 30, 0},
+		{time.Hour, 90, 30},
+		{6 * time.Hour, 90, 30},
+		{4 * time.Hour, 90, 0},
+		{4 * time.Hour, 365, 120},
+		{24 * time.Hour, 365, 0},
+	}
+	for _, tt := range tests {
+		before := len(server.made())
+		_, err := provider.Candles(context.Background(), bitcoinID, "usd", tt.interval, tt.days)
+		var limitErr *candleLimitError
+		switch {
+		case tt.wantMaxDays == 0 && err != nil:
+			t.Errorf("%s candles over %d days: %v", tt.interval, tt.days, err)
+		case tt.wantMaxDays > 0 && !errors.As(err, &limitErr):
+			t.Errorf("%s candles over %d days: got %v, want a limit error", tt.interval, tt.days, err)
+		case tt.wantMaxDays > 0 && limitErr.MaxDays != tt.wantMaxDays:
+			t.Errorf("%s candles limited to %d days, want %d", tt.interval, limitErr.MaxDays, tt.wantMaxDays)
+		case tt.wantMaxDays > 0 && len(server.made()) != before:
+			t.Errorf("%s candles over %d days requested Kraken beyond its limit", tt.interval, tt.days)
+		}
+	}
+}
+
+// Responses of the Kraken API, trimmed to a few entries
+var krakenResponses = map[string]string{
+	"/0/public/Ticker": `{"error":[],"result":{"XXBTZUSD":{"a":["64012.60000","1","1.000"],"b":["64012.50000","2","2.000"],
+		"c":["64012.50000","0.00150000"],"v":["1200.50000000","2400.25000000"],"p":["63900.10000","63800.00000"],
+		"t":[20000,41234],"l":["63000.00000","62500.00000"],"h":["64500.00000","65000.00000"],"o":"63500.00000"}}}`,
+	// Each candle is [time, open, high, low, close, vwap, volume, count]
+	"/0/public/OHLC": `{"error":[],"result":{"XXBTZUSD":[
+		[1713484800,"63000.0","63500.0","62800.0","63400.0","63250.0","100.5",25000],
+		[1713488400,"63400.0","64100.0","63300.0","64000.0","63700.0","120.0",31000],
+		[1713492000,"64000.0","64200.0","63800.0","64012.5","64050.0","80.0",21000]],"last":1713492000}}`,
+}
+
+func TestKrakenProvider(t *testing.T) {
+	server := newProviderServer(t, krakenResponses)
+	provider := newKrakenProvider(server.URL)
+	ctx := context.Background()
+
+	price, err := provider.Price(ctx, bitcoinID, "usd")
+	if err != nil || price != 64012.5 {
+		t.Errorf("Price = %v, %v", price, err)
+	}
+	// Volume is quoted in BTC and converted at the 24-hour VWAP
+	volume, err := provider.Volume(ctx, bitcoinID, "usd")
+	if err != nil || volume != 2400.25*63800 {
+		t.Errorf("Volume = %v, %v", volume, err)
+	}
+	if requests := server.made(); requests[0] != "/0/public/Ticker?pair=XBTUSD" {
+		t.Errorf("requested %s", requests[0])
+	}
+
+	history, err := provider.PriceHistory(ctx, bitcoinID, "usd", 30)
+	if err != nil || len(history) != 3 || history[2].Price != 64012.5 || !history[2].Time.Equal(time.Unix(1713492000, 0)) {
+		t.Errorf("PriceHistory = %v, %v", history, err)
+	}
+
+	// Hourly candles resampled to two hours, with the volume in fiat
+	candles, err := provider.Candles(ctx, bitcoinID, "usd", 2*time.Hour, 1)
+	if err != nil || len(candles) != 2 {
+		t.Fatalf("Candles = %+v, %v", candles, err)
+	}
+	if first := candles[0]; first.Open != 63000 || first.High != 64100 || first.Close != 64000 || first.Volume != 100.5*63250+120*63700 {
+		t.Errorf("first candle = %+v", first)
+	}
+	if requests := server.made(); !strings.Contains(requests[len(requests)-1], "interval=60") {
+		t.Errorf("requested %s", requests[len(requests)-1])
+	}
+}
+
+func TestKrakenProviderErrors(t *testing.T) {
+	server := newProviderServer(t, map[string]string{
+		"/0/public/Ticker": `{"error":["EQuery:Unknown asset pair"]}`,
+		"/0/public/OHLC":   `{"error":[],"result":{"last":1713492000}}`,
+	})
+	provider := newKrakenProvider(server.URL)
+	ctx := context.Background()
+
+	if _, err := provider.Price(ctx, bitcoinID, "usd"); err == nil || !strings.Contains(err.Error(), "Unknown asset pair") {
+		t.Errorf("Price returned %v, want the Kraken error", err)
+	}
+	if _, err := provider.PriceHistory(ctx, bitcoinID, "usd", 30); err == nil {
+		t.Error("PriceHistory without a result did not fail")
+	}
+	if _, err := provider.Price(ctx, bitcoinID, "brl"); !errors.Is(err, errNotSupported) {
+		t.Errorf("Price in an unlisted currency returned %v", err)
+	}
+}
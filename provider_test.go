@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// providerServer serves canned API responses by path and records the
+// requests made to it
+type providerServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []string
+}
+
+// Function to start a server answering each path with its response. A
+// response starting with a status code, e.g. "429 {...}", is sent with it.
+func newProviderServer(t *testing.T, responses map[string]string) *providerServer {
+	s := &providerServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests = append(s.requests, r.URL.RequestURI())
+		s.mu.Unlock()
+
+		response, ok := responses[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if status, body, ok := strings.Cut(response, " "); ok {
+			if code, err := strconv.Atoi(status); err == nil {
+				w.WriteHeader(code)
+				response = body
+			}
+		}
+		w.Write([]byte(response))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Function to get the requests made so far
+func (s *providerServer) made() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+func TestNativeInterval(t *testing.T) {
+	offered := []time.Duration{time.Minute, 5 * time.Minute, time.Hour, 6 * time.Hour, 24 * time.Hour}
+	tests := []struct {
+		interval time.Duration
+		want     time.Duration
+	}{
+		{time.Minute, time.Minute},
+		{15 * time.Minute, 5 * time.Minute},
+		{4 * time.Hour, time.Hour},
+		{12 * time.Hour, 6 * time.Hour},
+		{7 * 24 * time.Hour, 24 * time.Hour},
+		{30 * time.Second, 0},
+	}
+	for _, tt := range tests {
+		got, err := nativeInterval(offered, tt.interval)
+		if tt.want == 0 {
+			if err == nil {
+				t.Errorf("nativeInterval(%s) = %s, want an error", tt.interval, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("nativeInterval(%s) = %s, %v, want %s", tt.interval, got, err, tt.want)
+		}
+	}
+}
+
+func TestResampleCandles(t *testing.T) {
+	start := time.Date(2024, 4, 20, 0, 0, 0, 0, time.UTC)
+	hourly := []Candle{
+		{Time: start, Open: 10, High: 12, Low: 9, Close: 11, Volume: 1},
+		{Time: start.Add(time.Hour), Open: 11, High: 15, Low: 10, Close: 14, Volume: 2},
+		{Time: start.Add(2 * time.Hour), Open: 14, High: 14, Low: 8, Close: 9, Volume: 3},
+		{Time: start.Add(3 * time.Hour), Open: 9, High: 10, Low: 9, Close: 10, Volume: 4},
+		{Time: start.Add(4 * time.Hour), Open: 10, High: 11, Low: 10, Close: 11, Volume: 5},
+	}
+
+	got := resampleCandles(hourly, 2*time.Hour)
+	want := []Candle{
+		{Time: start, Open: 10, High: 15, Low: 9, Close: 14, Volume: 3},
+		{Time: start.Add(2 * time.Hour), Open: 14, High: 14, Low: 8, Close: 10, Volume: 7},
+		{Time: start.Add(4 * time.Hour), Open: 10, High: 11, Low: 10, Close: 11, Volume: 5},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d candles, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if !got[i].Time.Equal(want[i].Time) || got[i].Open != want[i].Open || got[i].High != want[i].High ||
+			got[i].Low != want[i].Low || got[i].Close != want[i].Close || got[i].Volume != want[i].Volume {
+			t.Errorf("candle %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestFallbackProvider(t *testing.T) {
+	primary := newProviderServer(t, map[string]string{
+		"/api/v3/ticker/24hr": `{"symbol":"BTCUSDT","lastPrice":"64012.50","quoteVolume":"1812345678.12"}`,
+	})
+	fallback := newProviderServer(t, map[string]string{
+		"/simple/price": `{"ethereum":{"usd":3155.7,"usd_market_cap":378926354018.5,"usd_24h_vol":14820137663.2},"bitcoin":{"usd":64000,"usd_market_cap":1260412873561.2,"usd_24h_vol":28301937552.4}}`,
+	})
+	provider := &fallbackProvider{primary: newBinanceProvider(primary.URL), fallback: newCoinGeckoProvider(fallback.URL)}
+	ctx := context.Background()
+
+	tests := []struct {
+		name  string
+		fetch func() (float64, error)
+		want  float64
+	}{
+		{"price from the exchange", func() (float64, error) { return provider.Price(ctx, bitcoinID, "usd") }, 64012.5},
+		{"coin the exchange does not list", func() (float64, error) { return provider.Price(ctx, "ethereum", "usd") }, 3155.7},
+		{"data the exchange does not have", func() (float64, error) { return provider.MarketCap(ctx, bitcoinID, "usd") }, 1260412873561.2},
+	}
+	for _, tt := range tests {
+		got, err := tt.fetch()
+		if err != nil || got != tt.want {
+			t.Errorf("%s = %v, %v, want %v", tt.name, got, err, tt.want)
+		}
+	}
+
+	// Failures of the exchange are not hidden by the fallback
+	failing := &fallbackProvider{primary: newBinanceProvider(primary.URL + "/down"), fallback: newCoinGeckoProvider(fallback.URL)}
+	if _, err := failing.Price(ctx, bitcoinID, "usd"); err == nil || errors.Is(err, errNotSupported) {
+		t.Errorf("failing exchange returned %v", err)
+	}
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// rateLimit allows a burst of commands that refills evenly over a period,
+// e.g. 3 commands per minute
+type rateLimit struct {
+	burst  int
+	period time.Duration
+}
+
+// Default rate limits. Each command is limited per user and per chat; commands
+// without their own limit use "default". "all" limits all commands of a user
+// combined, and "abuse" how many rate limited commands a user may send before
+// being banned.
+var rateLimits = map[string]rateLimit{
+	"all":       {20, time.Minute},
+	"default":   {6, time.Minute},
+	"abuse":     {10, 10 * time.Minute},
+	"assets":    {2, time.Minute},
+	"feargreed": {2, time.Minute},
+	"chart":     {3, time.Minute},
+	"candles":   {3, time.Minute},
+}
+
+// Function to parse a rate limit written as "<commands>/<period>", e.g. "3/1m"
+func parseRateLimit(value string) (rateLimit, error) {
+	burst, period, ok := strings.Cut(value, "/")
+	if !ok {
+		return rateLimit{}, fmt.Errorf("expected <commands>/<period>, got %q", value)
+	}
+	n, err := strconv.Atoi(burst)
+	if err != nil || n < 1 {
+		return rateLimit{}, fmt.Errorf("invalid number of commands %q", burst)
+	}
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return rateLimit{}, fmt.Errorf("invalid period %q", period)
+	}
+	return rateLimit{burst: n, period: d}, nil
+}
+
+// Function to apply rate limit overrides from the configuration
+func configureRateLimits(overrides map[string]string) error {
+	for name, value := range overrides {
+		limit, err := parseRateLimit(value)
+		if err != nil {
+			return fmt.Errorf("invalid rate limit for %s: %v", name, err)
+		}
+		rateLimits[name] = limit
+	}
+	return nil
+}
+
+// Helper function to look up the rate limit of a command
+func commandRateLimit(name string) rateLimit {
+	if limit, ok := rateLimits[name]; ok {
+		return limit
+	}
+	return rateLimits["default"]
+}
+
+// tokenBucket holds the commands left of a rate limit
+type tokenBucket struct {
+	limit   rateLimit
+	tokens  float64
+	updated time.Time
+}
+
+// Function to add the tokens refilled since the last update
+func (b *tokenBucket) refill(now time.Time) {
+	elapsed := now.Sub(b.updated)
+	b.tokens = min(float64(b.limit.burst), b.tokens+float64(b.limit.burst)*elapsed.Seconds()/b.limit.period.Seconds())
+	b.updated = now
+}
+
+// Function to get how long until the bucket has a token, 0 if it has one now
+func (b *tokenBucket) wait() time.Duration {
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) * float64(b.limit.period) / float64(b.limit.burst))
+}
+
+// Key of a token bucket: a user or chat and a command
+type bucketKey struct {
+	scope   string
+	id      int64
+	command string
+}
+
+// Outcome of a rate limit check
+type rateDecision int
+
+const (
+	rateAllowed rateDecision = iota
+	// Rate limited, and the user should be told when to try again
+	rateCooldown
+	// Rate limited or banned, and the user was already told
+	rateIgnored
+	// Rate limited so often that the user is now banned
+	rateBanned
+)
+
+// How often buckets that have refilled completely are dropped
+const rateLimitPruneInterval = 10 * time.Minute
+
+// User ID Telegram sends for messages of anonymous group admins
+const groupAnonymousBotID = 1087968824
+
+// Helper function to check whether a user ID stands for many senders, such as
+// anonymous group admins, rather than a single user. Such senders are not
+// limited or banned as a user; the limits of their chat still apply.
+func anonymousSender(userID int64) bool {
+	return userID == 0 || userID == groupAnonymousBotID
+}
+
+// Ban of an abusive user, as stored in the bans bucket
+type rateLimitBan struct {
+	UserID int64     `json:"user_id"`
+	Until  time.Time `json:"until"`
+}
+
+// rateLimiter tracks token buckets and bans in memory. Bans are also kept in
+// the store when one is given, so they survive a restart.
+type rateLimiter struct {
+	banDuration time.Duration
+	store       *Store
+
+	mu      sync.Mutex
+	buckets map[bucketKey]*tokenBucket
+	bans    map[int64]time.Time
+	// Until when each user, or the chat of an anonymous sender, was told to
+	// wait, so a flood gets a single reply
+	notified  map[bucketKey]time.Time
+	lastPrune time.Time
+
+	// Serializes writes of bans to the store, which happen outside mu
+	persistMu sync.Mutex
+}
+
+// Global rate limiter used by rateLimitMiddleware
+var limiter *rateLimiter
+
+// Function to create a rate limiter, loading the bans still in effect from
+// the store if one is given
+func newRateLimiter(banDuration time.Duration, store *Store) (*rateLimiter, error) {
+	l := &rateLimiter{
+		banDuration: banDuration,
+		store:       store,
+		buckets:     make(map[bucketKey]*tokenBucket),
+		bans:        make(map[int64]time.Time),
+		notified:    make(map[bucketKey]time.Time),
+		lastPrune:   time.Now(),
+	}
+	if store == nil {
+		return l, nil
+	}
+
+	err := store.View(func(tx *storeTx) error {
+		return tx.ForEach(bucketBans, func(key string, raw json.RawMessage) error {
+			var ban rateLimitBan
+			if err := json.Unmarshal(raw, &ban); err != nil {
+				return err
+			}
+			if time.Now().Before(ban.Until) {
+				l.bans[ban.UserID] = ban.Until
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error loading bans: %v", err)
+	}
+	return l, nil
+}
+
+// Helper function to get a refilled bucket, creating a full one if needed.
+// The caller must hold l.mu.
+func (l *rateLimiter) bucket(key bucketKey, limit rateLimit, now time.Time) *tokenBucket {
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{limit: limit, tokens: float64(limit.burst), updated: now}
+		l.buckets[key] = b
+	}
+	b.refill(now)
+	return b
+}
+
+// Function to drop state that has expired, so memory does not grow with every
+// user ever seen. Returns the users whose ban was lifted. The caller must hold l.mu.
+func (l *rateLimiter) prune(now time.Time) []int64 {
+	if now.Sub(l.lastPrune) < rateLimitPruneInterval {
+		return nil
+	}
+	l.lastPrune = now
+
+	for key, b := range l.buckets {
+		if b.refill(now); b.tokens >= float64(b.limit.burst) {
+			delete(l.buckets, key)
+		}
+	}
+	for key, until := range l.notified {
+		if now.After(until) {
+			delete(l.notified, key)
+		}
+	}
+	var unbanned []int64
+	for userID, until := range l.bans {
+		if now.After(until) {
+			delete(l.bans, userID)
+			unbanned = append(unbanned, userID)
+		}
+	}
+	return unbanned
+}
+
+// Function to write the current bans of the given users to the store, or
+// remove them if the users are no longer banned. The store is written without
+// holding l.mu, so a slow disk does not stall every command.
+func (l *rateLimiter) persist(userIDs []int64) {
+	if l.store == nil || len(userIDs) == 0 {
+		return
+	}
+	l.persistMu.Lock()
+	defer l.persistMu.Unlock()
+
+	// Read the bans only now, so the last write always stores the latest state
+	bans := make(map[int64]time.Time, len(userIDs))
+	l.mu.Lock()
+	for _, userID := range userIDs {
+		bans[userID] = l.bans[userID]
+	}
+	l.mu.Unlock()
+
+	err := l.store.Update(func(tx *storeTx) error {
+		for userID, until := range bans {
+			key := strconv.FormatInt(userID, 10)
+			if until.IsZero() {
+				tx.Delete(bucketBans, key)
+				continue
+			}
+			if err := tx.Put(bucketBans, key, rateLimitBan{UserID: userID, Until: until}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Println("Error saving bans:", err)
+	}
+}
+
+// Function to check whether a user may run a command in a chat now, taking a
+// token from each of its buckets if so. Also returns how long the user has to
+// wait, or is banned for.
+func (l *rateLimiter) check(userID, chatID int64, command string) (rateDecision, time.Duration) {
+	l.mu.Lock()
+	decision, wait, changed := l.decide(userID, chatID, command, time.Now())
+	l.mu.Unlock()
+
+	l.persist(changed)
+	return decision, wait
+}
+
+// Function to make the decision for check. Also returns the users whose ban
+// was imposed or lifted. The caller must hold l.mu.
+func (l *rateLimiter) decide(userID, chatID int64, command string, now time.Time) (rateDecision, time.Duration, []int64) {
+	changed := l.prune(now)
+
+	anonymous := anonymousSender(userID)
+	if until, ok := l.bans[userID]; ok && !anonymous {
+		if now.Before(until) {
+			return rateIgnored, until.Sub(now), changed
+		}
+		delete(l.bans, userID)
+		changed = append(changed, userID)
+	}
+
+	limit := commandRateLimit(command)
+	buckets := []*tokenBucket{l.bucket(bucketKey{"chat", chatID, command}, limit, now)}
+	notifyKey := bucketKey{"chat", chatID, ""}
+	if !anonymous {
+		buckets = append(buckets,
+			l.bucket(bucketKey{"user", userID, ""}, rateLimits["all"], now),
+			l.bucket(bucketKey{"user", userID, command}, limit, now))
+		notifyKey = bucketKey{"user", userID, ""}
+	}
+	// The first bucket is the chat's, the others the user's own
+	var wait, userWait time.Duration
+	for i, b := range buckets {
+		wait = max(wait, b.wait())
+		if i > 0 {
+			userWait = max(userWait, b.wait())
+		}
+	}
+	if wait == 0 {
+		for _, b := range buckets {
+			b.tokens--
+		}
+		return rateAllowed, 0, changed
+	}
+
+	// Every command over the user's own limits is a strike, and running out of
+	// strikes gets the user banned. Others may have used up the chat's limit,
+	// so hitting only that is no strike.
+	if userWait > 0 {
+		strikes := l.bucket(bucketKey{"abuse", userID, ""}, rateLimits["abuse"], now)
+		if strikes.wait() > 0 {
+			l.bans[userID] = now.Add(l.banDuration)
+			delete(l.buckets, bucketKey{"abuse", userID, ""})
+			return rateBanned, l.banDuration, append(changed, userID)
+		}
+		strikes.tokens--
+	}
+
+	if now.Before(l.notified[notifyKey]) {
+		return rateIgnored, wait, changed
+	}
+	l.notified[notifyKey] = now.Add(wait)
+	return rateCooldown, wait, changed
+}
+
+// Middleware to rate limit commands per user and per chat. Admins are not limited.
+func rateLimitMiddleware(cmd *command, next commandHandler) commandHandler {
+	return func(ctx context.Context, update tgbotapi.Update) {
+		userID := senderID(update.Message)
+		if isAdmin(userID) {
+			next(ctx, update)
+			return
+		}
+
+		chatID := update.Message.Chat.ID
+		decision, wait := limiter.check(userID, chatID, cmd.Name)
+		if decision == rateAllowed {
+			next(ctx, update)
+			return
+		}
+
+		metrics.recordDenied(cmd.Name)
+		// Round up so the reply never says 0s
+		wait = max(wait.Round(time.Second), time.Second)
+		switch decision {
+		case rateCooldown:
+			log.Printf("Rate limited /%s from user %d in chat %d", cmd.Name, userID, chatID)
+			sendMessage(chatID, fmt.Sprintf("Please slow down a little. /%s is available again in %s.", cmd.Name, formatDuration(wait)))
+		case rateBanned:
+			log.Printf("Banned user %d for %s after repeated rate limiting", userID, wait)
+			sendMessage(chatID, fmt.Sprintf("Too many commands. You can use the bot again in %s.", formatDuration(wait)))
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    rateLimit
+		wantErr bool
+	}{
+		{"3/1m", rateLimit{3, time.Minute}, false},
+		{"20/30s", rateLimit{20, 30 * time.Second}, false},
+		{"1/1h30m", rateLimit{1, 90 * time.Minute}, false},
+		{"3", rateLimit{}, true},
+		{"0/1m", rateLimit{}, true},
+		{"-1/1m", rateLimit{}, true},
+		{"x/1m", rateLimit{}, true},
+		{"3/", rateLimit{}, true},
+		{"3/0s", rateLimit{}, true},
+		{"3/minute", rateLimit{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parseRateLimit(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseRateLimit(%q) = %v, %v, want %v, error %v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestConfigureRateLimits(t *testing.T) {
+	saved := rateLimits["chart"]
+	t.Cleanup(func() { rateLimits["chart"] = saved })
+
+	if err := configureRateLimits(map[string]string{"chart": "5/2m"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := commandRateLimit("chart"); got != (rateLimit{5, 2 * time.Minute}) {
+		t.Errorf("chart limit = %v after override", got)
+	}
+	if got := commandRateLimit("unlisted"); got != rateLimits["default"] {
+		t.Errorf("unlisted command limit = %v, want the default", got)
+	}
+	if err := configureRateLimits(map[string]string{"chart": "fast"}); err == nil {
+		t.Error("configureRateLimits accepted an invalid limit")
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		tokens   float64
+		elapsed  time.Duration
+		want     float64
+		wantWait time.Duration
+	}{
+		{"empty stays empty", 0, 0, 0, 20 * time.Second},
+		{"refills evenly", 0, 30 * time.Second, 1.5, 0},
+		{"partial token", 0, 10 * time.Second, 0.5, 10 * time.Second},
+		{"caps at burst", 2, time.Hour, 3, 0},
+		{"full stays full", 3, time.Minute, 3, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &tokenBucket{limit: rateLimit{3, time.Minute}, tokens: tt.tokens, updated: start}
+			b.refill(start.Add(tt.elapsed))
+			if b.tokens != tt.want {
+				t.Errorf("tokens = %v, want %v", b.tokens, tt.want)
+			}
+			if !b.updated.Equal(start.Add(tt.elapsed)) {
+				t.Errorf("updated = %v, want %v", b.updated, start.Add(tt.elapsed))
+			}
+			if wait := b.wait(); wait != tt.wantWait {
+				t.Errorf("wait = %v, want %v", wait, tt.wantWait)
+			}
+		})
+	}
+}
+
+func TestRateLimiterLimitsCommands(t *testing.T) {
+	l, _ := newRateLimiter(time.Hour, nil)
+	now := time.Now()
+
+	// /chart allows 3 per minute
+	steps := []struct {
+		after  time.Duration
+		userID int64
+		chatID int64
+		want   rateDecision
+	}{
+		{0, 1, 100, rateAllowed},
+		{0, 1, 100, rateAllowed},
+		{0, 1, 100, rateAllowed},
+		{0, 1, 100, rateCooldown},
+		// Told once, then ignored until the wait is over
+		{0, 1, 100, rateIgnored},
+		// The chat bucket is spent for everyone
+		{0, 2, 100, rateCooldown},
+		// The user bucket follows the user to other chats
+		{0, 1, 200, rateIgnored},
+		{0, 3, 200, rateAllowed},
+		{20 * time.Second, 1, 100, rateAllowed},
+		{0, 1, 100, rateCooldown},
+	}
+	for i, step := range steps {
+		now = now.Add(step.after)
+		if got, _, _ := l.decide(step.userID, step.chatID, "chart", now); got != step.want {
+			t.Errorf("step %d: decision = %v, want %v", i, got, step.want)
+		}
+	}
+}
+
+func TestRateLimiterBansAbusiveUsers(t *testing.T) {
+	s := openTestStore(t, filepath.Join(t.TempDir(), "btcbot.db"))
+	l, err := newRateLimiter(time.Hour, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decision rateDecision
+	for i := 0; i < 100 && decision != rateBanned; i++ {
+		decision, _ = l.check(1, 100, "chart")
+	}
+	if decision != rateBanned {
+		t.Fatal("user flooding a command was not banned")
+	}
+	if decision, wait := l.check(1, 100, "help"); decision != rateIgnored || wait <= 0 {
+		t.Errorf("banned user got %v, %v", decision, wait)
+	}
+
+	// The ban survives a restart
+	restarted, err := newRateLimiter(time.Hour, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decision, _ := restarted.check(1, 100, "help"); decision != rateIgnored {
+		t.Errorf("ban lost on restart, got %v", decision)
+	}
+
+	// and is removed from the store once it expires
+	later := time.Now().Add(2 * time.Hour)
+	decision, _, changed := restarted.decide(1, 100, "help", later)
+	if decision != rateAllowed {
+		t.Errorf("expired ban still applied, got %v", decision)
+	}
+	restarted.persist(changed)
+	s.View(func(tx *storeTx) error {
+		var ban rateLimitBan
+		if found, _ := tx.Get(bucketBans, "1", &ban); found {
+			t.Error("expired ban left in the store")
+		}
+		return nil
+	})
+}
+
+func TestRateLimiterChatCooldownIsNoStrike(t *testing.T) {
+	l, _ := newRateLimiter(time.Hour, nil)
+	now := time.Now()
+
+	// One user spams /assets in a group until banned
+	var decision rateDecision
+	for i := 0; i < 100 && decision != rateBanned; i++ {
+		decision, _, _ = l.decide(1, -100, "assets", now)
+	}
+	if decision != rateBanned {
+		t.Fatal("user flooding a command was not banned")
+	}
+
+	// Others asking for it meanwhile only see the chat cooldown
+	for i := 0; i < 100; i++ {
+		if decision, _, _ := l.decide(2, -100, "assets", now); decision == rateBanned || decision == rateAllowed {
+			t.Fatalf("command %d of another user in the group got %v", i, decision)
+		}
+	}
+	if _, ok := l.buckets[bucketKey{"abuse", 2, ""}]; ok {
+		t.Error("chat cooldown counted as a strike")
+	}
+	if decision, _, _ := l.decide(2, 2, "assets", now); decision != rateAllowed {
+		t.Errorf("user limited in their private chat, got %v", decision)
+	}
+}
+
+func TestRateLimiterAnonymousSenders(t *testing.T) {
+	l, _ := newRateLimiter(time.Hour, nil)
+
+	for _, userID := range []int64{0, groupAnonymousBotID} {
+		chatID := -100 - userID
+		for i := 0; i < 100; i++ {
+			decision, _ := l.check(userID, chatID, "chart")
+			if decision == rateBanned {
+				t.Fatalf("anonymous sender %d was banned", userID)
+			}
+			if i < 3 && decision != rateAllowed {
+				t.Fatalf("anonymous sender %d limited after %d commands", userID, i)
+			}
+			if i >= 3 && decision == rateAllowed {
+				t.Fatalf("anonymous sender %d not limited by the chat bucket", userID)
+			}
+		}
+	}
+
+	// The anonymous admins of one group do not use up the limits of another
+	if decision, _ := l.check(groupAnonymousBotID, -200, "chart"); decision != rateAllowed {
+		t.Errorf("anonymous sender limited in a fresh chat, got %v", decision)
+	}
+	if len(l.bans) != 0 {
+		t.Errorf("bans = %v, want none", l.bans)
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Handler of a bot command
+type commandHandler func(ctx context.Context, update tgbotapi.Update)
+
+// Middleware wraps the handler of a command with behaviour shared by all commands
+type middleware func(cmd *command, next commandHandler) commandHandler
+
+// command is a bot command as registered with the router
+type command struct {
+	Name        string
+	Description string
+	// Arguments as shown in /help, e.g. "<txid> [currency]"
+	Args string
+	// Admin commands are only run for bot admins and are not advertised
+	AdminOnly bool
+	// Private commands are only run in a private chat with the bot, for
+	// replies no other chat member may see
+	PrivateOnly bool
+	Handler     commandHandler
+}
+
+// Function to format how a command is invoked
+func (c *command) usage() string {
+	if c.Args == "" {
+		return "/" + c.Name
+	}
+	return "/" + c.Name + " " + c.Args
+}
+
+// router dispatches commands to their handlers through a chain of middleware
+type router struct {
+	commands   []*command
+	byName     map[string]*command
+	handlers   map[string]commandHandler
+	middleware []middleware
+}
+
+// Function to create a router applying the given middleware, outermost first
+func newRouter(middleware ...middleware) *router {
+	return &router{
+		byName:     make(map[string]*command),
+		handlers:   make(map[string]commandHandler),
+		middleware: middleware,
+	}
+}
+
+// Function to register a command
+func (r *router) register(cmd *command) {
+	if _, ok := r.byName[cmd.Name]; ok {
+		panic("command registered twice: " + cmd.Name)
+	}
+
+	handler := cmd.Handler
+	for i := len(r.middleware) - 1; i >= 0; i-- {
+		handler = r.middleware[i](cmd, handler)
+	}
+
+	r.commands = append(r.commands, cmd)
+	r.byName[cmd.Name] = cmd
+	r.handlers[cmd.Name] = handler
+}
+
+// Function to run the handler of the command in a message
+func (r *router) route(ctx context.Context, update tgbotapi.Update) {
+	name := strings.ToLower(update.Message.Command())
+	handler, ok := r.handlers[name]
+	if !ok {
+		log.Println("Unknown command received:", update.Message.Command())
+		return
+	}
+	handler(ctx, update)
+}
+
+// Function to build the /help text for a user, leaving out admin commands
+// unless the user is an admin
+func (r *router) help(userID int64) string {
+	var b strings.Builder
+	b.WriteString("Available commands:\n")
+	for _, cmd := range r.commands {
+		if cmd.AdminOnly && !isAdmin(userID) {
+			continue
+		}
+		fmt.Fprintf(&b, "\n%s - %s", cmd.usage(), cmd.Description)
+	}
+	return b.String()
+}
+
+// Function to publish the public commands to Telegram, so clients can suggest them
+func (r *router) publish() error {
+	var botCommands []tgbotapi.BotCommand
+	for _, cmd := range r.commands {
+		if cmd.AdminOnly {
+			continue
+		}
+		botCommands = append(botCommands, tgbotapi.BotCommand{Command: cmd.Name, Description: cmd.Description})
+	}
+	_, err := bot.Request(tgbotapi.NewSetMyCommands(botCommands...))
+	return err
+}
+
+// Helper function to get the ID of the user who sent a message, 0 if unknown
+func senderID(message *tgbotapi.Message) int64 {
+	if message.From == nil {
+		return 0
+	}
+	return message.From.ID
+}
+
+// Middleware to recover from a panicking handler, so one command cannot take
+// the bot down
+func recoverMiddleware(cmd *command, next commandHandler) commandHandler {
+	return func(ctx context.Context, update tgbotapi.Update) {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("Panic in /%s: %v\n%s", cmd.Name, r, debug.Stack())
+				metrics.recordPanic(cmd.Name)
+				sendMessage(update.Message.Chat.ID, "Something went wrong, please try again later.")
+			}
+		}()
+		next(ctx, update)
+	}
+}
+
+// Middleware to log each command and how long it took
+func loggingMiddleware(cmd *command, next commandHandler) commandHandler {
+	return func(ctx context.Context, update tgbotapi.Update) {
+		log.Printf("Received /%s command from user %d in chat %d", cmd.Name, senderID(update.Message), update.Message.Chat.ID)
+		start := time.Now()
+		next(ctx, update)
+		log.Printf("Handled /%s command in %s", cmd.Name, time.Since(start).Round(time.Millisecond))
+	}
+}
+
+// Middleware to record per-command metrics
+func metricsMiddleware(cmd *command, next commandHandler) commandHandler {
+	return func(ctx context.Context, update tgbotapi.Update) {
+		start := time.Now()
+		defer func() { metrics.recordCall(cmd.Name, time.Since(start)) }()
+		next(ctx, update)
+	}
+}
+
+// Middleware to restrict admin commands to bot admins, and private commands
+// to private chats
+func authMiddleware(cmd *command, next commandHandler) commandHandler {
+	if !cmd.AdminOnly && !cmd.PrivateOnly {
+		return next
+	}
+	return func(ctx context.Context, update tgbotapi.Update) {
+		if cmd.AdminOnly && !isAdmin(senderID(update.Message)) {
+			metrics.recordDenied(cmd.Name)
+			sendMessage(update.Message.Chat.ID, "This command is only available to bot admins.")
+			return
+		}
+		if cmd.PrivateOnly && !update.Message.Chat.IsPrivate() {
+			metrics.recordDenied(cmd.Name)
+			sendMessage(update.Message.Chat.ID, fmt.Sprintf("/%s only works in a private chat with the bot.", cmd.Name))
+			return
+		}
+		next(ctx, update)
+	}
+}
+
+// Counters of a single command
+type commandCounters struct {
+	calls    int64
+	panics   int64
+	denied   int64
+	duration time.Duration
+}
+
+// commandMetrics collects counters per command
+type commandMetrics struct {
+	mu       sync.Mutex
+	counters map[string]*commandCounters
+}
+
+// Global metrics, served at /metrics
+var metrics = &commandMetrics{counters: make(map[string]*commandCounters)}
+
+// Helper function to get the counters of a command. The caller must hold m.mu.
+func (m *commandMetrics) get(name string) *commandCounters {
+	c, ok := m.counters[name]
+	if !ok {
+		c = &commandCounters{}
+		m.counters[name] = c
+	}
+	return c
+}
+
+// Function to record a handled command
+func (m *commandMetrics) recordCall(name string, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := m.get(name)
+	c.calls++
+	c.duration += duration
+}
+
+// Function to record a panic in a command handler
+func (m *commandMetrics) recordPanic(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.get(name).panics++
+}
+
+// Function to record a command that was refused by a middleware
+func (m *commandMetrics) recordDenied(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.get(name).denied++
+}
+
+// HTTP handler serving the command metrics in the Prometheus text format
+func (m *commandMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	names := make([]string, 0, len(m.counters))
+	for name := range m.counters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	series := []struct {
+		name, help, kind string
+		value            func(c *commandCounters) string
+	}{
+		{"btcbot_commands_total", "Commands handled.", "counter",
+			func(c *commandCounters) string { return fmt.Sprint(c.calls) }},
+		{"btcbot_command_panics_total", "Command handlers that panicked.", "counter",
+			func(c *commandCounters) string { return fmt.Sprint(c.panics) }},
+		{"btcbot_commands_denied_total", "Commands refused by authorization or rate limiting.", "counter",
+			func(c *commandCounters) string { return fmt.Sprint(c.denied) }},
+		{"btcbot_command_duration_seconds_total", "Time spent handling commands.", "counter",
+			func(c *commandCounters) string { return fmt.Sprint(c.duration.Seconds()) }},
+	}
+	for _, s := range series {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", s.name, s.help, s.name, s.kind)
+		for _, name := range names {
+			fmt.Fprintf(&b, "%s{command=%q} %s\n", s.name, name, s.value(m.counters[name]))
+		}
+	}
+	m.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write([]byte(b.String()))
+}
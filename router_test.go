@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Helper function to build an update with a command sent by a user
+func commandUpdate(text string, chat *tgbotapi.Chat, userID int64) tgbotapi.Update {
+	name, _, _ := strings.Cut(text, " ")
+	return tgbotapi.Update{Message: &tgbotapi.Message{
+		Text:     text,
+		Entities: []tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: len(name)}},
+		Chat:     chat,
+		From:     &tgbotapi.User{ID: userID},
+	}}
+}
+
+// Helper function to point the globals the middleware uses at fresh test
+// values, restoring them when the test ends
+func setupRouterTest(t *testing.T, admins ...int64) {
+	oldCfg, oldMetrics, oldLimiter := cfg, metrics, limiter
+	t.Cleanup(func() { cfg, metrics, limiter = oldCfg, oldMetrics, oldLimiter })
+
+	cfg = defaultConfig()
+	cfg.AdminUserIDs = admins
+	metrics = &commandMetrics{counters: make(map[string]*commandCounters)}
+	limiter, _ = newRateLimiter(time.Hour, nil)
+}
+
+func TestRouterMiddlewareOrder(t *testing.T) {
+	var trace []string
+	tracing := func(name string) middleware {
+		return func(cmd *command, next commandHandler) commandHandler {
+			return func(ctx context.Context, update tgbotapi.Update) {
+				trace = append(trace, name+">")
+				next(ctx, update)
+				trace = append(trace, "<"+name)
+			}
+		}
+	}
+
+	r := newRouter(tracing("outer"), tracing("inner"))
+	r.register(&command{Name: "ping", Handler: func(ctx context.Context, update tgbotapi.Update) {
+		trace = append(trace, "ping")
+	}})
+
+	private := &tgbotapi.Chat{ID: 1, Type: "private"}
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"/ping", "outer> inner> ping <inner <outer"},
+		{"/PING@testbot now", "outer> inner> ping <inner <outer"},
+		{"/pong", ""},
+	}
+	for _, tt := range tests {
+		trace = nil
+		r.route(context.Background(), commandUpdate(tt.text, private, 1))
+		if got := strings.Join(trace, " "); got != tt.want {
+			t.Errorf("%s: ran %q, want %q", tt.text, got, tt.want)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a command twice did not panic")
+		}
+	}()
+	r.register(&command{Name: "ping"})
+}
+
+func TestRouterHelp(t *testing.T) {
+	setupRouterTest(t, 7)
+	r := newRouter()
+	r.register(&command{Name: "price", Args: "<coin>", Description: "Price"})
+	r.register(&command{Name: "backup", Description: "Backup", AdminOnly: true})
+
+	tests := []struct {
+		userID     int64
+		wantBackup bool
+	}{
+		{1, false},
+		{7, true},
+	}
+	for _, tt := range tests {
+		help := r.help(tt.userID)
+		if !strings.Contains(help, "/price <coin> - Price") {
+			t.Errorf("help for user %d misses /price:\n%s", tt.userID, help)
+		}
+		if got := strings.Contains(help, "/backup"); got != tt.wantBackup {
+			t.Errorf("help for user %d lists /backup = %v, want %v", tt.userID, got, tt.wantBackup)
+		}
+	}
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	setupRouterTest(t, 7)
+	private := &tgbotapi.Chat{ID: 7, Type: "private"}
+	group := &tgbotapi.Chat{ID: -100, Type: "supergroup"}
+
+	tests := []struct {
+		name        string
+		adminOnly   bool
+		privateOnly bool
+		chat        *tgbotapi.Chat
+		userID      int64
+		wantRun     bool
+	}{
+		{"public command", false, false, group, 1, true},
+		{"admin command by admin", true, false, group, 7, true},
+		{"admin command by user", true, false, private, 1, false},
+		{"private command in private chat", false, true, private, 1, true},
+		{"private command in group", false, true, group, 1, false},
+		{"admin private command by admin in private chat", true, true, private, 7, true},
+		{"admin private command by admin in group", true, true, group, 7, false},
+	}
+	for _, tt := range tests {
+		ran := false
+		cmd := &command{Name: "cmd", AdminOnly: tt.adminOnly, PrivateOnly: tt.privateOnly}
+		handler := authMiddleware(cmd, func(ctx context.Context, update tgbotapi.Update) { ran = true })
+
+		before := metrics.get("cmd").denied
+		handler(context.Background(), commandUpdate("/cmd", tt.chat, tt.userID))
+		if ran != tt.wantRun {
+			t.Errorf("%s: ran = %v, want %v", tt.name, ran, tt.wantRun)
+		}
+		wantDenied := int64(1)
+		if tt.wantRun {
+			wantDenied = 0
+		}
+		if denied := metrics.get("cmd").denied - before; denied != wantDenied {
+			t.Errorf("%s: counted %d denials, want %d", tt.name, denied, wantDenied)
+		}
+	}
+}
+
+func TestRecoverAndMetricsMiddleware(t *testing.T) {
+	setupRouterTest(t)
+	r := newRouter(recoverMiddleware, metricsMiddleware)
+	r.register(&command{Name: "boom", Handler: func(ctx context.Context, update tgbotapi.Update) { panic("boom") }})
+	r.register(&command{Name: "ok", Handler: func(ctx context.Context, update tgbotapi.Update) {}})
+
+	chat := &tgbotapi.Chat{ID: 1, Type: "private"}
+	r.route(context.Background(), commandUpdate("/boom", chat, 1))
+	r.route(context.Background(), commandUpdate("/ok", chat, 1))
+	r.route(context.Background(), commandUpdate("/ok", chat, 1))
+
+	// The panicking call still counts, as the metrics middleware runs inside the recovery
+	want := map[string]commandCounters{"boom": {calls: 1, panics: 1}, "ok": {calls: 2}}
+	for name, counters := range want {
+		got := metrics.get(name)
+		if got.calls != counters.calls || got.panics != counters.panics {
+			t.Errorf("/%s counted %d calls and %d panics, want %d and %d", name, got.calls, got.panics, counters.calls, counters.panics)
+		}
+	}
+
+	recorder := httptest.NewRecorder()
+	metrics.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	for _, line := range []string{`btcbot_commands_total{command="ok"} 2`, `btcbot_command_panics_total{command="boom"} 1`} {
+		if !strings.Contains(recorder.Body.String(), line) {
+			t.Errorf("metrics miss %s:\n%s", line, recorder.Body.String())
+		}
+	}
+}
+
+func TestRateLimitBeforeAuthorization(t *testing.T) {
+	setupRouterTest(t, 7)
+	ran := 0
+	r := newRouter(rateLimitMiddleware, authMiddleware)
+	r.register(&command{Name: "secret", AdminOnly: true, Handler: func(ctx context.Context, update tgbotapi.Update) { ran++ }})
+
+	// Refused commands use up the user's limit
+	group := &tgbotapi.Chat{ID: -100, Type: "supergroup"}
+	burst := rateLimits["default"].burst
+	for i := 0; i < burst; i++ {
+		r.route(context.Background(), commandUpdate("/secret", group, 1))
+	}
+	if decision, _ := limiter.check(1, -200, "secret"); decision == rateAllowed {
+		t.Error("commands refused by authorization did not count against the rate limit")
+	}
+
+	// Admins are neither limited nor refused
+	for i := 0; i < burst+1; i++ {
+		r.route(context.Background(), commandUpdate("/secret", group, 7))
+	}
+	if ran != burst+1 {
+		t.Errorf("ran %d admin commands, want %d", ran, burst+1)
+	}
+}
+
+func TestCommandRouter(t *testing.T) {
+	r := newCommandRouter()
+	for _, name := range []string{"backup", "restore"} {
+		cmd, ok := r.byName[name]
+		if !ok || !cmd.AdminOnly || !cmd.PrivateOnly {
+			t.Errorf("/%s is not an admin-only private command", name)
+		}
+	}
+	for _, cmd := range r.commands {
+		if cmd.Handler == nil || cmd.Description == "" {
+			t.Errorf("/%s has no handler or description", cmd.Name)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"math/big"
+)
+
+// Arithmetic on the secp256k1 curve y² = x³ + 7, enough to derive public
+// keys. Only public data is handled, so constant-time code is not needed.
+
+// Curve parameters
+var (
+	secpP, _  = new(big.Int).SetString("fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f", 16)
+	secpN, _  = new(big.Int).SetString("fffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364141", 16)
+	secpGx, _ = new(big.Int).SetString("79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798", 16)
+	secpGy, _ = new(big.Int).SetString("483ada7726a3c4655da4fbfc0e1108a8fd17b448a68554199c47d08ffb10d4b8", 16)
+)
+
+// Generator point
+var secpG = &ecPoint{x: secpGx, y: secpGy}
+
+// ecPoint is a point on the curve. A nil point is the point at infinity.
+type ecPoint struct {
+	x, y *big.Int
+}
+
+// Function to add two points
+func ecAdd(a, b *ecPoint) *ecPoint {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+
+	var slope *big.Int
+	if a.x.Cmp(b.x) == 0 {
+		if a.y.Cmp(b.y) != 0 || a.y.Sign() == 0 {
+			// P + (-P)
+			return nil
+		}
+		// Doubling: slope = 3x² / 2y
+		numerator := new(big.Int).Mul(a.x, a.x)
+		numerator.Mul(numerator, big.NewInt(3))
+		denominator := new(big.Int).Lsh(a.y, 1)
+		slope = numerator.Mul(numerator, denominator.ModInverse(denominator, secpP))
+	} else {
+		// slope = (y2 - y1) / (x2 - x1)
+		numerator := new(big.Int).Sub(b.y, a.y)
+		denominator := new(big.Int).Sub(b.x, a.x)
+		denominator.Mod(denominator, secpP)
+		slope = numerator.Mul(numerator, denominator.ModInverse(denominator, secpP))
+	}
+	slope.Mod(slope, secpP)
+
+	x := new(big.Int).Mul(slope, slope)
+	x.Sub(x, a.x)
+	x.Sub(x, b.x)
+	x.Mod(x, secpP)
+
+	y := new(big.Int).Sub(a.x, x)
+	y.Mul(y, slope)
+	y.Sub(y, a.y)
+	y.Mod(y, secpP)
+
+	return &ecPoint{x: x, y: y}
+}
+
+// Function to multiply a point by a scalar
+func ecMul(p *ecPoint, k *big.Int) *ecPoint {
+	var result *ecPoint
+	for i := k.BitLen() - 1; i >= 0; i-- {
+		result = ecAdd(result, result)
+		if k.Bit(i) == 1 {
+			result = ecAdd(result, p)
+		}
+	}
+	return result
+}
+
+// Function to find the point with the given x coordinate and y parity
+func ecLiftX(x *big.Int, odd bool) (*ecPoint, error) {
+	if x.Cmp(secpP) >= 0 {
+		return nil, errors.New("x coordinate out of range")
+	}
+
+	// y = sqrt(x³ + 7), computed as a power since p ≡ 3 (mod 4)
+	ySquared := new(big.Int).Exp(x, big.NewInt(3), secpP)
+	ySquared.Add(ySquared, big.NewInt(7))
+	ySquared.Mod(ySquared, secpP)
+
+	exponent := new(big.Int).Add(secpP, big.NewInt(1))
+	exponent.Rsh(exponent, 2)
+	y := new(big.Int).Exp(ySquared, exponent, secpP)
+
+	if new(big.Int).Exp(y, big.NewInt(2), secpP).Cmp(ySquared) != 0 {
+		return nil, errors.New("point is not on the curve")
+	}
+	if (y.Bit(0) == 1) != odd {
+		y.Sub(secpP, y)
+	}
+	return &ecPoint{x: new(big.Int).Set(x), y: y}, nil
+}
+
+// Function to parse a 33-byte compressed public key
+func parsePublicKey(data []byte) (*ecPoint, error) {
+	if len(data) != 33 || (data[0] != 2 && data[0] != 3) {
+		return nil, errors.New("invalid compressed public key")
+	}
+	return ecLiftX(new(big.Int).SetBytes(data[1:]), data[0] == 3)
+}
+
+// Function to serialize a point as a 33-byte compressed public key
+func (p *ecPoint) compressed() []byte {
+	serialized := make([]byte, 33)
+	serialized[0] = 2
+	if p.y.Bit(0) == 1 {
+		serialized[0] = 3
+	}
+	p.x.FillBytes(serialized[1:])
+	return serialized
+}
+
+// Function to serialize the x coordinate of a point as 32 bytes
+func (p *ecPoint) xOnly() []byte {
+	return p.x.FillBytes(make([]byte, 32))
+}
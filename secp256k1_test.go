@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/hex"
+	"math/big"
+	"testing"
+)
+
+func TestECMulSmallMultiples(t *testing.T) {
+	// x coordinates of small multiples of the generator
+	tests := []struct {
+		k    int64
+		want string
+	}{
+		{1, "79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"},
+		{2, "c6047f9441ed7d6d3045406e95c07cd85c778e4b8cef3ca7abac09b95c709ee5"},
+		{3, "f9308a019258c31049344f85f89d5229b531c845836f99b08601f113bce036f9"},
+	}
+	for _, tt := range tests {
+		p := ecMul(secpG, big.NewInt(tt.k))
+		if got := hex.EncodeToString(p.xOnly()); got != tt.want {
+			t.Errorf("%dG x = %s, want %s", tt.k, got, tt.want)
+		}
+	}
+
+	if ecMul(secpG, secpN) != nil {
+		t.Error("nG is not the point at infinity")
+	}
+	minusG := ecMul(secpG, new(big.Int).Sub(secpN, big.NewInt(1)))
+	if minusG.x.Cmp(secpG.x) != 0 || new(big.Int).Add(minusG.y, secpG.y).Cmp(secpP) != 0 {
+		t.Error("(n-1)G is not -G")
+	}
+}
+
+func TestParsePublicKeyRoundTrip(t *testing.T) {
+	for _, k := range []int64{1, 2, 3, 7} {
+		p := ecMul(secpG, big.NewInt(k))
+		parsed, err := parsePublicKey(p.compressed())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed.x.Cmp(p.x) != 0 || parsed.y.Cmp(p.y) != 0 {
+			t.Errorf("parsePublicKey(%dG) returned a different point", k)
+		}
+	}
+
+	// x = 5 is not on the curve
+	invalid := append([]byte{0x02}, make([]byte, 31)...)
+	invalid = append(invalid, 5)
+	if _, err := parsePublicKey(invalid); err == nil {
+		t.Error("parsePublicKey accepted a point off the curve")
+	}
+}
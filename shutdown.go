@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"log"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Background jobs, waited for on shutdown
+var jobs sync.WaitGroup
+
+// How long shutdown still waits past its deadline for cancelled handlers and
+// jobs to return, and for the HTTP server to finish responses in flight
+const shutdownGrace = time.Second
+
+// Function to run a background job in its own goroutine. The job must return
+// once its context is cancelled.
+func startJob(job func()) {
+	jobs.Add(1)
+	go func() {
+		defer jobs.Done()
+		job()
+	}()
+}
+
+// Helper function to wait for a WaitGroup until the deadline. Returns false
+// if it timed out.
+func waitUntil(wg *sync.WaitGroup, deadline time.Time) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(time.Until(deadline)):
+		return false
+	}
+}
+
+// Function to stop the bot: stop receiving updates, let in-flight handlers
+// and background jobs finish until the deadline, confirm the updates handled
+// so far to Telegram, flush storage and shut down the HTTP server
+func shutdown(deadline time.Time, receiver updateReceiver, d *dispatcher, stopHandlers, stopJobs context.CancelFunc, server *http.Server) {
+	log.Println("Shutting down")
+
+	receiver.stop()
+	stopJobs()
+
+	if !d.wait(time.Until(deadline)) {
+		log.Println("Shutdown deadline reached, cancelling in-flight handlers")
+		stopHandlers()
+		if !d.wait(shutdownGrace) {
+			log.Println("Handlers still running after being cancelled")
+		}
+	}
+	stopHandlers()
+
+	// Jobs were stopped first, so give them a moment even past the deadline
+	jobsDeadline := deadline
+	if grace := time.Now().Add(shutdownGrace); jobsDeadline.Before(grace) {
+		jobsDeadline = grace
+	}
+	if !waitUntil(&jobs, jobsDeadline) {
+		log.Println("Shutdown deadline reached, abandoning background jobs")
+	}
+
+	// Updates from the first one left unhandled on are delivered again after
+	// a restart, even those handled after it
+	before := math.MaxInt
+	if first, ok := d.firstUnhandled(); ok {
+		log.Printf("Leaving updates from %d on to be delivered again", first)
+		before = first
+	}
+	if err := receiver.acknowledge(before); err != nil {
+		log.Println("Error acknowledging updates:", err)
+	}
+
+	if err := store.Close(); err != nil {
+		log.Println("Error flushing storage:", err)
+	}
+
+	// Give the server at least a moment, even past the deadline, to finish
+	// responses in flight
+	ctx, cancel := context.WithDeadline(context.Background(), deadline.Add(shutdownGrace))
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Println("Error shutting down HTTP server:", err)
+	}
+
+	log.Println("Shutdown complete")
+}
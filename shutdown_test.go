@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// fakeReceiver delivers updates from a channel and records what it was told
+// to acknowledge
+type fakeReceiver struct {
+	ch      chan tgbotapi.Update
+	handled *atomic.Int32
+	// Updates handled when acknowledge was called, -1 until then
+	acknowledged atomic.Int32
+	// Update ID acknowledge confirmed the updates below
+	before atomic.Int64
+}
+
+func (r *fakeReceiver) updates() tgbotapi.UpdatesChannel { return r.ch }
+
+func (r *fakeReceiver) stop() { close(r.ch) }
+
+func (r *fakeReceiver) acknowledge(before int) error {
+	r.acknowledged.Store(r.handled.Load())
+	r.before.Store(int64(before))
+	return nil
+}
+
+func TestShutdownDrainsHandlers(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		// How long each handler runs unless cancelled
+		work time.Duration
+		// Whether handlers keep running when cancelled
+		stuck bool
+		// Update ID and chat of each update
+		updates       [][2]int
+		wantHandled   int32
+		wantCancelled int32
+		wantBefore    int
+	}{
+		{"handlers finish before the deadline", time.Second, 30 * time.Millisecond, false,
+			[][2]int{{1, 1}, {2, 1}, {3, 2}}, 3, 0, math.MaxInt},
+		{"deadline cancels stuck handlers", 100 * time.Millisecond, time.Hour, false,
+			[][2]int{{1, 1}, {2, 2}}, 2, 2, 1},
+		{"updates queued behind a busy chat are not run", 100 * time.Millisecond, time.Hour, false,
+			[][2]int{{1, 2}, {2, 1}, {3, 1}, {4, 1}}, 2, 2, 1},
+		{"handlers ignoring cancellation stay unconfirmed", 100 * time.Millisecond, time.Hour, true,
+			[][2]int{{5, 1}, {6, 2}}, 0, 0, 5},
+	}
+
+	oldStore := store
+	defer func() { store = oldStore }()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store = openTestStore(t, filepath.Join(t.TempDir(), "btcbot.db"))
+
+			release := make(chan struct{})
+			defer close(release)
+			var handled, cancelled atomic.Int32
+			handler := func(ctx context.Context, update tgbotapi.Update) {
+				if tt.stuck {
+					<-release
+					return
+				}
+				select {
+				case <-time.After(tt.work):
+				case <-ctx.Done():
+					cancelled.Add(1)
+				}
+				handled.Add(1)
+			}
+
+			handlersCtx, stopHandlers := context.WithCancel(context.Background())
+			jobsCtx, stopJobs := context.WithCancel(context.Background())
+			var jobStopped atomic.Bool
+			startJob(func() {
+				<-jobsCtx.Done()
+				jobStopped.Store(true)
+			})
+
+			receiver := &fakeReceiver{ch: make(chan tgbotapi.Update, 10), handled: &handled}
+			receiver.acknowledged.Store(-1)
+			d := newDispatcher(handlersCtx, 4, time.Hour, handler, func(tgbotapi.Update) {})
+			go d.run(receiver.updates())
+
+			for _, u := range tt.updates {
+				receiver.ch <- chatUpdate(u[0], int64(u[1]))
+			}
+
+			start := time.Now()
+			shutdown(start.Add(tt.timeout), receiver, d, stopHandlers, stopJobs, &http.Server{})
+			if elapsed := time.Since(start); elapsed > tt.timeout+2*shutdownGrace {
+				t.Errorf("shutdown took %s", elapsed)
+			}
+
+			if got := handled.Load(); got != tt.wantHandled {
+				t.Errorf("handled %d updates, want %d", got, tt.wantHandled)
+			}
+			if got := cancelled.Load(); got != tt.wantCancelled {
+				t.Errorf("cancelled %d handlers, want %d", got, tt.wantCancelled)
+			}
+			// Acknowledging waits for the handlers, and leaves the first
+			// update not handled to the end for Telegram to deliver again
+			if got := receiver.acknowledged.Load(); got != tt.wantHandled {
+				t.Errorf("acknowledged after %d handled updates, want %d", got, tt.wantHandled)
+			}
+			if got := int(receiver.before.Load()); got != tt.wantBefore {
+				t.Errorf("acknowledged updates before %d, want %d", got, tt.wantBefore)
+			}
+			if !jobStopped.Load() {
+				t.Error("background job was not stopped")
+			}
+		})
+	}
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Bucket names
+const (
+	bucketMeta          = "meta"
+	bucketChats         = "chats"
+	bucketAlerts        = "alerts"
+	bucketSubscriptions = "subscriptions"
+	bucketTxWatches     = "tx_watches"
+	bucketWatches       = "watches"
+	bucketBans          = "bans"
+)
+
+// Meta key holding the schema version of the store
+const metaSchemaVersion = "schema_version"
+
+// storeFile is the layout of backups: a schema version and a set of named
+// buckets, each mapping keys to JSON-encoded records
+type storeFile struct {
+	SchemaVersion int                                   `json:"schema_version"`
+	Buckets       map[string]map[string]json.RawMessage `json:"buckets"`
+}
+
+// Store is an embedded key/value store backed by a bbolt database. Records
+// are JSON-encoded and each transaction only writes the pages it changed.
+type Store struct {
+	db   *bolt.DB
+	path string
+}
+
+// Global store used by the repositories
+var store *Store
+
+// Function to open the store at path, creating it if needed and running pending
+// migrations
+func openStore(path string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("error creating storage directory: %v", err)
+	}
+
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("error opening storage: %v", err)
+	}
+	s := &Store{db: db, path: path}
+
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	version, err := s.schemaVersion()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	log.Printf("Opened storage %s (schema version %d)", path, version)
+	return s, nil
+}
+
+// Function to read the schema version of the store
+func (s *Store) schemaVersion() (int, error) {
+	var version int
+	err := s.View(func(tx *storeTx) error {
+		_, err := tx.Get(bucketMeta, metaSchemaVersion, &version)
+		return err
+	})
+	return version, err
+}
+
+// Function to apply all migrations newer than the stored schema version
+func (s *Store) migrate() error {
+	version, err := s.schemaVersion()
+	if err != nil {
+		return err
+	}
+	if version < 0 {
+		return fmt.Errorf("invalid storage schema version %d", version)
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("storage schema version %d is newer than this build supports (%d)",
+			version, len(migrations))
+	}
+
+	for ; version < len(migrations); version++ {
+		err := s.Update(func(tx *storeTx) error {
+			if err := migrations[version](filepath.Dir(s.path), tx); err != nil {
+				return err
+			}
+			return tx.Put(bucketMeta, metaSchemaVersion, version+1)
+		})
+		if err != nil {
+			return fmt.Errorf("error running migration %d: %v", version+1, err)
+		}
+		log.Printf("Applied storage migration %d", version+1)
+	}
+	return nil
+}
+
+// storeTx is a read or read/write transaction on the store. Changes become
+// visible to other transactions only when the transaction commits.
+type storeTx struct {
+	tx *bolt.Tx
+}
+
+// Function to read a record into v. Returns false if the key does not exist.
+func (tx *storeTx) Get(bucket, key string, v interface{}) (bool, error) {
+	b := tx.tx.Bucket([]byte(bucket))
+	if b == nil {
+		return false, nil
+	}
+	raw := b.Get([]byte(key))
+	if raw == nil {
+		return false, nil
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return false, fmt.Errorf("error decoding %s/%s: %v", bucket, key, err)
+	}
+	return true, nil
+}
+
+// Function to write a record
+func (tx *storeTx) Put(bucket, key string, v interface{}) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("error encoding %s/%s: %v", bucket, key, err)
+	}
+	b, err := tx.tx.CreateBucketIfNotExists([]byte(bucket))
+	if err != nil {
+		return fmt.Errorf("error creating bucket %s: %v", bucket, err)
+	}
+	if err := b.Put([]byte(key), raw); err != nil {
+		return fmt.Errorf("error writing %s/%s: %v", bucket, key, err)
+	}
+	return nil
+}
+
+// Function to delete a record
+func (tx *storeTx) Delete(bucket, key string) {
+	if b := tx.tx.Bucket([]byte(bucket)); b != nil {
+		// Only fails in read-only transactions, which never call Delete
+		b.Delete([]byte(key))
+	}
+}
+
+// Function to call fn for every record in a bucket, in key order. The records
+// are read up front, so fn may modify the bucket.
+func (tx *storeTx) ForEach(bucket string, fn func(key string, raw json.RawMessage) error) error {
+	b := tx.tx.Bucket([]byte(bucket))
+	if b == nil {
+		return nil
+	}
+
+	type record struct {
+		key string
+		raw json.RawMessage
+	}
+	var records []record
+	err := b.ForEach(func(k, v []byte) error {
+		// Values are only valid during the transaction, and fn may outlive the iteration
+		records = append(records, record{string(k), append(json.RawMessage(nil), v...)})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, r := range records {
+		if err := fn(r.key, r.raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Function to run fn in a read-only transaction
+func (s *Store) View(fn func(tx *storeTx) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		return fn(&storeTx{tx: tx})
+	})
+}
+
+// Function to run fn in a read/write transaction. If fn returns an error no
+// changes are applied, otherwise they are written to disk before returning.
+func (s *Store) Update(fn func(tx *storeTx) error) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return fn(&storeTx{tx: tx})
+	})
+}
+
+// Function to write a consistent snapshot of the store to w as JSON
+func (s *Store) Backup(w io.Writer) error {
+	file := storeFile{Buckets: make(map[string]map[string]json.RawMessage)}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			records := make(map[string]json.RawMessage)
+			err := b.ForEach(func(k, v []byte) error {
+				records[string(k)] = append(json.RawMessage(nil), v...)
+				return nil
+			})
+			file.Buckets[string(name)] = records
+			return err
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	// The schema version is kept apart from the meta records in backups
+	if raw, ok := file.Buckets[bucketMeta][metaSchemaVersion]; ok {
+		version, err := strconv.Atoi(string(raw))
+		if err != nil {
+			return fmt.Errorf("invalid schema version %s", raw)
+		}
+		file.SchemaVersion = version
+		delete(file.Buckets[bucketMeta], metaSchemaVersion)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(file)
+}
+
+// Function to replace the whole store with a backup read from r
+func (s *Store) Restore(r io.Reader) error {
+	var file storeFile
+	if err := json.NewDecoder(r).Decode(&file); err != nil {
+		return fmt.Errorf("error parsing backup: %v", err)
+	}
+	if file.Buckets == nil {
+		return fmt.Errorf("backup contains no data")
+	}
+	if file.SchemaVersion < 0 {
+		return fmt.Errorf("invalid backup schema version %d", file.SchemaVersion)
+	}
+	if file.SchemaVersion > len(migrations) {
+		return fmt.Errorf("backup schema version %d is newer than this build supports (%d)",
+			file.SchemaVersion, len(migrations))
+	}
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		var names [][]byte
+		err := tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+			names = append(names, append([]byte(nil), name...))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			if err := tx.DeleteBucket(name); err != nil {
+				return err
+			}
+		}
+
+		for name, records := range file.Buckets {
+			b, err := tx.CreateBucket([]byte(name))
+			if err != nil {
+				return err
+			}
+			for key, raw := range records {
+				if err := b.Put([]byte(key), raw); err != nil {
+					return err
+				}
+			}
+		}
+		return (&storeTx{tx: tx}).Put(bucketMeta, metaSchemaVersion, file.SchemaVersion)
+	})
+	if err != nil {
+		return fmt.Errorf("error restoring backup: %v", err)
+	}
+
+	// Bring older backups up to the current schema
+	return s.migrate()
+}
+
+// Function to close the store, flushing it to disk
+func (s *Store) Close() error {
+	return s.db.Close()
+}
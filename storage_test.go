@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func openTestStore(t *testing.T, path string) *Store {
+	t.Helper()
+	s, err := openStore(path)
+	if err != nil {
+		t.Fatalf("openStore: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestStoreReadWrite(t *testing.T) {
+	s := openTestStore(t, filepath.Join(t.TempDir(), "btcbot.db"))
+
+	err := s.Update(func(tx *storeTx) error {
+		for _, key := range []string{"b", "a", "c"} {
+			if err := tx.Put(bucketChats, key, key+"-value"); err != nil {
+				return err
+			}
+		}
+		tx.Delete(bucketChats, "c")
+		tx.Delete(bucketAlerts, "missing")
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var keys []string
+	err = s.View(func(tx *storeTx) error {
+		var value string
+		if found, err := tx.Get(bucketChats, "a", &value); err != nil || !found || value != "a-value" {
+			t.Errorf("Get(a) = %q, %v, %v", value, found, err)
+		}
+		if found, _ := tx.Get(bucketChats, "c", &value); found {
+			t.Error("deleted key c still found")
+		}
+		if found, _ := tx.Get(bucketAlerts, "a", &value); found {
+			t.Error("key found in missing bucket")
+		}
+		return tx.ForEach(bucketChats, func(key string, raw json.RawMessage) error {
+			keys = append(keys, key)
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys[0] != "a" || keys[1] != "b" {
+		t.Errorf("ForEach keys = %v, want [a b]", keys)
+	}
+}
+
+func TestStoreUpdateRollsBackOnError(t *testing.T) {
+	s := openTestStore(t, filepath.Join(t.TempDir(), "btcbot.db"))
+
+	failure := errors.New("failure")
+	err := s.Update(func(tx *storeTx) error {
+		if err := tx.Put(bucketChats, "a", 1); err != nil {
+			return err
+		}
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("Update error = %v, want %v", err, failure)
+	}
+
+	s.View(func(tx *storeTx) error {
+		var value int
+		if found, _ := tx.Get(bucketChats, "a", &value); found {
+			t.Error("write of failed transaction was committed")
+		}
+		return nil
+	})
+}
+
+func TestStoreForEachAllowsModification(t *testing.T) {
+	s := openTestStore(t, filepath.Join(t.TempDir(), "btcbot.db"))
+
+	err := s.Update(func(tx *storeTx) error {
+		for _, key := range []string{"a", "b", "c"} {
+			if err := tx.Put(bucketAlerts, key, key); err != nil {
+				return err
+			}
+		}
+		return tx.ForEach(bucketAlerts, func(key string, raw json.RawMessage) error {
+			tx.Delete(bucketAlerts, key)
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.View(func(tx *storeTx) error {
+		return tx.ForEach(bucketAlerts, func(key string, raw json.RawMessage) error {
+			t.Errorf("record %s left after deleting all records", key)
+			return nil
+		})
+	})
+}
+
+func TestStoreBackupRestore(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestStore(t, filepath.Join(dir, "btcbot.db"))
+
+	err := s.Update(func(tx *storeTx) error {
+		return tx.Put(bucketChats, "42", chatRecord{ID: 42, Type: "private", Active: true})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var backup bytes.Buffer
+	if err := s.Backup(&backup); err != nil {
+		t.Fatal(err)
+	}
+	var file storeFile
+	if err := json.Unmarshal(backup.Bytes(), &file); err != nil {
+		t.Fatalf("backup is not valid JSON: %v", err)
+	}
+	if file.SchemaVersion != len(migrations) {
+		t.Errorf("backup schema version = %d, want %d", file.SchemaVersion, len(migrations))
+	}
+	if _, ok := file.Buckets[bucketMeta][metaSchemaVersion]; ok {
+		t.Error("schema version duplicated in the meta bucket of the backup")
+	}
+
+	restored := openTestStore(t, filepath.Join(dir, "restored.db"))
+	restored.Update(func(tx *storeTx) error {
+		return tx.Put(bucketAlerts, "0000000001", "dropped by restore")
+	})
+	if err := restored.Restore(bytes.NewReader(backup.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+
+	restored.View(func(tx *storeTx) error {
+		var record chatRecord
+		if found, err := tx.Get(bucketChats, "42", &record); err != nil || !found || record.ID != 42 {
+			t.Errorf("restored chat = %+v, %v, %v", record, found, err)
+		}
+		var alert string
+		if found, _ := tx.Get(bucketAlerts, "0000000001", &alert); found {
+			t.Error("restore kept records missing from the backup")
+		}
+		return nil
+	})
+	if version, err := restored.schemaVersion(); err != nil || version != len(migrations) {
+		t.Errorf("restored schema version = %d, %v", version, err)
+	}
+}
+
+func TestStoreRestoreRejectsInvalidSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "btcbot.db")
+	s := openTestStore(t, path)
+	s.Update(func(tx *storeTx) error {
+		return tx.Put(bucketChats, "42", chatRecord{ID: 42, Type: "private", Active: true})
+	})
+
+	tests := []struct {
+		name   string
+		backup string
+	}{
+		{"newer schema", `{"schema_version": 999, "buckets": {}}`},
+		{"negative schema", `{"schema_version": -1, "buckets": {"chats": {}}}`},
+	}
+	for _, tt := range tests {
+		if err := s.Restore(bytes.NewBufferString(tt.backup)); err == nil {
+			t.Errorf("Restore accepted a backup with a %s", tt.name)
+		}
+	}
+
+	// Rejected backups leave the store as it was
+	if version, err := s.schemaVersion(); err != nil || version != len(migrations) {
+		t.Errorf("schema version = %d, %v", version, err)
+	}
+	if _, found, _ := (&chatRepository{store: s}).get(42); !found {
+		t.Error("rejected backup dropped existing records")
+	}
+
+	// A store left with an invalid version fails to open instead of panicking
+	s.Update(func(tx *storeTx) error {
+		return tx.Put(bucketMeta, metaSchemaVersion, -1)
+	})
+	if err := s.migrate(); err == nil {
+		t.Error("migrate accepted a negative schema version")
+	}
+}
+
+func TestMigrationImportsLegacyAlerts(t *testing.T) {
+	dir := t.TempDir()
+	legacy := `[{"id": 3, "chat_id": 1, "direction": "above", "threshold": 100000, "currency": "usd"}]`
+	if err := os.WriteFile(filepath.Join(dir, "alerts.json"), []byte(legacy), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	s := openTestStore(t, filepath.Join(dir, "btcbot.db"))
+	s.View(func(tx *storeTx) error {
+		var alert priceAlert
+		if found, err := tx.Get(bucketAlerts, alertKey(3), &alert); err != nil || !found || alert.Threshold != 100000 {
+			t.Errorf("imported alert = %+v, %v, %v", alert, found, err)
+		}
+		var nextID int64
+		if _, err := tx.Get(bucketMeta, metaNextAlertID, &nextID); err != nil || nextID != 4 {
+			t.Errorf("next alert ID = %d, %v, want 4", nextID, err)
+		}
+		return nil
+	})
+}
+
+func TestChatTouchSkipsUnchangedChats(t *testing.T) {
+	s := openTestStore(t, filepath.Join(t.TempDir(), "btcbot.db"))
+	repo := &chatRepository{store: s}
+
+	chat := &tgbotapi.Chat{ID: 5, Type: "group", Title: "Group"}
+	if err := repo.touch(chat); err != nil {
+		t.Fatal(err)
+	}
+	first, _, _ := repo.get(5)
+
+	if err := repo.touch(chat); err != nil {
+		t.Fatal(err)
+	}
+	second, _, _ := repo.get(5)
+	if !second.LastSeen.Equal(first.LastSeen) {
+		t.Error("unchanged chat was written again")
+	}
+
+	chat.Title = "Renamed"
+	if err := repo.touch(chat); err != nil {
+		t.Fatal(err)
+	}
+	if third, _, _ := repo.get(5); third.Title != "Renamed" {
+		t.Errorf("title = %q after rename", third.Title)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Function to describe the confirmation status of a transaction, given the chain tip height
+func describeTxStatus(tx esploraTx, tipHeight int64) string {
+	if !tx.Status.Confirmed {
+		return "Unconfirmed (in mempool)"
+	}
+	confirmations := tipHeight - tx.Status.BlockHeight + 1
+	if confirmations == 1 {
+		return "Confirmed (1 confirmation)"
+	}
+	return fmt.Sprintf("Confirmed (%d confirmations)", confirmations)
+}
+
+// Handle /tx command
+func handleTxCommand(ctx context.Context, update tgbotapi.Update) {
+	chatID := update.Message.Chat.ID
+
+	args := strings.Fields(update.Message.CommandArguments())
+	if len(args) == 0 || !isHash(args[0]) {
+		sendMessage(chatID, "Usage: /tx <txid> [currency]")
+		return
+	}
+	txid := strings.ToLower(args[0])
+	currency, err := currencyFromArgs(chatID, args[1:])
+	if err != nil {
+		sendCurrencyError(chatID)
+		return
+	}
+
+	tx, txAsOf, err := cached(ctx, "tx:"+txid, func(ctx context.Context) (esploraTx, error) {
+		return getTransaction(ctx, txid)
+	})
+	if isNotFound(err) {
+		sendMessage(chatID, "Transaction not found.")
+		return
+	}
+	if err != nil {
+		log.Println("Error fetching transaction:", err)
+		sendMessage(chatID, "Error fetching transaction.")
+		return
+	}
+
+	tipHeight, tipAsOf, err := cached(ctx, "block", func(ctx context.Context) (int64, error) {
+		return getBTCBlockNumber(ctx)
+	})
+	if err != nil {
+		log.Println("Error fetching BTC block number:", err)
+		sendMessage(chatID, "Error fetching BTC block number.")
+		return
+	}
+
+	// Amounts are still useful in BTC when the price is unavailable
+	price, priceAsOf, err := getPrice(ctx, bitcoinID, currency)
+	if err != nil {
+		log.Println("Error fetching BTC price:", err)
+		priceAsOf = tipAsOf
+	}
+	formatAmount := func(sats int64) string {
+		if price == 0 {
+			return formatBTC(sats)
+		}
+		return formatBTCWithFiat(sats, price, currency)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Transaction %s\n", tx.Txid)
+	fmt.Fprintf(&b, "Status: %s\n", describeTxStatus(tx, tipHeight))
+	if tx.Status.Confirmed {
+		blockTime := time.Unix(tx.Status.BlockTime, 0).UTC()
+		fmt.Fprintf(&b, "Block: %d (%s UTC)\n", tx.Status.BlockHeight, blockTime.Format("2006-01-02 15:04"))
+	}
+
+	in, out := tx.totals()
+	if tx.isCoinbase() {
+		b.WriteString("Coinbase transaction (block reward)\n")
+	} else {
+		fmt.Fprintf(&b, "Fee: %s\n", formatAmount(tx.Fee))
+		fmt.Fprintf(&b, "Fee rate: %.1f sat/vB\n", tx.feeRate())
+	}
+	fmt.Fprintf(&b, "Size: %d B, virtual size: %d vB, weight: %d WU\n", tx.Size, tx.vsize(), tx.Weight)
+
+	if tx.signalsRBF() {
+		b.WriteString("RBF: signaled\n")
+	} else {
+		b.WriteString("RBF: not signaled\n")
+	}
+
+	if !tx.isCoinbase() {
+		fmt.Fprintf(&b, "Inputs: %d totalling %s\n", len(tx.Vin), formatAmount(in))
+	}
+	fmt.Fprintf(&b, "Outputs: %d totalling %s", len(tx.Vout), formatAmount(out))
+
+	sendMessage(chatID, b.String()+dataAsOf(txAsOf, tipAsOf, priceAsOf))
+}
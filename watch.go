@@ -0,0 +1,475 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Number of consecutive unused addresses after the last used one that are
+// scanned on every chain of an extended key
+const watchGapLimit = 20
+
+// Largest number of addresses derived for one watch
+const maxWatchAddresses = 1000
+
+// Largest number of address watches per chat
+const maxWatchesPerChat = 10
+
+// Key in the meta bucket holding the next address watch ID
+const metaNextWatchID = "next_watch_id"
+
+// Address belonging to a watch with its last seen totals in sats, including
+// unconfirmed transactions
+type watchedAddress struct {
+	Address string `json:"address"`
+	Chain   int    `json:"chain"`
+	Index   uint32 `json:"index"`
+	Funded  int64  `json:"funded"`
+	Spent   int64  `json:"spent"`
+	Used    bool   `json:"used"`
+}
+
+// Address, extended key or descriptor watched by a chat for incoming and
+// outgoing payments
+type addressWatch struct {
+	ID     int64  `json:"id"`
+	ChatID int64  `json:"chat_id"`
+	Target string `json:"target"`
+	watchSource
+	Addresses []watchedAddress `json:"addresses"`
+	CreatedAt time.Time        `json:"created_at"`
+}
+
+// Helper function to build the storage key of an address watch, zero-padded so keys sort by ID
+func watchKey(id int64) string {
+	return fmt.Sprintf("%010d", id)
+}
+
+// Function to get the balance of all addresses of a watch in sats, including unconfirmed transactions
+func (w addressWatch) balance() int64 {
+	var balance int64
+	for _, address := range w.Addresses {
+		balance += address.Funded - address.Spent
+	}
+	return balance
+}
+
+// Function to describe a watch for messages, e.g. bc1qar0s…5mdq or zpub6rFR…e8WJ (P2WPKH)
+func (w addressWatch) label() string {
+	if w.Key == "" {
+		return shortTxid(w.Address)
+	}
+	return fmt.Sprintf("%s (%s)", shortTxid(w.Key), scriptTypeNames[w.ScriptType])
+}
+
+// Function to get the index of the last used address on each chain of a
+// watch, -1 for chains without used addresses
+func (w addressWatch) lastUsed() map[int]int {
+	used := make(map[int]int)
+	for _, address := range w.Addresses {
+		if _, ok := used[address.Chain]; !ok {
+			used[address.Chain] = -1
+		}
+		if address.Used {
+			used[address.Chain] = max(used[address.Chain], int(address.Index))
+		}
+	}
+	return used
+}
+
+// Function to refresh the totals of the addresses of a watch and derive new
+// addresses of extended keys until the gap limit is reached. A full refresh
+// checks every address, otherwise only the unused addresses past the last
+// used one of each chain are checked, where new payments arrive. Returns the
+// sats received and spent since the last refresh and whether any of it is
+// unconfirmed.
+func (w *addressWatch) refresh(ctx context.Context, full bool) (received, spent int64, unconfirmed bool, err error) {
+	update := func(address *watchedAddress) error {
+		stats, _, err := cached(ctx, "address:"+address.Address, func(ctx context.Context) (esploraAddress, error) {
+			return getAddressStats(ctx, address.Address)
+		})
+		if err != nil {
+			return err
+		}
+		funded := stats.ChainStats.FundedTxoSum + stats.MempoolStats.FundedTxoSum
+		spentSum := stats.ChainStats.SpentTxoSum + stats.MempoolStats.SpentTxoSum
+		if funded != address.Funded || spentSum != address.Spent {
+			received += funded - address.Funded
+			spent += spentSum - address.Spent
+			if stats.MempoolStats.TxCount > 0 {
+				unconfirmed = true
+			}
+		}
+		address.Funded = funded
+		address.Spent = spentSum
+		address.Used = stats.ChainStats.TxCount+stats.MempoolStats.TxCount > 0
+		return nil
+	}
+
+	lastUsed := w.lastUsed()
+	for i := range w.Addresses {
+		address := &w.Addresses[i]
+		if !full && w.Key != "" && int(address.Index) <= lastUsed[address.Chain] {
+			continue
+		}
+		if err := update(address); err != nil {
+			return 0, 0, false, err
+		}
+	}
+
+	if w.Key == "" {
+		if len(w.Addresses) == 0 {
+			w.Addresses = []watchedAddress{{Address: w.Address}}
+			if err := update(&w.Addresses[0]); err != nil {
+				return 0, 0, false, err
+			}
+		}
+		return received, spent, unconfirmed, nil
+	}
+
+	key, err := parseExtendedKey(w.Key)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	lastUsed = w.lastUsed()
+	for chain, path := range w.Chains {
+		chainKey, err := key.derive(path)
+		if err != nil {
+			return 0, 0, false, err
+		}
+
+		var next uint32
+		for _, address := range w.Addresses {
+			if address.Chain == chain {
+				next++
+			}
+		}
+		used, ok := lastUsed[chain]
+		if !ok {
+			used = -1
+		}
+
+		for int(next) < used+1+watchGapLimit && len(w.Addresses) < maxWatchAddresses {
+			child, err := chainKey.child(next)
+			if err != nil {
+				return 0, 0, false, err
+			}
+			encoded, err := publicKeyAddress(child.Key, w.ScriptType)
+			if err != nil {
+				return 0, 0, false, err
+			}
+			address := watchedAddress{Address: encoded, Chain: chain, Index: next}
+			if err := update(&address); err != nil {
+				return 0, 0, false, err
+			}
+			w.Addresses = append(w.Addresses, address)
+			if address.Used {
+				used = int(next)
+			}
+			next++
+		}
+	}
+	return received, spent, unconfirmed, nil
+}
+
+// addressWatchRepository stores address watches in the watches bucket
+type addressWatchRepository struct {
+	store *Store
+}
+
+// Global address watch repository
+var addressWatches *addressWatchRepository
+
+// Function to add a new address watch, assigning it the next ID
+func (r *addressWatchRepository) add(watch addressWatch) (addressWatch, error) {
+	err := r.store.Update(func(tx *storeTx) error {
+		var nextID int64 = 1
+		if _, err := tx.Get(bucketMeta, metaNextWatchID, &nextID); err != nil {
+			return err
+		}
+		watch.ID = nextID
+		if err := tx.Put(bucketMeta, metaNextWatchID, nextID+1); err != nil {
+			return err
+		}
+		return tx.Put(bucketWatches, watchKey(watch.ID), watch)
+	})
+	return watch, err
+}
+
+// Function to call fn for every stored address watch
+func forEachAddressWatch(tx *storeTx, fn func(watch addressWatch) error) error {
+	return tx.ForEach(bucketWatches, func(key string, raw json.RawMessage) error {
+		var watch addressWatch
+		if err := json.Unmarshal(raw, &watch); err != nil {
+			return fmt.Errorf("error decoding address watch %s: %v", key, err)
+		}
+		return fn(watch)
+	})
+}
+
+// Function to store the refreshed state of a watch, unless it was removed in the meantime
+func (r *addressWatchRepository) save(watch addressWatch) error {
+	return r.store.Update(func(tx *storeTx) error {
+		var existing addressWatch
+		found, err := tx.Get(bucketWatches, watchKey(watch.ID), &existing)
+		if err != nil || !found {
+			return err
+		}
+		return tx.Put(bucketWatches, watchKey(watch.ID), watch)
+	})
+}
+
+// Function to list all address watches, or those of one chat if chatID is not 0
+func (r *addressWatchRepository) list(chatID int64) ([]addressWatch, error) {
+	var result []addressWatch
+	err := r.store.View(func(tx *storeTx) error {
+		return forEachAddressWatch(tx, func(watch addressWatch) error {
+			if chatID == 0 || watch.ChatID == chatID {
+				result = append(result, watch)
+			}
+			return nil
+		})
+	})
+	return result, err
+}
+
+// Function to remove address watches of a chat. An id of 0 removes all of them.
+// Returns the number of watches removed.
+func (r *addressWatchRepository) remove(chatID, id int64) (int, error) {
+	removed := 0
+	err := r.store.Update(func(tx *storeTx) error {
+		return forEachAddressWatch(tx, func(watch addressWatch) error {
+			if watch.ChatID == chatID && (id == 0 || watch.ID == id) {
+				tx.Delete(bucketWatches, watchKey(watch.ID))
+				removed++
+			}
+			return nil
+		})
+	})
+	return removed, err
+}
+
+// A full refresh of all watched addresses runs at least this often, in case
+// the block feed is down
+const addressWatchFullInterval = 30 * time.Minute
+
+// Function to watch addresses and notify chats about payments. Every new block
+// from the feed triggers a full refresh, as confirmations can move funds on
+// any address. In between, only the addresses new payments arrive on are
+// polled every interval, to notice unconfirmed payments.
+func runAddressWatcher(ctx context.Context, interval time.Duration, blocks <-chan int64) {
+	log.Println("Starting address watcher, polling every", interval, "and on every new block")
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	lastFull := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-blocks:
+			checkAddressWatches(ctx, true)
+			lastFull = time.Now()
+		case <-ticker.C:
+			full := time.Since(lastFull) >= addressWatchFullInterval
+			checkAddressWatches(ctx, full)
+			if full {
+				lastFull = time.Now()
+			}
+		}
+	}
+}
+
+// Function to check all watched addresses once, refreshing every address if full is set
+func checkAddressWatches(ctx context.Context, full bool) {
+	watches, err := addressWatches.list(0)
+	if err != nil {
+		log.Println("Error loading address watches:", err)
+		return
+	}
+
+	for _, watch := range watches {
+		if err := checkAddressWatch(ctx, watch, full); err != nil {
+			log.Printf("Error checking address watch %d: %v", watch.ID, err)
+		}
+	}
+}
+
+// Function to check one address watch and notify its chat about payments
+func checkAddressWatch(ctx context.Context, watch addressWatch, full bool) error {
+	addressCount := len(watch.Addresses)
+	received, spent, unconfirmed, err := watch.refresh(ctx, full)
+	if err != nil {
+		return err
+	}
+	if received == 0 && spent == 0 && len(watch.Addresses) == addressCount {
+		return nil
+	}
+	if err := addressWatches.save(watch); err != nil {
+		return err
+	}
+	if received == 0 && spent == 0 {
+		return nil
+	}
+
+	// Amounts are still useful in BTC when the price is unavailable
+	currency := chatCurrency(watch.ChatID)
+	price, _, err := getPrice(ctx, bitcoinID, currency)
+	if err != nil {
+		log.Println("Error fetching BTC price for address watch:", err)
+	}
+	formatAmount := func(sats int64) string {
+		if price == 0 {
+			return formatBTC(sats)
+		}
+		return formatBTCWithFiat(sats, price, currency)
+	}
+
+	// Payments between addresses of the same wallet show up as both received
+	// and spent, so only the net amount is reported
+	var message string
+	switch net := received - spent; {
+	case net > 0:
+		message = fmt.Sprintf("📥 Watch #%d %s received %s", watch.ID, watch.label(), formatAmount(net))
+	case net < 0:
+		message = fmt.Sprintf("📤 Watch #%d %s sent %s", watch.ID, watch.label(), formatAmount(-net))
+	default:
+		message = fmt.Sprintf("🔄 Watch #%d %s moved funds between its own addresses", watch.ID, watch.label())
+	}
+	if unconfirmed {
+		message += " (unconfirmed)"
+	}
+	message += ".\nBalance: " + formatAmount(watch.balance())
+	sendMessage(watch.ChatID, message)
+	return nil
+}
+
+// Handle /watch command
+func handleWatchCommand(ctx context.Context, update tgbotapi.Update) {
+	chatID := update.Message.Chat.ID
+
+	args := strings.Fields(update.Message.CommandArguments())
+	if len(args) == 0 {
+		watches, err := addressWatches.list(chatID)
+		if err != nil {
+			log.Println("Error loading address watches:", err)
+			sendMessage(chatID, "Error loading watches.")
+			return
+		}
+		if len(watches) == 0 {
+			sendMessage(chatID, "Nothing is watched in this chat. Watch something with /watch <address|xpub|descriptor>")
+			return
+		}
+		message := "Watches:\n"
+		for _, watch := range watches {
+			message += fmt.Sprintf("#%d %s, %d address(es), balance %s\n", watch.ID, watch.label(), len(watch.Addresses), formatBTC(watch.balance()))
+		}
+		message += "\nStop watching with /unwatch <id> or /unwatch all"
+		sendMessage(chatID, message)
+		return
+	}
+
+	if len(args) > 1 {
+		sendMessage(chatID, "Usage: /watch <address|xpub|descriptor>")
+		return
+	}
+
+	source, err := parseWatchTarget(args[0])
+	if err != nil {
+		sendMessage(chatID, fmt.Sprintf("Cannot watch %s: %v.", args[0], err))
+		return
+	}
+
+	existing, err := addressWatches.list(chatID)
+	if err != nil {
+		log.Println("Error loading address watches:", err)
+		sendMessage(chatID, "Error loading watches.")
+		return
+	}
+	if len(existing) >= maxWatchesPerChat {
+		sendMessage(chatID, fmt.Sprintf("This chat already has %d watches. Remove one with /unwatch <id> first.", maxWatchesPerChat))
+		return
+	}
+
+	if source.Key != "" {
+		sendMessage(chatID, "Scanning addresses, this may take a moment…")
+	}
+
+	// The initial scan only records the current state, payments are reported from the next poll on
+	watch := addressWatch{
+		ChatID:      chatID,
+		Target:      args[0],
+		watchSource: source,
+		CreatedAt:   time.Now(),
+	}
+	if _, _, _, err := watch.refresh(ctx, true); err != nil {
+		log.Println("Error scanning watched addresses:", err)
+		sendMessage(chatID, "Error fetching address balances.")
+		return
+	}
+
+	watch, err = addressWatches.add(watch)
+	if err != nil {
+		log.Println("Error saving address watch:", err)
+		sendMessage(chatID, "Error saving watch.")
+		return
+	}
+
+	currency := chatCurrency(chatID)
+	balance := formatBTC(watch.balance())
+	if price, _, err := getPrice(ctx, bitcoinID, currency); err == nil {
+		balance = formatBTCWithFiat(watch.balance(), price, currency)
+	} else {
+		log.Println("Error fetching BTC price:", err)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Watch #%d: %s\n", watch.ID, watch.label())
+	if watch.Key != "" {
+		used := 0
+		for _, address := range watch.Addresses {
+			if address.Used {
+				used++
+			}
+		}
+		fmt.Fprintf(&b, "Addresses: %d derived on %d chain(s), %d used\n", len(watch.Addresses), len(watch.Chains), used)
+	}
+	fmt.Fprintf(&b, "Balance: %s\n", balance)
+	b.WriteString("You will be notified when funds are received or sent.")
+	sendMessage(chatID, b.String())
+}
+
+// Handle /unwatch command
+func handleUnwatchCommand(ctx context.Context, update tgbotapi.Update) {
+	chatID := update.Message.Chat.ID
+
+	arg := strings.TrimPrefix(strings.ToLower(strings.TrimSpace(update.Message.CommandArguments())), "#")
+	var id int64
+	if arg != "all" {
+		var err error
+		id, err = strconv.ParseInt(arg, 10, 64)
+		if err != nil || id < 1 {
+			sendMessage(chatID, "Usage: /unwatch <id> or /unwatch all")
+			return
+		}
+	}
+
+	removed, err := addressWatches.remove(chatID, id)
+	if err != nil {
+		log.Println("Error saving address watches:", err)
+		sendMessage(chatID, "Error removing watch.")
+		return
+	}
+	if removed == 0 {
+		sendMessage(chatID, "No matching watch found.")
+		return
+	}
+	sendMessage(chatID, fmt.Sprintf("Removed %d watch(es).", removed))
+}
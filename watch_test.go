@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// BIP 32 test vector 1, chain m
+const testXpub = "xpub661MyMwAqRbcFtXgS5sYJABqqG9YLmC4Q1Rdap9gSE8NqtwybGhePY2gZ29ESFjqJoCu1Rupje8YtGqsefD265TMg7usUDFdp6W1EGMcet8"
+
+// addressServer serves /address/:address like the esplora API and counts the
+// requests per address
+type addressServer struct {
+	mu       sync.Mutex
+	stats    map[string]esploraAddress
+	requests map[string]int
+}
+
+func (s *addressServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	address := strings.TrimPrefix(r.URL.Path, "/address/")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests[address]++
+	stats := s.stats[address]
+	stats.Address = address
+	json.NewEncoder(w).Encode(stats)
+}
+
+// Function to set the stats of an address and forget the requests so far
+func (s *addressServer) reset(stats map[string]esploraAddress) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for address, st := range stats {
+		s.stats[address] = st
+	}
+	s.requests = make(map[string]int)
+}
+
+// Helper function to derive the P2WPKH address at chain/index of the test key
+func testWatchAddress(t *testing.T, chain, index uint32) string {
+	t.Helper()
+	key, err := parseExtendedKey(testXpub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	child, err := key.derive([]uint32{chain, index})
+	if err != nil {
+		t.Fatal(err)
+	}
+	address, err := publicKeyAddress(child.Key, scriptP2WPKH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return address
+}
+
+func TestAddressWatchRefreshPollsGapAfterLastUsed(t *testing.T) {
+	server := &addressServer{stats: make(map[string]esploraAddress)}
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+	cfg = defaultConfig()
+	cfg.MempoolURL = httpServer.URL
+	savedCache := upstreamCache
+	t.Cleanup(func() { upstreamCache = savedCache })
+
+	watch := addressWatch{watchSource: watchSource{
+		ScriptType: scriptP2WPKH,
+		Key:        testXpub,
+		Chains:     [][]uint32{{0}, {1}},
+	}}
+	refresh := func(full bool) (int64, int64, bool) {
+		t.Helper()
+		upstreamCache = newTestCache()
+		received, spent, unconfirmed, err := watch.refresh(context.Background(), full)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return received, spent, unconfirmed
+	}
+	countAddresses := func(chain int) int {
+		n := 0
+		for _, address := range watch.Addresses {
+			if address.Chain == chain {
+				n++
+			}
+		}
+		return n
+	}
+
+	// The first scan derives the gap limit past the last used address on each chain
+	var used esploraAddress
+	used.ChainStats.TxCount = 1
+	used.ChainStats.FundedTxoSum = 1000
+	server.reset(map[string]esploraAddress{testWatchAddress(t, 0, 2): used})
+	if received, _, _ := refresh(true); received != 1000 {
+		t.Errorf("received = %d, want 1000", received)
+	}
+	if got := countAddresses(0); got != 3+watchGapLimit {
+		t.Errorf("receive chain has %d addresses, want %d", got, 3+watchGapLimit)
+	}
+	if got := countAddresses(1); got != watchGapLimit {
+		t.Errorf("change chain has %d addresses, want %d", got, watchGapLimit)
+	}
+
+	// A partial refresh skips the addresses up to the last used one
+	server.reset(nil)
+	refresh(false)
+	if len(server.requests) != 2*watchGapLimit {
+		t.Errorf("partial refresh polled %d addresses, want %d", len(server.requests), 2*watchGapLimit)
+	}
+	for index := uint32(0); index <= 2; index++ {
+		if server.requests[testWatchAddress(t, 0, index)] > 0 {
+			t.Errorf("partial refresh polled receive address %d", index)
+		}
+	}
+
+	// A payment within the gap is found and extends the scanned range
+	var payment esploraAddress
+	payment.MempoolStats.TxCount = 1
+	payment.MempoolStats.FundedTxoSum = 5000
+	server.reset(map[string]esploraAddress{testWatchAddress(t, 0, 10): payment})
+	received, spent, unconfirmed := refresh(false)
+	if received != 5000 || spent != 0 || !unconfirmed {
+		t.Errorf("refresh = %d, %d, %v, want 5000, 0, true", received, spent, unconfirmed)
+	}
+	if got := countAddresses(0); got != 11+watchGapLimit {
+		t.Errorf("receive chain has %d addresses after payment, want %d", got, 11+watchGapLimit)
+	}
+
+	// A full refresh polls every address
+	server.reset(nil)
+	refresh(true)
+	if len(server.requests) != len(watch.Addresses) {
+		t.Errorf("full refresh polled %d of %d addresses", len(server.requests), len(watch.Addresses))
+	}
+}
@@ -0,0 +1,403 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Confirmation depth used when /watchtx is not given one
+const defaultWatchConfirmations = 6
+
+// Largest confirmation depth accepted by /watchtx
+const maxWatchConfirmations = 100
+
+// Watches are dropped after this long, whether or not the transaction showed up
+const txWatchExpiry = 14 * 24 * time.Hour
+
+// Maximum number of transaction watches per chat
+const maxTxWatchesPerChat = 10
+
+// Output spent by a watched transaction, used to detect replacements
+type txOutpoint struct {
+	Txid string `json:"txid"`
+	Vout uint32 `json:"vout"`
+}
+
+// Transaction watched by a chat until it reaches the target confirmation depth
+type txWatch struct {
+	ChatID        int64        `json:"chat_id"`
+	Txid          string       `json:"txid"`
+	Confirmations int64        `json:"confirmations"`
+	Seen          bool         `json:"seen"`
+	Inputs        []txOutpoint `json:"inputs,omitempty"`
+	BlockHeight   int64        `json:"block_height,omitempty"`
+	BlockHash     string       `json:"block_hash,omitempty"`
+	CreatedAt     time.Time    `json:"created_at"`
+}
+
+// Helper function to build the storage key of a transaction watch
+func txWatchKey(chatID int64, txid string) string {
+	return fmt.Sprintf("%d:%s", chatID, txid)
+}
+
+// Helper function to shorten a txid for messages, e.g. 4a5e1e4b…e8d9c3f2
+func shortTxid(txid string) string {
+	if len(txid) < 16 {
+		return txid
+	}
+	return txid[:8] + "…" + txid[len(txid)-8:]
+}
+
+// Function to record the mempool and block state of a transaction in the watch
+func (w *txWatch) observe(tx esploraTx) {
+	w.Seen = true
+	if len(w.Inputs) == 0 && !tx.isCoinbase() {
+		for _, input := range tx.Vin {
+			w.Inputs = append(w.Inputs, txOutpoint{Txid: input.Txid, Vout: input.Vout})
+		}
+	}
+	if tx.Status.Confirmed {
+		w.BlockHeight = tx.Status.BlockHeight
+		w.BlockHash = tx.Status.BlockHash
+	} else {
+		w.BlockHeight = 0
+		w.BlockHash = ""
+	}
+}
+
+// txWatchRepository stores transaction watches in the tx_watches bucket
+type txWatchRepository struct {
+	store *Store
+}
+
+// Global transaction watch repository
+var txWatches *txWatchRepository
+
+// Function to call fn for every stored transaction watch
+func forEachTxWatch(tx *storeTx, fn func(watch txWatch) error) error {
+	return tx.ForEach(bucketTxWatches, func(key string, raw json.RawMessage) error {
+		var watch txWatch
+		if err := json.Unmarshal(raw, &watch); err != nil {
+			return fmt.Errorf("error decoding transaction watch %s: %v", key, err)
+		}
+		return fn(watch)
+	})
+}
+
+// Function to create or replace a transaction watch
+func (r *txWatchRepository) save(watch txWatch) error {
+	return r.store.Update(func(tx *storeTx) error {
+		return tx.Put(bucketTxWatches, txWatchKey(watch.ChatID, watch.Txid), watch)
+	})
+}
+
+// Function to move a watch to the transaction that replaced it
+func (r *txWatchRepository) replace(watch txWatch, previousTxid string) error {
+	return r.store.Update(func(tx *storeTx) error {
+		tx.Delete(bucketTxWatches, txWatchKey(watch.ChatID, previousTxid))
+		return tx.Put(bucketTxWatches, txWatchKey(watch.ChatID, watch.Txid), watch)
+	})
+}
+
+// Function to list all transaction watches, or those of one chat if chatID is not 0
+func (r *txWatchRepository) list(chatID int64) ([]txWatch, error) {
+	var result []txWatch
+	err := r.store.View(func(tx *storeTx) error {
+		return forEachTxWatch(tx, func(watch txWatch) error {
+			if chatID == 0 || watch.ChatID == chatID {
+				result = append(result, watch)
+			}
+			return nil
+		})
+	})
+	return result, err
+}
+
+// Function to remove transaction watches of a chat. An empty txid removes all of them.
+func (r *txWatchRepository) remove(chatID int64, txid string) (int, error) {
+	removed := 0
+	err := r.store.Update(func(tx *storeTx) error {
+		return forEachTxWatch(tx, func(watch txWatch) error {
+			if watch.ChatID == chatID && (txid == "" || watch.Txid == txid) {
+				tx.Delete(bucketTxWatches, txWatchKey(watch.ChatID, watch.Txid))
+				removed++
+			}
+			return nil
+		})
+	})
+	return removed, err
+}
+
+// Function to find the transaction that double-spent one of the inputs of a
+// transaction that left the mempool. Returns an empty string if there is none.
+func findReplacement(ctx context.Context, watch txWatch) (string, error) {
+	for _, input := range watch.Inputs {
+		outspend, err := getOutspend(ctx, input.Txid, input.Vout)
+		if err != nil {
+			return "", err
+		}
+		if outspend.Spent && outspend.Txid != watch.Txid {
+			return outspend.Txid, nil
+		}
+	}
+	return "", nil
+}
+
+// Function to poll watched transactions and notify chats about changes
+func runTxWatcher(ctx context.Context, interval time.Duration) {
+	log.Println("Starting transaction watcher, polling every", interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			checkTxWatches(ctx)
+		}
+	}
+}
+
+// Function to check all watched transactions once
+func checkTxWatches(ctx context.Context) {
+	watches, err := txWatches.list(0)
+	if err != nil {
+		log.Println("Error loading transaction watches:", err)
+		return
+	}
+	if len(watches) == 0 {
+		return
+	}
+
+	tipHeight, _, err := cached(ctx, "block", func(ctx context.Context) (int64, error) {
+		return getBTCBlockNumber(ctx)
+	})
+	if err != nil {
+		log.Println("Error fetching BTC block number for transaction watches:", err)
+		return
+	}
+
+	for _, watch := range watches {
+		if err := checkTxWatch(ctx, watch, tipHeight); err != nil {
+			log.Printf("Error checking watched transaction %s: %v", watch.Txid, err)
+		}
+	}
+}
+
+// Function to check one watched transaction and notify its chat about any change
+func checkTxWatch(ctx context.Context, watch txWatch, tipHeight int64) error {
+	short := shortTxid(watch.Txid)
+
+	// Transactions stuck in the mempool, or evicted without a replacement, are not watched forever
+	if time.Since(watch.CreatedAt) > txWatchExpiry {
+		message := fmt.Sprintf("Transaction %s never appeared in the mempool, no longer watching it.", short)
+		if watch.Seen {
+			message = fmt.Sprintf("Transaction %s did not reach %d confirmations within %d days, no longer watching it.",
+				short, watch.Confirmations, int(txWatchExpiry.Hours()/24))
+		}
+		sendMessage(watch.ChatID, message)
+		_, err := txWatches.remove(watch.ChatID, watch.Txid)
+		return err
+	}
+
+	tx, _, err := cached(ctx, "tx:"+watch.Txid, func(ctx context.Context) (esploraTx, error) {
+		return getTransaction(ctx, watch.Txid)
+	})
+	if isNotFound(err) {
+		if !watch.Seen {
+			return nil
+		}
+
+		// A transaction that was seen and vanished was either replaced or evicted
+		replacement, err := findReplacement(ctx, watch)
+		if err != nil {
+			return err
+		}
+		if replacement == "" {
+			return nil
+		}
+
+		previous := watch.Txid
+		watch.Txid = replacement
+		watch.Seen = false
+		watch.Inputs = nil
+		if err := txWatches.replace(watch, previous); err != nil {
+			return err
+		}
+		sendMessage(watch.ChatID, fmt.Sprintf("🔁 Transaction %s was replaced by %s (RBF). Now watching the replacement.", short, replacement))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var notices []string
+	wasSeen, previousHash := watch.Seen, watch.BlockHash
+	watch.observe(tx)
+
+	if !wasSeen && !tx.Status.Confirmed {
+		notices = append(notices, fmt.Sprintf("👀 Transaction %s appeared in the mempool (%.1f sat/vB).", short, tx.feeRate()))
+	}
+	if tx.Status.Confirmed && previousHash == "" {
+		notices = append(notices, fmt.Sprintf("⛏ Transaction %s was mined in block %d.", short, tx.Status.BlockHeight))
+	} else if tx.Status.Confirmed && previousHash != tx.Status.BlockHash {
+		notices = append(notices, fmt.Sprintf("⚠️ Transaction %s was reorganized into block %d.", short, tx.Status.BlockHeight))
+	} else if !tx.Status.Confirmed && previousHash != "" {
+		notices = append(notices, fmt.Sprintf("⚠️ Transaction %s was reorganized out of its block and is back in the mempool.", short))
+	}
+
+	if tx.Status.Confirmed {
+		confirmations := tipHeight - tx.Status.BlockHeight + 1
+		if confirmations >= watch.Confirmations {
+			notices = append(notices, fmt.Sprintf("✅ Transaction %s reached %d confirmations. No longer watching it.", short, confirmations))
+			for _, notice := range notices {
+				sendMessage(watch.ChatID, notice)
+			}
+			_, err := txWatches.remove(watch.ChatID, watch.Txid)
+			return err
+		}
+	}
+
+	if len(notices) == 0 && wasSeen == watch.Seen {
+		return nil
+	}
+	if err := txWatches.save(watch); err != nil {
+		return err
+	}
+	for _, notice := range notices {
+		sendMessage(watch.ChatID, notice)
+	}
+	return nil
+}
+
+// Handle /watchtx command
+func handleWatchTxCommand(ctx context.Context, update tgbotapi.Update) {
+	chatID := update.Message.Chat.ID
+
+	args := strings.Fields(update.Message.CommandArguments())
+	if len(args) == 0 {
+		watches, err := txWatches.list(chatID)
+		if err != nil {
+			log.Println("Error loading transaction watches:", err)
+			sendMessage(chatID, "Error loading watched transactions.")
+			return
+		}
+		if len(watches) == 0 {
+			sendMessage(chatID, "No transactions are watched in this chat. Watch one with /watchtx <txid> [confirmations]")
+			return
+		}
+		message := "Watched transactions:\n"
+		for _, watch := range watches {
+			message += fmt.Sprintf("%s until %d confirmations\n", watch.Txid, watch.Confirmations)
+		}
+		message += "\nStop watching with /unwatchtx <txid> or /unwatchtx all"
+		sendMessage(chatID, message)
+		return
+	}
+
+	if len(args) > 2 || !isHash(args[0]) {
+		sendMessage(chatID, "Usage: /watchtx <txid> [confirmations]")
+		return
+	}
+	txid := strings.ToLower(args[0])
+
+	existing, err := txWatches.list(chatID)
+	if err != nil {
+		log.Println("Error loading transaction watches:", err)
+		sendMessage(chatID, "Error loading watched transactions.")
+		return
+	}
+	watched := false
+	for _, watch := range existing {
+		watched = watched || watch.Txid == txid
+	}
+	// Changing the confirmations of a watched transaction does not add a watch
+	if !watched && len(existing) >= maxTxWatchesPerChat {
+		sendMessage(chatID, fmt.Sprintf("This chat already watches %d transactions. Remove one with /unwatchtx <txid> first.", maxTxWatchesPerChat))
+		return
+	}
+
+	watch := txWatch{
+		ChatID:        chatID,
+		Txid:          txid,
+		Confirmations: defaultWatchConfirmations,
+		CreatedAt:     time.Now(),
+	}
+	if len(args) == 2 {
+		confirmations, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil || confirmations < 1 || confirmations > maxWatchConfirmations {
+			sendMessage(chatID, fmt.Sprintf("Confirmations must be a number between 1 and %d.", maxWatchConfirmations))
+			return
+		}
+		watch.Confirmations = confirmations
+	}
+
+	tx, _, err := cached(ctx, "tx:"+txid, func(ctx context.Context) (esploraTx, error) {
+		return getTransaction(ctx, txid)
+	})
+	if err != nil && !isNotFound(err) {
+		log.Println("Error fetching transaction:", err)
+		sendMessage(chatID, "Error fetching transaction.")
+		return
+	}
+
+	status := "It is not in the mempool yet; you will be notified when it appears."
+	if err == nil {
+		tipHeight, _, err := cached(ctx, "block", func(ctx context.Context) (int64, error) {
+			return getBTCBlockNumber(ctx)
+		})
+		if err != nil {
+			log.Println("Error fetching BTC block number:", err)
+			sendMessage(chatID, "Error fetching BTC block number.")
+			return
+		}
+		if tx.Status.Confirmed && tipHeight-tx.Status.BlockHeight+1 >= watch.Confirmations {
+			sendMessage(chatID, fmt.Sprintf("Transaction %s already has %d confirmations.", shortTxid(txid), tipHeight-tx.Status.BlockHeight+1))
+			return
+		}
+		watch.observe(tx)
+		status = "Current status: " + describeTxStatus(tx, tipHeight) + "."
+	}
+
+	if err := txWatches.save(watch); err != nil {
+		log.Println("Error saving transaction watch:", err)
+		sendMessage(chatID, "Error saving transaction watch.")
+		return
+	}
+
+	sendMessage(chatID, fmt.Sprintf("Watching transaction %s until %d confirmations.\n%s", shortTxid(txid), watch.Confirmations, status))
+}
+
+// Handle /unwatchtx command
+func handleUnwatchTxCommand(ctx context.Context, update tgbotapi.Update) {
+	chatID := update.Message.Chat.ID
+
+	arg := strings.ToLower(strings.TrimSpace(update.Message.CommandArguments()))
+	if arg != "all" && !isHash(arg) {
+		sendMessage(chatID, "Usage: /unwatchtx <txid> or /unwatchtx all")
+		return
+	}
+	if arg == "all" {
+		arg = ""
+	}
+
+	removed, err := txWatches.remove(chatID, arg)
+	if err != nil {
+		log.Println("Error saving transaction watches:", err)
+		sendMessage(chatID, "Error removing transaction watch.")
+		return
+	}
+	if removed == 0 {
+		sendMessage(chatID, "No matching watched transaction found.")
+		return
+	}
+	sendMessage(chatID, fmt.Sprintf("Stopped watching %d transaction(s).", removed))
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Update delivery modes
+const (
+	updateModePolling = "polling"
+	updateModeWebhook = "webhook"
+)
+
+// Header in which Telegram sends the secret token registered with the webhook
+const webhookSecretHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// Number of webhook updates buffered while the dispatcher is busy
+const webhookBuffer = 100
+
+// updateReceiver delivers updates from Telegram until it is stopped
+type updateReceiver interface {
+	// Channel of received updates, closed once the receiver is stopped
+	updates() tgbotapi.UpdatesChannel
+	// Function to stop receiving updates
+	stop()
+	// Function to confirm to Telegram the delivered updates with an ID below
+	// before, so only the others are delivered again after a restart
+	acknowledge(before int) error
+}
+
+// Seconds a getUpdates request waits for new updates
+const pollTimeout = 60
+
+// poller receives updates by long polling
+type poller struct {
+	ch     chan tgbotapi.Update
+	cancel context.CancelFunc
+	done   chan struct{}
+	// Update ID after the last delivered update. Only read once done is closed.
+	offset int
+}
+
+// Function to start receiving updates by long polling. Any webhook left over
+// from webhook mode is removed first, as Telegram refuses getUpdates while one is set.
+func startPolling() (*poller, error) {
+	if _, err := bot.Request(tgbotapi.DeleteWebhookConfig{}); err != nil {
+		return nil, fmt.Errorf("error removing webhook: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &poller{
+		ch:     make(chan tgbotapi.Update),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go p.run(ctx)
+	return p, nil
+}
+
+// Function to poll for updates until the context is cancelled. Updates are
+// handed over one at a time, so none are fetched ahead of the dispatcher.
+func (p *poller) run(ctx context.Context) {
+	defer close(p.done)
+	defer close(p.ch)
+
+	type result struct {
+		updates []tgbotapi.Update
+		err     error
+	}
+	for {
+		// A long poll cannot be interrupted, so it runs on its own and is
+		// abandoned when stopping. Updates it returns are not confirmed to
+		// Telegram and are delivered again after a restart.
+		config := tgbotapi.NewUpdate(p.offset)
+		config.Timeout = pollTimeout
+		fetched := make(chan result, 1)
+		go func() {
+			updates, err := bot.GetUpdates(config)
+			fetched <- result{updates, err}
+		}()
+
+		var r result
+		select {
+		case <-ctx.Done():
+			return
+		case r = <-fetched:
+		}
+		if r.err != nil {
+			log.Println("Error getting updates, retrying in 3 seconds:", r.err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(3 * time.Second):
+			}
+			continue
+		}
+
+		for _, update := range r.updates {
+			if update.UpdateID < p.offset {
+				continue
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case p.ch <- update:
+				p.offset = update.UpdateID + 1
+			}
+		}
+	}
+}
+
+func (p *poller) updates() tgbotapi.UpdatesChannel {
+	return p.ch
+}
+
+func (p *poller) stop() {
+	p.cancel()
+	<-p.done
+}
+
+// Telegram confirms all updates below the offset of a getUpdates request
+func (p *poller) acknowledge(before int) error {
+	config := tgbotapi.NewUpdate(min(p.offset, before))
+	config.Limit = 1
+	_, err := bot.GetUpdates(config)
+	return err
+}
+
+// Function to start receiving updates through a webhook on the HTTP server
+// and register it with Telegram
+func startWebhook() (*webhookReceiver, error) {
+	webhookURL, err := url.Parse(cfg.WebhookURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid webhook URL: %v", err)
+	}
+	// The root path is taken by the hello handler
+	path := webhookURL.Path
+	if path == "" || path == "/" {
+		return nil, fmt.Errorf("webhook URL needs a path, e.g. https://bot.example.com/telegram")
+	}
+	if path == "/metrics" {
+		return nil, fmt.Errorf("webhook URL path /metrics is taken by the metrics endpoint")
+	}
+
+	receiver := &webhookReceiver{
+		ch:   make(chan tgbotapi.Update, webhookBuffer),
+		done: make(chan struct{}),
+	}
+	http.Handle(path, receiver)
+
+	// The library's WebhookConfig has no secret token yet, so call setWebhook directly
+	params := tgbotapi.Params{
+		"url":          webhookURL.String(),
+		"secret_token": cfg.WebhookSecret,
+	}
+	if _, err := bot.MakeRequest("setWebhook", params); err != nil {
+		return nil, fmt.Errorf("error setting webhook: %v", err)
+	}
+	log.Println("Receiving updates through webhook on path", path)
+	return receiver, nil
+}
+
+// webhookReceiver is the HTTP handler that accepts updates from Telegram and
+// passes them to the dispatcher
+type webhookReceiver struct {
+	mu      sync.RWMutex
+	stopped bool
+	// Requests passing on an update. The channel is only closed once they returned.
+	sending sync.WaitGroup
+	ch      chan tgbotapi.Update
+	// Closed when stopping, to release requests waiting for room in the channel
+	done chan struct{}
+}
+
+func (h *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	secret := r.Header.Get(webhookSecretHeader)
+	if subtle.ConstantTimeCompare([]byte(secret), []byte(cfg.WebhookSecret)) != 1 {
+		log.Println("Rejected webhook request with invalid secret token from", r.RemoteAddr)
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	var update tgbotapi.Update
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		log.Println("Error decoding webhook update:", err)
+		http.Error(w, "invalid update", http.StatusBadRequest)
+		return
+	}
+
+	h.mu.RLock()
+	if h.stopped {
+		h.mu.RUnlock()
+		// Telegram retries the update, which reaches the bot after a restart
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	h.sending.Add(1)
+	h.mu.RUnlock()
+	defer h.sending.Done()
+
+	select {
+	case h.ch <- update:
+	case <-r.Context().Done():
+		// Telegram gave up on the request and retries the update later
+		log.Printf("Webhook request for update %d cancelled while the dispatcher was busy", update.UpdateID)
+	case <-h.done:
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+	}
+}
+
+func (h *webhookReceiver) updates() tgbotapi.UpdatesChannel {
+	return h.ch
+}
+
+func (h *webhookReceiver) stop() {
+	h.mu.Lock()
+	if h.stopped {
+		h.mu.Unlock()
+		return
+	}
+	h.stopped = true
+	close(h.done)
+	h.mu.Unlock()
+
+	h.sending.Wait()
+	close(h.ch)
+}
+
+// Every update is acknowledged by the response to its webhook request, so
+// those left unhandled cannot be delivered again
+func (h *webhookReceiver) acknowledge(before int) error {
+	if before != math.MaxInt {
+		log.Printf("Updates from %d on were left unhandled and are lost", before)
+	}
+	return nil
+}
+
+// Helper function to check a webhook secret token against the characters Telegram allows
+func validWebhookSecret(secret string) bool {
+	if len(secret) < 1 || len(secret) > 256 {
+		return false
+	}
+	return strings.Trim(secret, "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789_-") == ""
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestValidWebhookSecret(t *testing.T) {
+	tests := []struct {
+		secret string
+		want   bool
+	}{
+		{"secret", true},
+		{"Secret_Token-123", true},
+		{strings.Repeat("a", 256), true},
+		{"", false},
+		{strings.Repeat("a", 257), false},
+		{"with space", false},
+		{"colon:secret", false},
+		{"ümlaut", false},
+	}
+	for _, tt := range tests {
+		if got := validWebhookSecret(tt.secret); got != tt.want {
+			t.Errorf("validWebhookSecret(%q) = %v, want %v", tt.secret, got, tt.want)
+		}
+	}
+}
+
+func newTestWebhookReceiver(buffer int) *webhookReceiver {
+	cfg = defaultConfig()
+	cfg.WebhookSecret = "secret"
+	return &webhookReceiver{ch: make(chan tgbotapi.Update, buffer), done: make(chan struct{})}
+}
+
+func newWebhookRequest(method, secret, body string) *http.Request {
+	r := httptest.NewRequest(method, "/telegram", strings.NewReader(body))
+	if secret != "" {
+		r.Header.Set(webhookSecretHeader, secret)
+	}
+	return r
+}
+
+func TestWebhookServeHTTP(t *testing.T) {
+	tests := []struct {
+		name, method, secret, body string
+		want                       int
+		delivered                  bool
+	}{
+		{"update", http.MethodPost, "secret", `{"update_id": 7}`, http.StatusOK, true},
+		{"wrong method", http.MethodGet, "secret", "", http.StatusMethodNotAllowed, false},
+		{"missing secret", http.MethodPost, "", `{"update_id": 7}`, http.StatusForbidden, false},
+		{"wrong secret", http.MethodPost, "secreT", `{"update_id": 7}`, http.StatusForbidden, false},
+		{"invalid body", http.MethodPost, "secret", `{"update_id":`, http.StatusBadRequest, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestWebhookReceiver(1)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, newWebhookRequest(tt.method, tt.secret, tt.body))
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+			if delivered := len(h.ch) == 1; delivered != tt.delivered {
+				t.Errorf("delivered = %v, want %v", delivered, tt.delivered)
+			}
+			if tt.delivered {
+				if update := <-h.ch; update.UpdateID != 7 {
+					t.Errorf("delivered update %d, want 7", update.UpdateID)
+				}
+			}
+		})
+	}
+}
+
+func TestWebhookRejectsUpdatesAfterStop(t *testing.T) {
+	h := newTestWebhookReceiver(1)
+	h.stop()
+	h.stop()
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, newWebhookRequest(http.MethodPost, "secret", `{"update_id": 1}`))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+	if _, ok := <-h.ch; ok {
+		t.Error("update channel not closed")
+	}
+}
+
+func TestWebhookStopReleasesBlockedRequest(t *testing.T) {
+	// Nobody reads the channel, so the request waits for room in it
+	h := newTestWebhookReceiver(0)
+	w := httptest.NewRecorder()
+	served := make(chan struct{})
+	go func() {
+		h.ServeHTTP(w, newWebhookRequest(http.MethodPost, "secret", `{"update_id": 1}`))
+		close(served)
+	}()
+
+	// Give the request time to block on the channel. Should stop win the race,
+	// the request is refused the same way.
+	time.Sleep(20 * time.Millisecond)
+
+	stopped := make(chan struct{})
+	go func() {
+		h.stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("stop hung on a request waiting for the dispatcher")
+	}
+	<-served
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+}